@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+const (
+	// RoleReader can read migrations, versions, tenants and GraphQL schema
+	RoleReader = "reader"
+	// RoleOperator can do everything reader can, create versions and tenants, revert versions and read config
+	RoleOperator = "operator"
+	// RoleAdmin can do everything operator can and read raw config with unmasked sensitive values
+	RoleAdmin = "admin"
+)
+
+const defaultRoleClaim = "role"
+
+// roles are ordered, every role can do everything lower roles can
+var roleLevels = map[string]int{RoleReader: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// ErrUnauthorized is returned when request has no or invalid credentials
+var ErrUnauthorized = errors.New("Unauthorized")
+
+// ErrForbidden is returned when authenticated user does not have required role
+var ErrForbidden = errors.New("Forbidden")
+
+// RoleKey is used together with context for setting/getting role of authenticated user
+type RoleKey struct{}
+
+// UserKey is used together with context for setting/getting name of authenticated user
+type UserKey struct{}
+
+// Identity is authenticated user
+type Identity struct {
+	// Name is basic auth username, JWT subject, or name of static bearer token
+	Name string
+	Role string
+}
+
+// Authenticator authenticates HTTP requests
+type Authenticator interface {
+	// Authenticate returns identity of authenticated user or ErrUnauthorized
+	Authenticate(r *http.Request) (*Identity, error)
+	// Challenge returns value of WWW-Authenticate header sent together with 401 Unauthorized
+	Challenge() string
+}
+
+// New creates Authenticator based on auth configuration, returns nil Authenticator when auth is not configured
+func New(config *config.Config) (Authenticator, error) {
+	if config.Auth == nil {
+		return nil, nil
+	}
+	authenticator := &authenticator{tokens: config.Auth.Tokens, users: config.Auth.Users}
+	if config.Auth.JWT != nil {
+		jwtValidator, err := newJWTValidator(config.Auth.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.jwt = jwtValidator
+	}
+	return authenticator, nil
+}
+
+// Authorize returns ErrForbidden when role stored in context is lower than required role
+// when there is no role in context auth is not configured and all operations are allowed
+func Authorize(ctx context.Context, required string) error {
+	role, ok := ctx.Value(RoleKey{}).(string)
+	if !ok {
+		return nil
+	}
+	if roleLevels[role] < roleLevels[required] {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// User returns name of authenticated user stored in context or "anonymous" when auth is not configured
+func User(ctx context.Context) string {
+	if user, ok := ctx.Value(UserKey{}).(string); ok && user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// authenticator supports static bearer tokens, HTTP basic auth and JWT bearer tokens
+type authenticator struct {
+	tokens []config.Token
+	users  []config.User
+	jwt    *jwtValidator
+}
+
+func (a *authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, u := range a.users {
+			if u.Username == username && equal(u.Password, password) {
+				return &Identity{Name: u.Username, Role: u.Role}, nil
+			}
+		}
+		return nil, ErrUnauthorized
+	}
+
+	if strings.HasPrefix(header, "Bearer ") {
+		token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		for _, t := range a.tokens {
+			if equal(t.Token, token) {
+				return &Identity{Name: t.Name, Role: t.Role}, nil
+			}
+		}
+		if a.jwt != nil {
+			return a.jwt.validate(token)
+		}
+	}
+
+	return nil, ErrUnauthorized
+}
+
+func (a *authenticator) Challenge() string {
+	challenges := []string{}
+	if len(a.tokens) > 0 || a.jwt != nil {
+		challenges = append(challenges, `Bearer realm="migrator"`)
+	}
+	if len(a.users) > 0 {
+		challenges = append(challenges, `Basic realm="migrator"`)
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// equal compares secrets in constant time
+func equal(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// jwtValidator validates JWT signature using keys from JWKS file, standard claims and reads role claim
+type jwtValidator struct {
+	keys      jose.JSONWebKeySet
+	expected  jwt.Expected
+	roleClaim string
+}
+
+func newJWTValidator(config *config.JWT) (*jwtValidator, error) {
+	contents, err := ioutil.ReadFile(config.JWKSFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read JWKS file: %v", err.Error())
+	}
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(contents, &keys); err != nil {
+		return nil, fmt.Errorf("Could not parse JWKS file: %v", err.Error())
+	}
+	expected := jwt.Expected{Issuer: config.Issuer}
+	if config.Audience != "" {
+		expected.Audience = jwt.Audience{config.Audience}
+	}
+	roleClaim := config.RoleClaim
+	if roleClaim == "" {
+		roleClaim = defaultRoleClaim
+	}
+	return &jwtValidator{keys, expected, roleClaim}, nil
+}
+
+// validate returns identity with JWT subject and the highest role from role claim
+func (v *jwtValidator) validate(raw string) (*Identity, error) {
+	token, err := jwt.ParseSigned(raw)
+	if err != nil || len(token.Headers) != 1 {
+		return nil, ErrUnauthorized
+	}
+
+	// when token has no key ID all keys are tried
+	keys := v.keys.Keys
+	if kid := token.Headers[0].KeyID; kid != "" {
+		keys = v.keys.Key(kid)
+	}
+
+	for _, key := range keys {
+		var claims jwt.Claims
+		custom := map[string]interface{}{}
+		if err := token.Claims(key.Public(), &claims, &custom); err != nil {
+			continue
+		}
+		// Validate checks exp only when it is present, tokens which never expire are rejected
+		if claims.Expiry == nil {
+			return nil, ErrUnauthorized
+		}
+		expected := v.expected.WithTime(time.Now())
+		if err := claims.Validate(expected); err != nil {
+			return nil, ErrUnauthorized
+		}
+		if role := highestRole(custom[v.roleClaim]); role != "" {
+			return &Identity{Name: claims.Subject, Role: role}, nil
+		}
+		return nil, ErrUnauthorized
+	}
+
+	return nil, ErrUnauthorized
+}
+
+// highestRole returns the highest known role from role claim which can be a string or an array of strings
+func highestRole(claim interface{}) string {
+	var roles []string
+	switch c := claim.(type) {
+	case string:
+		roles = []string{c}
+	case []interface{}:
+		for _, r := range c {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+	highest := ""
+	for _, r := range roles {
+		if roleLevels[r] > roleLevels[highest] {
+			highest = r
+		}
+	}
+	return highest
+}
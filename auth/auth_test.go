@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+func newTestRequest(authorization string) *http.Request {
+	r, _ := http.NewRequest("GET", "/v2/service", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	return r
+}
+
+func TestNewNoAuth(t *testing.T) {
+	authenticator, err := New(&config.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator)
+}
+
+func TestNewJWKSFileError(t *testing.T) {
+	authenticator, err := New(&config.Config{Auth: &config.Auth{JWT: &config.JWT{JWKSFile: "/path/does/not/exist.json"}}})
+	assert.Nil(t, authenticator)
+	assert.Contains(t, err.Error(), "Could not read JWKS file")
+}
+
+func TestAuthenticateTokensAndUsers(t *testing.T) {
+	auth := &config.Auth{
+		Tokens: []config.Token{{Name: "ci-pipeline", Token: "abc", Role: RoleOperator}},
+		Users:  []config.User{{Username: "ci", Password: "secret", Role: RoleReader}},
+	}
+	authenticator, err := New(&config.Config{Auth: auth})
+	assert.Nil(t, err)
+
+	identity, err := authenticator.Authenticate(newTestRequest("Bearer abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "ci-pipeline", Role: RoleOperator}, identity)
+
+	r := newTestRequest("")
+	r.SetBasicAuth("ci", "secret")
+	identity, err = authenticator.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "ci", Role: RoleReader}, identity)
+
+	r.SetBasicAuth("ci", "wrong")
+	_, err = authenticator.Authenticate(r)
+	assert.Equal(t, ErrUnauthorized, err)
+
+	_, err = authenticator.Authenticate(newTestRequest("Bearer xyz"))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	_, err = authenticator.Authenticate(newTestRequest(""))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	assert.Equal(t, `Bearer realm="migrator", Basic realm="migrator"`, authenticator.Challenge())
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	dir, err := ioutil.TempDir("", "migrator-auth")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "key1", Algorithm: "RS256", Use: "sig"}}}
+	contents, _ := json.Marshal(jwks)
+	assert.Nil(t, ioutil.WriteFile(jwksFile, contents, 0600))
+
+	authenticator, err := New(&config.Config{Auth: &config.Auth{JWT: &config.JWT{JWKSFile: jwksFile, Issuer: "https://issuer", Audience: "migrator", RoleClaim: "roles"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, `Bearer realm="migrator"`, authenticator.Challenge())
+
+	sign := func(signingKey *rsa.PrivateKey, claims jwt.Claims, roles interface{}) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: signingKey}, (&jose.SignerOptions{}).WithHeader("kid", "key1"))
+		assert.Nil(t, err)
+		token, err := jwt.Signed(signer).Claims(claims).Claims(map[string]interface{}{"roles": roles}).CompactSerialize()
+		assert.Nil(t, err)
+		return "Bearer " + token
+	}
+
+	valid := jwt.Claims{Issuer: "https://issuer", Subject: "jane", Audience: jwt.Audience{"migrator"}, Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+
+	identity, err := authenticator.Authenticate(newTestRequest(sign(key, valid, []string{"reader", "operator"})))
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "jane", Role: RoleOperator}, identity)
+
+	identity, err = authenticator.Authenticate(newTestRequest(sign(key, valid, "reader")))
+	assert.Nil(t, err)
+	assert.Equal(t, RoleReader, identity.Role)
+
+	// unknown role
+	_, err = authenticator.Authenticate(newTestRequest(sign(key, valid, "superuser")))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	// signed with a key which is not in JWKS
+	_, err = authenticator.Authenticate(newTestRequest(sign(otherKey, valid, "operator")))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	_, err = authenticator.Authenticate(newTestRequest(sign(key, expired, "operator")))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	noExpiry := valid
+	noExpiry.Expiry = nil
+	_, err = authenticator.Authenticate(newTestRequest(sign(key, noExpiry, "operator")))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	wrongIssuer := valid
+	wrongIssuer.Issuer = "https://other"
+	_, err = authenticator.Authenticate(newTestRequest(sign(key, wrongIssuer, "operator")))
+	assert.Equal(t, ErrUnauthorized, err)
+
+	_, err = authenticator.Authenticate(newTestRequest("Bearer not.a.jwt"))
+	assert.Equal(t, ErrUnauthorized, err)
+}
+
+func TestAuthorize(t *testing.T) {
+	// no role in context means auth is not configured
+	assert.Nil(t, Authorize(context.TODO(), RoleOperator))
+
+	reader := context.WithValue(context.TODO(), RoleKey{}, RoleReader)
+	assert.Nil(t, Authorize(reader, RoleReader))
+	assert.Equal(t, ErrForbidden, Authorize(reader, RoleOperator))
+
+	operator := context.WithValue(context.TODO(), RoleKey{}, RoleOperator)
+	assert.Nil(t, Authorize(operator, RoleReader))
+	assert.Nil(t, Authorize(operator, RoleOperator))
+}
+
+func TestUser(t *testing.T) {
+	assert.Equal(t, "anonymous", User(context.TODO()))
+	assert.Equal(t, "ci", User(context.WithValue(context.TODO(), UserKey{}, "ci")))
+}
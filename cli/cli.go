@@ -0,0 +1,554 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/tracing"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const (
+	// ExitCodeOK is returned when command completed successfully
+	ExitCodeOK = 0
+	// ExitCodeUsageError is returned when command or its arguments are invalid
+	ExitCodeUsageError = 1
+	// ExitCodeCheckSumError is returned when checksum verification of source migrations failed
+	// or, with fail verification policy, when out-of-order migrations or migrations missing from source were found
+	ExitCodeCheckSumError = 2
+	// ExitCodeMigrationError is returned when migrations could not be applied, for example due to SQL errors,
+	// or when migrations failed for some of the tenants
+	ExitCodeMigrationError = 3
+	// ExitCodeMigrationInProgress is returned when migrator lock could not be acquired
+	ExitCodeMigrationInProgress = 4
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+const usage = `Usage: migrator [-configFile migrator.yaml] [command] [options]
+
+When no command is given migrator starts HTTP server.
+
+Commands:
+  apply -version-name NAME [-dry-run]                 applies source migrations
+  sync -version-name NAME [-dry-run]                  synchronises source migrations without applying them
+  create-tenant NAME -version-name NAME [-dry-run]    creates new tenant and applies tenant migrations
+  import -tool flyway|liquibase [-table NAME]         imports Flyway or Liquibase history table, matched source migrations
+         [-version-name NAME] [-dry-run]              are recorded as applied without executing them
+  verify                                              verifies checksums of source migrations, reports out-of-order
+                                                      migrations and applied migrations missing from source
+  status                                              prints tenants, applied and pending migrations
+  plan [-sql]                                         prints migrations which would be applied and schemas they will hit
+                                                      (-sql also prints SQL executed in every schema)
+
+All commands accept -output table|json option (defaults to table).
+`
+
+type createOutput struct {
+	VersionID   int32          `json:"versionId"`
+	VersionName string         `json:"versionName"`
+	Summary     *types.Summary `json:"summary"`
+}
+
+type importOutput struct {
+	createOutput
+	Imported  []types.Migration             `json:"imported"`
+	Unmatched []types.UnmatchedHistoryEntry `json:"unmatched"`
+	Warnings  []types.UnmatchedHistoryEntry `json:"warnings"`
+}
+
+type verifyOutput struct {
+	Verified             bool              `json:"verified"`
+	OffendingMigrations  []types.Migration `json:"offendingMigrations"`
+	OutOfOrderMigrations []types.Migration `json:"outOfOrderMigrations"`
+	MissingMigrations    []types.Migration `json:"missingMigrations"`
+}
+
+type statusOutput struct {
+	Tenants           int               `json:"tenants"`
+	SourceMigrations  int               `json:"sourceMigrations"`
+	AppliedMigrations int               `json:"appliedMigrations"`
+	LatestVersion     *types.Version    `json:"latestVersion"`
+	PendingMigrations []types.Migration `json:"pendingMigrations"`
+}
+
+type errorOutput struct {
+	ErrorMessage string `json:"error"`
+}
+
+// Run executes CLI command passed in args and returns process exit code
+func Run(args []string, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator, stdout, stderr io.Writer) (exitCode int) {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return ExitCodeUsageError
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	buf := new(bytes.Buffer)
+	flags.SetOutput(buf)
+
+	var output, versionName, tool, table string
+	var dryRun, printSQL bool
+	flags.StringVar(&output, "output", outputTable, "output format: table or json")
+	switch command {
+	case "apply", "sync", "create-tenant":
+		flags.StringVar(&versionName, "version-name", "", "name of the version to create")
+		flags.BoolVar(&dryRun, "dry-run", false, "run in dry-run mode, all changes are rolled back")
+	case "import":
+		flags.StringVar(&tool, "tool", "", "tool whose history table is imported: flyway or liquibase")
+		flags.StringVar(&table, "table", "", "history table, defaults to flyway_schema_history or DATABASECHANGELOG")
+		flags.StringVar(&versionName, "version-name", "", "name of the version to create, defaults to Imported from <tool>")
+		flags.BoolVar(&dryRun, "dry-run", false, "run in dry-run mode, all changes are rolled back")
+	case "plan":
+		flags.BoolVar(&printSQL, "sql", false, "print SQL executed in every schema")
+	case "verify", "status":
+	default:
+		fmt.Fprintf(stderr, "Unknown command: %v\n\n%v", command, usage)
+		return ExitCodeUsageError
+	}
+
+	positional, err := parseFlags(flags, args[1:])
+	if err != nil {
+		fmt.Fprint(stderr, buf.String())
+		return ExitCodeUsageError
+	}
+
+	if output != outputTable && output != outputJSON {
+		fmt.Fprintf(stderr, "Unknown output format: %v\n", output)
+		return ExitCodeUsageError
+	}
+
+	var tenant string
+	switch command {
+	case "create-tenant":
+		if len(positional) != 1 {
+			fmt.Fprintf(stderr, "Command %v requires tenant name\n", command)
+			return ExitCodeUsageError
+		}
+		tenant = positional[0]
+		fallthrough
+	case "apply", "sync":
+		if strings.TrimSpace(versionName) == "" {
+			fmt.Fprintf(stderr, "Command %v requires -version-name option\n", command)
+			return ExitCodeUsageError
+		}
+	}
+
+	var historyTool types.HistoryTool
+	if command == "import" {
+		switch strings.ToLower(tool) {
+		case "flyway":
+			historyTool = types.HistoryToolFlyway
+		case "liquibase":
+			historyTool = types.HistoryToolLiquibase
+		default:
+			fmt.Fprintf(stderr, "Command %v requires -tool option set to flyway or liquibase\n", command)
+			return ExitCodeUsageError
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), common.RequestIDKey{}, fmt.Sprintf("%d", time.Now().UnixNano()))
+	ctx, span := tracing.StartSpan(ctx, "cli "+command)
+	defer span.End()
+
+	// unexpected panics are reported as migration errors
+	defer func() {
+		if r := recover(); r != nil {
+			span.SetError(fmt.Sprintf("%v", r))
+			common.LogPanic(ctx, "Panic recovered: %v", r)
+			writeError(stderr, output, fmt.Sprintf("%v", r))
+			exitCode = ExitCodeMigrationError
+		}
+	}()
+
+	coordinator := newCoordinator(ctx, config)
+	defer coordinator.Dispose()
+
+	switch command {
+	case "apply":
+		return create(coordinator, stdout, stderr, output, func() (*types.CreateResults, error) {
+			return coordinator.CreateVersion(versionName, types.ActionApply, dryRun)
+		})
+	case "sync":
+		return create(coordinator, stdout, stderr, output, func() (*types.CreateResults, error) {
+			return coordinator.CreateVersion(versionName, types.ActionSync, dryRun)
+		})
+	case "create-tenant":
+		return create(coordinator, stdout, stderr, output, func() (*types.CreateResults, error) {
+			return coordinator.CreateTenant(versionName, types.ActionApply, dryRun, tenant)
+		})
+	case "import":
+		return importHistory(stdout, stderr, output, func() (*types.ImportResults, error) {
+			return coordinator.ImportHistory(historyTool, table, versionName, dryRun)
+		})
+	case "verify":
+		return verify(coordinator, stdout, stderr, output)
+	case "plan":
+		return plan(coordinator, stdout, stderr, output, printSQL)
+	default:
+		return status(coordinator, stdout, stderr, output)
+	}
+}
+
+// parseFlags parses flags which can be passed before or after positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func create(coordinator coordinator.Coordinator, stdout, stderr io.Writer, output string, createFunc func() (*types.CreateResults, error)) int {
+	if err := coordinator.VerifySourceMigrationsCheckSums(); err != nil {
+		if checksumErr, ok := asChecksumMismatch(err); ok {
+			writeVerify(stdout, output, &verifyOutput{false, checksumErr.Migrations, []types.Migration{}, []types.Migration{}})
+			return ExitCodeCheckSumError
+		}
+		return errorExitCode(stderr, output, err)
+	}
+
+	results, err := createFunc()
+	if verificationErr, ok := asVerificationError(err); ok {
+		writeVerify(stdout, output, &verifyOutput{false, []types.Migration{}, verificationErr.OutOfOrderMigrations, verificationErr.MissingMigrations})
+		return ExitCodeCheckSumError
+	}
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+
+	result := &createOutput{Summary: results.Summary}
+	if results.Version != nil {
+		result.VersionID = results.Version.ID
+		result.VersionName = results.Version.Name
+	}
+
+	// with per-tenant and per-migration transaction strategies some tenants may fail
+	exitCode := ExitCodeOK
+	if results.Summary != nil && len(results.Summary.FailedTenants) > 0 {
+		exitCode = ExitCodeMigrationError
+	}
+
+	if output == outputJSON {
+		writeJSON(stdout, result)
+		return exitCode
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	writeCreate(w, result)
+	w.Flush()
+
+	if exitCode != ExitCodeOK {
+		fmt.Fprintln(stdout)
+		w = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FAILED TENANT\tFILE\tERROR")
+		for _, f := range results.Summary.FailedTenants {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", f.Name, f.File, f.Error)
+		}
+		w.Flush()
+	}
+
+	return exitCode
+}
+
+// writeCreate writes version and summary rows, caller flushes the writer
+func writeCreate(w *tabwriter.Writer, result *createOutput) {
+	fmt.Fprintf(w, "Version ID\t%v\n", result.VersionID)
+	fmt.Fprintf(w, "Version name\t%v\n", result.VersionName)
+	if s := result.Summary; s != nil {
+		fmt.Fprintf(w, "Started at\t%v\n", s.StartedAt.Time.Format(time.RFC3339))
+		fmt.Fprintf(w, "Duration\t%v\n", s.Duration)
+		fmt.Fprintf(w, "Tenants\t%v\n", s.Tenants)
+		fmt.Fprintf(w, "Single migrations\t%v\n", s.SingleMigrations)
+		fmt.Fprintf(w, "Tenant migrations\t%v\n", s.TenantMigrations)
+		fmt.Fprintf(w, "Tenant migrations total\t%v\n", s.TenantMigrationsTotal)
+		fmt.Fprintf(w, "Migrations grand total\t%v\n", s.MigrationsGrandTotal)
+		fmt.Fprintf(w, "Single scripts\t%v\n", s.SingleScripts)
+		fmt.Fprintf(w, "Tenant scripts\t%v\n", s.TenantScripts)
+		fmt.Fprintf(w, "Tenant scripts total\t%v\n", s.TenantScriptsTotal)
+		fmt.Fprintf(w, "Scripts grand total\t%v\n", s.ScriptsGrandTotal)
+	}
+}
+
+// importHistory prints imported migrations, unmatched history entries and warnings, unmatched entries and warnings are not treated as an error
+func importHistory(stdout, stderr io.Writer, output string, importFunc func() (*types.ImportResults, error)) int {
+	results, err := importFunc()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+
+	result := &importOutput{createOutput: createOutput{Summary: results.Summary}, Imported: []types.Migration{}, Unmatched: results.Unmatched, Warnings: results.Warnings}
+	if results.Version != nil {
+		result.VersionID = results.Version.ID
+		result.VersionName = results.Version.Name
+	}
+	for _, m := range results.Imported {
+		m.Contents = ""
+		m.DownContents = ""
+		result.Imported = append(result.Imported, m)
+	}
+	if result.Unmatched == nil {
+		result.Unmatched = []types.UnmatchedHistoryEntry{}
+	}
+	if result.Warnings == nil {
+		result.Warnings = []types.UnmatchedHistoryEntry{}
+	}
+
+	if output == outputJSON {
+		writeJSON(stdout, result)
+		return ExitCodeOK
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	writeCreate(w, &result.createOutput)
+	fmt.Fprintf(w, "Imported migrations\t%v\n", len(result.Imported))
+	fmt.Fprintf(w, "Unmatched entries\t%v\n", len(result.Unmatched))
+	fmt.Fprintf(w, "Warnings\t%v\n", len(result.Warnings))
+	w.Flush()
+
+	tables := []struct {
+		header  string
+		entries []types.UnmatchedHistoryEntry
+	}{{"REASON", result.Unmatched}, {"WARNING", result.Warnings}}
+	for _, table := range tables {
+		if len(table.entries) == 0 {
+			continue
+		}
+		fmt.Fprintln(stdout)
+		w = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "VERSION\tSCRIPT\t%v\n", table.header)
+		for _, u := range table.entries {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", u.Version, u.Script, u.Reason)
+		}
+		w.Flush()
+	}
+
+	return ExitCodeOK
+}
+
+// asChecksumMismatch returns checksum mismatch error returned when applied migrations were modified in source
+func asChecksumMismatch(err error) (*coordinator.ErrChecksumMismatch, bool) {
+	checksumErr, ok := err.(*coordinator.ErrChecksumMismatch)
+	return checksumErr, ok
+}
+
+// asVerificationError returns verification error returned when fail verification policy is set
+func asVerificationError(err error) (*coordinator.VerificationError, bool) {
+	verificationErr, ok := err.(*coordinator.VerificationError)
+	return verificationErr, ok
+}
+
+func verify(coordinator coordinator.Coordinator, stdout, stderr io.Writer, output string) int {
+	verification, err := coordinator.VerifySourceMigrations()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+	writeVerify(stdout, output, &verifyOutput{verification.Verified, verification.ModifiedMigrations, verification.OutOfOrderMigrations, verification.MissingMigrations})
+	if !verification.Verified {
+		return ExitCodeCheckSumError
+	}
+	return ExitCodeOK
+}
+
+func writeVerify(stdout io.Writer, output string, result *verifyOutput) {
+	if output == outputJSON {
+		writeJSON(stdout, result)
+		return
+	}
+
+	if len(result.OffendingMigrations) == 0 {
+		fmt.Fprintln(stdout, "Checksum verification OK")
+	} else {
+		fmt.Fprintln(stdout, "Checksum verification failed for migrations:")
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tCHECKSUM")
+		for _, m := range result.OffendingMigrations {
+			fmt.Fprintf(w, "%v\t%v\n", m.File, m.CheckSum)
+		}
+		w.Flush()
+	}
+
+	// out-of-order and missing migrations are reported even when they are allowed by verification policy
+	for _, section := range []struct {
+		title      string
+		migrations []types.Migration
+	}{
+		{"Out-of-order migrations (pending migrations ordered before applied migrations):", result.OutOfOrderMigrations},
+		{"Applied migrations missing from source:", result.MissingMigrations},
+	} {
+		if len(section.migrations) == 0 {
+			continue
+		}
+		fmt.Fprintf(stdout, "\n%v\n", section.title)
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tTYPE")
+		for _, m := range section.migrations {
+			fmt.Fprintf(w, "%v\t%v\n", m.File, m.MigrationType)
+		}
+		w.Flush()
+	}
+}
+
+func status(coordinator coordinator.Coordinator, stdout, stderr io.Writer, output string) int {
+	tenants, err := coordinator.GetTenants()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+	sourceMigrations, err := coordinator.GetSourceMigrations(nil)
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+	appliedMigrations, err := coordinator.GetAppliedMigrations()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+	versions, err := coordinator.GetVersions()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+
+	appliedFiles := make(map[string]bool)
+	for _, m := range appliedMigrations {
+		appliedFiles[m.File] = true
+	}
+
+	// scripts are applied always and are never pending
+	pendingMigrations := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		if !appliedFiles[m.File] {
+			m.Contents = ""
+			m.DownContents = ""
+			pendingMigrations = append(pendingMigrations, m)
+		}
+	}
+
+	result := &statusOutput{
+		Tenants:           len(tenants),
+		SourceMigrations:  len(sourceMigrations),
+		AppliedMigrations: len(appliedMigrations),
+		PendingMigrations: pendingMigrations,
+	}
+	// versions are sorted in descending order
+	if len(versions) > 0 {
+		result.LatestVersion = &types.Version{ID: versions[0].ID, Name: versions[0].Name, Created: versions[0].Created}
+	}
+
+	if output == outputJSON {
+		writeJSON(stdout, result)
+		return ExitCodeOK
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Tenants\t%v\n", result.Tenants)
+	fmt.Fprintf(w, "Source migrations\t%v\n", result.SourceMigrations)
+	fmt.Fprintf(w, "Applied migrations\t%v\n", result.AppliedMigrations)
+	if result.LatestVersion != nil {
+		fmt.Fprintf(w, "Latest version\t%v (ID: %v, created: %v)\n", result.LatestVersion.Name, result.LatestVersion.ID, result.LatestVersion.Created.Time.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "Latest version\t-\n")
+	}
+	fmt.Fprintf(w, "Pending migrations\t%v\n", len(result.PendingMigrations))
+	w.Flush()
+
+	if len(result.PendingMigrations) > 0 {
+		fmt.Fprintln(stdout)
+		w = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tTYPE")
+		for _, m := range result.PendingMigrations {
+			fmt.Fprintf(w, "%v\t%v\n", m.File, m.MigrationType)
+		}
+		w.Flush()
+	}
+
+	return ExitCodeOK
+}
+
+func plan(coordinator coordinator.Coordinator, stdout, stderr io.Writer, output string, printSQL bool) int {
+	plan, err := coordinator.Plan()
+	if err != nil {
+		return errorExitCode(stderr, output, err)
+	}
+
+	if output == outputJSON {
+		writeJSON(stdout, plan)
+		return ExitCodeOK
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Tenants\t%v\n", plan.Tenants)
+	fmt.Fprintf(w, "Pending migrations\t%v\n", len(plan.Migrations))
+	w.Flush()
+
+	if len(plan.Migrations) == 0 {
+		return ExitCodeOK
+	}
+
+	fmt.Fprintln(stdout)
+	w = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tTYPE\tSCHEMAS")
+	for _, m := range plan.Migrations {
+		schemas := make([]string, 0, len(m.Schemas))
+		for _, s := range m.Schemas {
+			schemas = append(schemas, s.Schema)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\n", m.File, m.MigrationType, strings.Join(schemas, ", "))
+	}
+	w.Flush()
+
+	if printSQL {
+		for _, m := range plan.Migrations {
+			for _, s := range m.Schemas {
+				fmt.Fprintf(stdout, "\n-- %v (schema: %v)\n%v\n", m.File, s.Schema, strings.TrimSpace(s.SQL))
+			}
+		}
+	}
+
+	return ExitCodeOK
+}
+
+// errorExitCode writes error and returns exit code matching the error
+func errorExitCode(stderr io.Writer, output string, err error) int {
+	writeError(stderr, output, err.Error())
+	if err == db.ErrMigrationInProgress {
+		return ExitCodeMigrationInProgress
+	}
+	return ExitCodeMigrationError
+}
+
+func writeError(stderr io.Writer, output string, message string) {
+	if output == outputJSON {
+		writeJSON(stderr, &errorOutput{message})
+		return
+	}
+	fmt.Fprintf(stderr, "Error: %v\n", message)
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+type mockedCoordinator struct {
+	checkSumError     bool
+	verificationError bool
+	locked            bool
+	migrationFailed   bool
+	loadFailed        bool
+	panicMessage      string
+	failedTenant      bool
+}
+
+func newMockedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{}
+}
+
+func newMockedCheckSumErrorCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{checkSumError: true}
+}
+
+func newMockedVerificationErrorCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{verificationError: true}
+}
+
+func newMockedLockedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{locked: true}
+}
+
+func newMockedMigrationFailedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{migrationFailed: true}
+}
+
+func newMockedLoadFailedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{loadFailed: true}
+}
+
+func newMockedPanicCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{panicMessage: "runtime error: invalid memory address or nil pointer dereference"}
+}
+
+func newMockedFailedTenantCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{failedTenant: true}
+}
+
+func (m *mockedCoordinator) Dispose() {
+}
+
+func (m *mockedCoordinator) create(versionName string, action types.Action) (*types.CreateResults, error) {
+	if m.locked {
+		return nil, db.ErrMigrationInProgress
+	}
+	if m.migrationFailed {
+		return nil, &db.ErrMigrationFailed{File: "tenants/201602220001.sql", Schema: "abc", Cause: errors.New("trouble maker")}
+	}
+	if m.verificationError && action == types.ActionApply {
+		outOfOrder, missing := m.verificationMigrations()
+		return nil, &coordinator.VerificationError{OutOfOrderMigrations: outOfOrder, MissingMigrations: missing}
+	}
+	summary := &types.MigrationResults{StartedAt: graphql.Time{Time: time.Date(2020, 02, 20, 10, 0, 0, 0, time.UTC)}, Tenants: 3}
+	if action == types.ActionApply {
+		summary.SingleMigrations = 1
+		summary.TenantMigrations = 1
+		summary.TenantMigrationsTotal = 3
+		summary.MigrationsGrandTotal = 4
+	}
+	if m.failedTenant {
+		summary.SucceededTenants = []string{"a", "b"}
+		summary.FailedTenants = []types.FailedTenant{{Name: "c", File: "tenants/201602220001.sql", Error: "SQL migration tenants/201602220001.sql failed with error: trouble maker"}}
+	}
+	return &types.CreateResults{Summary: summary, Version: &types.Version{ID: 123, Name: versionName}}, nil
+}
+
+func (m *mockedCoordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string) (*types.CreateResults, error) {
+	return m.create(versionName, action)
+}
+
+func (m *mockedCoordinator) CreateVersion(versionName string, action types.Action, dryRun bool) (*types.CreateResults, error) {
+	return m.create(versionName, action)
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) RevertVersion(int32, bool) (*types.CreateResults, error) {
+	return nil, nil
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) RepairChecksums([]string, string, string) (*types.RepairResults, error) {
+	return nil, nil
+}
+
+func (m *mockedCoordinator) ImportHistory(tool types.HistoryTool, table, versionName string, dryRun bool) (*types.ImportResults, error) {
+	if m.locked {
+		return nil, db.ErrMigrationInProgress
+	}
+	summary := &types.MigrationResults{StartedAt: graphql.Time{Time: time.Date(2020, 02, 20, 10, 0, 0, 0, time.UTC)}, Tenants: 3, SingleMigrations: 1, MigrationsGrandTotal: 1}
+	imported := []types.Migration{{Name: "V1__init.sql", SourceDir: "ref", File: "ref/V1__init.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}}
+	unmatched := []types.UnmatchedHistoryEntry{{HistoryEntry: types.HistoryEntry{Version: "2", Description: "removed", Script: "V2__removed.sql", CheckSum: "123", Type: "SQL", Success: true}, Reason: "Source migration not found"}}
+	warnings := []types.UnmatchedHistoryEntry{{HistoryEntry: types.HistoryEntry{Version: "1", Description: "lukasz", Script: "V1__init.sql", CheckSum: "8:abc", Type: "EXECUTED", Success: true}, Reason: "Checksum mismatch: ref/V1__init.sql"}}
+	return &types.ImportResults{Summary: summary, Version: &types.Version{ID: 123, Name: fmt.Sprintf("Imported from %v", tool)}, Imported: imported, Unmatched: unmatched, Warnings: warnings}, nil
+}
+
+func (m *mockedCoordinator) Plan() (*types.Plan, error) {
+	if _, err := m.GetSourceMigrations(nil); err != nil {
+		return nil, err
+	}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def"}
+	schemas := []types.PlannedSchema{{Schema: "abc", SQL: "create table abc.def"}, {Schema: "xyz", SQL: "create table xyz.def"}}
+	return &types.Plan{Tenants: 2, Migrations: []types.PlannedMigration{{Migration: m2, Schemas: schemas}}}, nil
+}
+
+func (m *mockedCoordinator) GetSourceMigrations(_ *coordinator.SourceMigrationFilters) ([]types.Migration, error) {
+	if m.loadFailed {
+		return nil, &loader.ErrLoadFailed{BaseLocation: "/migrations", Cause: errors.New("Could not read source dir /migrations/source")}
+	}
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
+	m3 := types.Migration{Name: "recreate-views.sql", SourceDir: "scripts", File: "scripts/recreate-views.sql", MigrationType: types.MigrationTypeSingleScript, Contents: "select ghi"}
+	return []types.Migration{m1, m2, m3}, nil
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
+	return nil, nil
+}
+
+func (m *mockedCoordinator) GetAppliedMigrations() ([]types.MigrationDB, error) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "sha256"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	ms := []types.MigrationDB{{Migration: m1, Schema: "source", AppliedAt: graphql.Time{Time: d1}, Created: graphql.Time{Time: d1}}}
+	return ms, nil
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
+	return nil, nil
+}
+
+func (m *mockedCoordinator) GetTenants() ([]types.Tenant, error) {
+	if m.panicMessage != "" {
+		panic(m.panicMessage)
+	}
+	a := types.Tenant{Name: "a"}
+	b := types.Tenant{Name: "b"}
+	c := types.Tenant{Name: "c"}
+	return []types.Tenant{a, b, c}, nil
+}
+
+func (m *mockedCoordinator) GetVersions() ([]types.Version, error) {
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 0, time.UTC)
+	return []types.Version{{ID: 12, Name: "a", Created: graphql.Time{Time: d1}}}, nil
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetVersionsByFile(file string) ([]types.Version, error) {
+	return []types.Version{}, nil
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
+	return nil, nil
+}
+
+func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() error {
+	if m.checkSumError {
+		m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, CheckSum: "123"}
+		return &coordinator.ErrChecksumMismatch{Migrations: []types.Migration{m1}}
+	}
+	if m.loadFailed {
+		_, err := m.GetSourceMigrations(nil)
+		return err
+	}
+	return nil
+}
+
+func (m *mockedCoordinator) VerifySourceMigrations() (*types.Verification, error) {
+	verification := &types.Verification{Verified: true, ModifiedMigrations: []types.Migration{}, OutOfOrderMigrations: []types.Migration{}, MissingMigrations: []types.Migration{}}
+	if err := m.VerifySourceMigrationsCheckSums(); err != nil {
+		checksumErr, ok := err.(*coordinator.ErrChecksumMismatch)
+		if !ok {
+			return nil, err
+		}
+		verification.Verified = false
+		verification.ModifiedMigrations = checksumErr.Migrations
+	}
+	if m.verificationError {
+		verification.Verified = false
+		verification.OutOfOrderMigrations, verification.MissingMigrations = m.verificationMigrations()
+	}
+	return verification, nil
+}
+
+func (m *mockedCoordinator) verificationMigrations() ([]types.Migration, []types.Migration) {
+	outOfOrder := types.Migration{Name: "201602220001.sql", SourceDir: "source", File: "source/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	missing := types.Migration{Name: "201501010000.sql", SourceDir: "source", File: "source/201501010000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	return []types.Migration{outOfOrder}, []types.Migration{missing}
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration, error) {
+	panic("ApplyMigrations should not be called by cli")
+}
+
+// part of interface but not used in cli tests
+func (m *mockedCoordinator) AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration, error) {
+	panic("AddTenantAndApplyMigrations should not be called by cli")
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func run(newCoordinator func(context.Context, *config.Config) coordinator.Coordinator, args ...string) (int, string, string) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := Run(args, &config.Config{}, newCoordinator, stdout, stderr)
+	return exitCode, stdout.String(), stderr.String()
+}
+
+func TestRunNoCommand(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator)
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Contains(t, stderr, "Usage: migrator")
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "abc")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Contains(t, stderr, "Unknown command: abc")
+}
+
+func TestRunUnknownFlag(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "verify", "-abc")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Contains(t, stderr, "flag provided but not defined: -abc")
+}
+
+func TestRunUnknownOutput(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "status", "-output", "xml")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Equal(t, "Unknown output format: xml\n", stderr)
+}
+
+func TestRunApplyMissingVersionName(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "apply", "--dry-run")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Equal(t, "Command apply requires -version-name option\n", stderr)
+}
+
+func TestRunApply(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "apply", "--version-name", "commit-sha", "--dry-run")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Contains(t, stdout, "Version name             commit-sha\n")
+	assert.Contains(t, stdout, "Migrations grand total   4\n")
+}
+
+func TestRunApplyJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "apply", "--version-name", "commit-sha", "--output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result createOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(123), result.VersionID)
+	assert.Equal(t, "commit-sha", result.VersionName)
+	assert.Equal(t, int32(4), result.Summary.MigrationsGrandTotal)
+}
+
+func TestRunSyncJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "sync", "-version-name", "commit-sha", "-output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result createOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), result.Summary.MigrationsGrandTotal)
+	assert.Equal(t, int32(3), result.Summary.Tenants)
+}
+
+func TestRunApplyCheckSumError(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCheckSumErrorCoordinator, "apply", "--version-name", "commit-sha")
+	assert.Equal(t, ExitCodeCheckSumError, exitCode)
+	assert.Contains(t, stdout, "Checksum verification failed for migrations:")
+	assert.Contains(t, stdout, "source/201602220000.sql  123")
+}
+
+func TestRunApplyVerificationError(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedVerificationErrorCoordinator, "apply", "--version-name", "commit-sha")
+	assert.Equal(t, ExitCodeCheckSumError, exitCode)
+	assert.Contains(t, stdout, "Checksum verification OK\n")
+	assert.Contains(t, stdout, "source/201602220001.sql  SingleMigration\n")
+	assert.Contains(t, stdout, "source/201501010000.sql  SingleMigration\n")
+}
+
+func TestRunApplyMigrationInProgress(t *testing.T) {
+	exitCode, _, stderr := run(newMockedLockedCoordinator, "apply", "--version-name", "commit-sha", "--output", "json")
+	assert.Equal(t, ExitCodeMigrationInProgress, exitCode)
+	assert.Equal(t, "{\n  \"error\": \"Another migration is in progress, please try again later\"\n}\n", stderr)
+}
+
+func TestRunApplyMigrationError(t *testing.T) {
+	exitCode, _, stderr := run(newMockedMigrationFailedCoordinator, "apply", "--version-name", "commit-sha")
+	assert.Equal(t, ExitCodeMigrationError, exitCode)
+	assert.Equal(t, "Error: SQL migration tenants/201602220001.sql failed with error: trouble maker\n", stderr)
+}
+
+func TestRunLoadError(t *testing.T) {
+	for _, args := range [][]string{{"status"}, {"verify"}, {"plan"}, {"apply", "--version-name", "commit-sha"}} {
+		exitCode, _, stderr := run(newMockedLoadFailedCoordinator, args...)
+		assert.Equal(t, ExitCodeMigrationError, exitCode, args[0])
+		assert.Equal(t, "Error: Could not read source dir /migrations/source\n", stderr, args[0])
+	}
+}
+
+func TestRunPanicRecovered(t *testing.T) {
+	exitCode, _, stderr := run(newMockedPanicCoordinator, "status")
+	assert.Equal(t, ExitCodeMigrationError, exitCode)
+	assert.Equal(t, "Error: runtime error: invalid memory address or nil pointer dereference\n", stderr)
+}
+
+func TestRunApplyFailedTenant(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedFailedTenantCoordinator, "apply", "--version-name", "commit-sha")
+	assert.Equal(t, ExitCodeMigrationError, exitCode)
+	assert.Contains(t, stdout, "FAILED TENANT  FILE                      ERROR\n")
+	assert.Contains(t, stdout, "c              tenants/201602220001.sql  SQL migration")
+}
+
+func TestRunCreateTenant(t *testing.T) {
+	// flags can be passed both before and after tenant name
+	exitCode, stdout, _ := run(newMockedCoordinator, "create-tenant", "--version-name", "commit-sha", "new_tenant", "--output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result createOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "commit-sha", result.VersionName)
+}
+
+func TestRunCreateTenantMissingName(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "create-tenant", "--version-name", "commit-sha")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Equal(t, "Command create-tenant requires tenant name\n", stderr)
+}
+
+func TestRunImport(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "import", "-tool", "flyway")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Contains(t, stdout, "Version name             Imported from Flyway\n")
+	assert.Contains(t, stdout, "Imported migrations      1\n")
+	assert.Contains(t, stdout, "Warnings                 1\n")
+	assert.Contains(t, stdout, "VERSION  SCRIPT           REASON\n2        V2__removed.sql  Source migration not found\n")
+	assert.Contains(t, stdout, "VERSION  SCRIPT        WARNING\n1        V1__init.sql  Checksum mismatch: ref/V1__init.sql\n")
+}
+
+func TestRunImportJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "import", "-tool", "Liquibase", "-output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result importOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "Imported from Liquibase", result.VersionName)
+	assert.Equal(t, "ref/V1__init.sql", result.Imported[0].File)
+	assert.Equal(t, "", result.Imported[0].Contents)
+	assert.Equal(t, "Source migration not found", result.Unmatched[0].Reason)
+	assert.Equal(t, "Checksum mismatch: ref/V1__init.sql", result.Warnings[0].Reason)
+}
+
+func TestRunImportUnknownTool(t *testing.T) {
+	exitCode, _, stderr := run(newMockedCoordinator, "import", "-tool", "rails")
+	assert.Equal(t, ExitCodeUsageError, exitCode)
+	assert.Equal(t, "Command import requires -tool option set to flyway or liquibase\n", stderr)
+}
+
+func TestRunImportMigrationInProgress(t *testing.T) {
+	exitCode, _, _ := run(newMockedLockedCoordinator, "import", "-tool", "flyway")
+	assert.Equal(t, ExitCodeMigrationInProgress, exitCode)
+}
+
+func TestRunVerify(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "verify")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Equal(t, "Checksum verification OK\n", stdout)
+}
+
+func TestRunVerifyCheckSumErrorJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCheckSumErrorCoordinator, "verify", "-output", "json")
+	assert.Equal(t, ExitCodeCheckSumError, exitCode)
+
+	var result verifyOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.False(t, result.Verified)
+	assert.Equal(t, "source/201602220000.sql", result.OffendingMigrations[0].File)
+}
+
+func TestRunVerifyVerificationError(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedVerificationErrorCoordinator, "verify")
+	assert.Equal(t, ExitCodeCheckSumError, exitCode)
+	assert.Contains(t, stdout, "Out-of-order migrations (pending migrations ordered before applied migrations):\nFILE                     TYPE\nsource/201602220001.sql  SingleMigration\n")
+	assert.Contains(t, stdout, "Applied migrations missing from source:\nFILE                     TYPE\nsource/201501010000.sql  SingleMigration\n")
+}
+
+func TestRunVerifyVerificationErrorJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedVerificationErrorCoordinator, "verify", "-output", "json")
+	assert.Equal(t, ExitCodeCheckSumError, exitCode)
+
+	var result verifyOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.False(t, result.Verified)
+	assert.Empty(t, result.OffendingMigrations)
+	assert.Equal(t, "source/201602220001.sql", result.OutOfOrderMigrations[0].File)
+	assert.Equal(t, "source/201501010000.sql", result.MissingMigrations[0].File)
+}
+
+func TestRunStatus(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "status")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Contains(t, stdout, "Latest version      a (ID: 12, created: 2016-02-22T16:41:01Z)\n")
+	assert.Contains(t, stdout, "Pending migrations  1\n")
+	assert.Contains(t, stdout, "tenants/201602220001.sql  TenantMigration\n")
+}
+
+func TestRunPlan(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "plan")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Contains(t, stdout, "Pending migrations  1\n")
+	assert.Contains(t, stdout, "tenants/201602220001.sql  TenantMigration  abc, xyz\n")
+	assert.NotContains(t, stdout, "create table")
+
+	exitCode, stdout, _ = run(newMockedCoordinator, "plan", "-sql")
+	assert.Equal(t, ExitCodeOK, exitCode)
+	assert.Contains(t, stdout, "-- tenants/201602220001.sql (schema: abc)\ncreate table abc.def\n")
+	assert.Contains(t, stdout, "-- tenants/201602220001.sql (schema: xyz)\ncreate table xyz.def\n")
+}
+
+func TestRunPlanJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "plan", "-output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result types.Plan
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), result.Tenants)
+	assert.Len(t, result.Migrations, 1)
+	assert.Equal(t, []types.PlannedSchema{{Schema: "abc", SQL: "create table abc.def"}, {Schema: "xyz", SQL: "create table xyz.def"}}, result.Migrations[0].Schemas)
+}
+
+func TestRunStatusJSON(t *testing.T) {
+	exitCode, stdout, _ := run(newMockedCoordinator, "status", "-output", "json")
+	assert.Equal(t, ExitCodeOK, exitCode)
+
+	var result statusOutput
+	err := json.Unmarshal([]byte(stdout), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Tenants)
+	assert.Equal(t, 3, result.SourceMigrations)
+	assert.Equal(t, 1, result.AppliedMigrations)
+	assert.Equal(t, int32(12), result.LatestVersion.ID)
+	// scripts are never pending
+	assert.Len(t, result.PendingMigrations, 1)
+	assert.Equal(t, "tenants/201602220001.sql", result.PendingMigrations[0].File)
+	assert.Empty(t, result.PendingMigrations[0].Contents)
+}
@@ -3,46 +3,47 @@ package common
 import (
 	"context"
 	"fmt"
-	"log"
 	"runtime"
 )
 
 // RequestIDKey is used together with context for setting/getting X-Request-ID
 type RequestIDKey struct{}
 
-// LogError logs error message
-func LogError(ctx context.Context, format string, a ...interface{}) string {
-	return logLevel(ctx, "ERROR", format, a...)
+// LogDebug logs debug message
+func LogDebug(ctx context.Context, format string, a ...interface{}) string {
+	return logLevel(ctx, LevelDebug, format, a...)
 }
 
 // LogInfo logs info message
 func LogInfo(ctx context.Context, format string, a ...interface{}) string {
-	return logLevel(ctx, "INFO", format, a...)
+	return logLevel(ctx, LevelInfo, format, a...)
+}
+
+// LogWarn logs warning message
+func LogWarn(ctx context.Context, format string, a ...interface{}) string {
+	return logLevel(ctx, LevelWarn, format, a...)
+}
+
+// LogError logs error message
+func LogError(ctx context.Context, format string, a ...interface{}) string {
+	return logLevel(ctx, LevelError, format, a...)
 }
 
 // LogPanic logs error message
 func LogPanic(ctx context.Context, format string, a ...interface{}) string {
-	return logLevel(ctx, "PANIC", format, a...)
+	return logLevel(ctx, LevelPanic, format, a...)
 }
 
 // Log logs message with a given level with no request context
 func Log(level string, format string, a ...interface{}) string {
-	_, file, line, _ := runtime.Caller(2)
-
-	message := fmt.Sprintf(format, a...)
-
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC)
-	log.Printf("[%v:%v] %v %v", file, line, level, message)
-	return message
+	return logLevel(nil, level, format, a...)
 }
 
 func logLevel(ctx context.Context, level string, format string, a ...interface{}) string {
 	_, file, line, _ := runtime.Caller(2)
 
-	requestID := ctx.Value(RequestIDKey{})
 	message := fmt.Sprintf(format, a...)
 
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC)
-	log.Printf("[%v:%v] %v requestId=%v %v", file, line, level, requestID, message)
+	std.write(ctx, level, shortCaller(file, line), message)
 	return message
 }
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// log levels, messages below configured minimum level are discarded
+const (
+	LevelDebug = "DEBUG"
+	LevelInfo  = "INFO"
+	LevelWarn  = "WARN"
+	LevelError = "ERROR"
+	LevelPanic = "PANIC"
+)
+
+// log formats
+const (
+	LogFormatLogfmt = "logfmt"
+	LogFormatJSON   = "json"
+)
+
+// keys of structured log fields used across migrator
+const (
+	FieldRequestID      = "requestId"
+	FieldTraceID        = "traceId"
+	FieldVersionName    = "versionName"
+	FieldTenant         = "tenant"
+	FieldSchema         = "schema"
+	FieldFile           = "file"
+	FieldDuration       = "duration"
+	FieldStatementIndex = "statementIndex"
+)
+
+const logTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+var levelSeverities = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3, LevelPanic: 4}
+
+// Field is a structured log field
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// logFieldsKey is used together with context for setting/getting log fields
+type logFieldsKey struct{}
+
+// WithFields returns context which fields are logged together with every message logged using it
+// a field overrides field with the same key already stored in context
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	existing, _ := ctx.Value(logFieldsKey{}).([]Field)
+	merged := make([]Field, 0, len(existing)+len(fields))
+	for _, f := range existing {
+		if !containsField(fields, f.Key) {
+			merged = append(merged, f)
+		}
+	}
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+func containsField(fields []Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// logger writes log entries in logfmt or JSON format, one entry per line
+type logger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	format   string
+	severity int
+}
+
+var std = &logger{out: os.Stderr, format: LogFormatLogfmt, severity: levelSeverities[LevelInfo]}
+
+// ConfigureLogger sets log format (logfmt or json) and minimum log level (debug, info, warn, error)
+// empty format defaults to logfmt and empty level defaults to info
+func ConfigureLogger(format, level string) error {
+	if format == "" {
+		format = LogFormatLogfmt
+	}
+	if format != LogFormatLogfmt && format != LogFormatJSON {
+		return fmt.Errorf("Unknown log format: %v", format)
+	}
+	if level == "" {
+		level = LevelInfo
+	}
+	severity, ok := levelSeverities[strings.ToUpper(level)]
+	if !ok || strings.ToUpper(level) == LevelPanic {
+		return fmt.Errorf("Unknown log level: %v", level)
+	}
+
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	std.format = format
+	std.severity = severity
+	return nil
+}
+
+func (l *logger) write(ctx context.Context, level, caller, message string) {
+	severity, ok := levelSeverities[level]
+	if !ok {
+		severity = levelSeverities[LevelInfo]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if severity < l.severity {
+		return
+	}
+
+	fields := []Field{{"time", time.Now().UTC().Format(logTimeFormat)}, {"level", level}, {"caller", caller}, {"msg", message}}
+	if ctx != nil {
+		if requestID := ctx.Value(RequestIDKey{}); requestID != nil {
+			fields = append(fields, Field{FieldRequestID, requestID})
+		}
+		contextFields, _ := ctx.Value(logFieldsKey{}).([]Field)
+		fields = append(fields, contextFields...)
+	}
+
+	var buf bytes.Buffer
+	if l.format == LogFormatJSON {
+		writeJSON(&buf, fields)
+	} else {
+		writeLogfmt(&buf, fields)
+	}
+	buf.WriteByte('\n')
+	l.out.Write(buf.Bytes())
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []Field) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		value := fmt.Sprintf("%v", f.Value)
+		if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, func(r rune) bool { return r < ' ' }) >= 0 {
+			value = strconv.Quote(value)
+		}
+		buf.WriteString(value)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, fields []Field) {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(jsonValue(f.Value))
+	}
+	buf.WriteByte('}')
+}
+
+// jsonValue marshals numbers and booleans as they are and all other values as strings
+// durations and errors have JSON representations which are not useful in logs
+func jsonValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		// NaN and infinities cannot be marshalled and are logged as strings
+		if raw, err := json.Marshal(v); err == nil {
+			return raw
+		}
+	}
+	raw, _ := json.Marshal(fmt.Sprintf("%v", value))
+	return raw
+}
+
+// shortCaller returns file with its parent directory and line, for example db/db.go:123
+func shortCaller(file string, line int) string {
+	dir, name := filepath.Split(file)
+	return fmt.Sprintf("%v:%v", filepath.Join(filepath.Base(dir), name), line)
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs redirects logger output to a buffer, returned func restores logger settings
+func captureLogs(t *testing.T, format, level string) (*bytes.Buffer, func()) {
+	var buf bytes.Buffer
+	out, previousFormat, previousSeverity := std.out, std.format, std.severity
+	std.out = &buf
+	assert.Nil(t, ConfigureLogger(format, level))
+	return &buf, func() {
+		std.out, std.format, std.severity = out, previousFormat, previousSeverity
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	buf, restore := captureLogs(t, "", "")
+	defer restore()
+
+	ctx := WithFields(newTestContext(), Field{FieldVersionName, "add users"}, Field{FieldFile, "source/001.sql"})
+	LogInfo(ctx, "Applied migration type: %d", 1)
+
+	line := buf.String()
+	assert.True(t, strings.HasSuffix(line, "\n"))
+	assert.Regexp(t, `^time=\S+ level=INFO caller=common/logger_test.go:\d+ msg="Applied migration type: 1" requestId=123 versionName="add users" file=source/001.sql\n$`, line)
+}
+
+func TestLoggerJSON(t *testing.T) {
+	buf, restore := captureLogs(t, LogFormatJSON, "info")
+	defer restore()
+
+	ctx := WithFields(newTestContext(), Field{FieldTenant, "abc"}, Field{FieldDuration, 1500 * time.Millisecond}, Field{"status", 200})
+	LogWarn(ctx, "quoted \"message\"")
+
+	entry := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "quoted \"message\"", entry["msg"])
+	assert.Equal(t, "123", entry[FieldRequestID])
+	assert.Equal(t, "abc", entry[FieldTenant])
+	assert.Equal(t, "1.5s", entry[FieldDuration])
+	assert.Equal(t, float64(200), entry["status"])
+	// fields are written in order
+	assert.True(t, strings.HasPrefix(buf.String(), `{"time":`))
+	assert.Contains(t, buf.String(), `"requestId":"123","tenant":"abc","duration":"1.5s","status":200}`)
+}
+
+func TestLoggerLevel(t *testing.T) {
+	buf, restore := captureLogs(t, LogFormatLogfmt, "WARN")
+	defer restore()
+
+	LogDebug(context.TODO(), "debug")
+	LogInfo(context.TODO(), "info")
+	assert.Equal(t, "", buf.String())
+
+	// messages are returned even when they are not logged
+	assert.Equal(t, "debug", LogDebug(context.TODO(), "debug"))
+
+	LogError(context.TODO(), "error")
+	LogPanic(context.TODO(), "panic")
+	Log(LevelWarn, "warn")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "level=ERROR")
+	assert.Contains(t, lines[1], "level=PANIC")
+	assert.Contains(t, lines[2], "level=WARN")
+	assert.NotContains(t, lines[2], FieldRequestID)
+}
+
+func TestWithFieldsOverride(t *testing.T) {
+	buf, restore := captureLogs(t, "", "")
+	defer restore()
+
+	ctx := WithFields(context.TODO(), Field{FieldSchema, "public"}, Field{FieldFile, "a.sql"})
+	child := WithFields(ctx, Field{FieldFile, "b.sql"})
+	LogInfo(child, "child")
+	LogInfo(ctx, "parent")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.True(t, strings.HasSuffix(lines[0], "msg=child schema=public file=b.sql"))
+	assert.True(t, strings.HasSuffix(lines[1], "msg=parent schema=public file=a.sql"))
+}
+
+func TestConfigureLoggerErrors(t *testing.T) {
+	_, restore := captureLogs(t, "", "")
+	defer restore()
+
+	assert.Equal(t, "Unknown log format: xml", ConfigureLogger("xml", "").Error())
+	assert.Equal(t, "Unknown log level: trace", ConfigureLogger("", "trace").Error())
+	assert.Equal(t, "Unknown log level: panic", ConfigureLogger("", "panic").Error())
+}
+
+func TestWriteLogfmtQuoting(t *testing.T) {
+	var buf bytes.Buffer
+	writeLogfmt(&buf, []Field{{"a", ""}, {"b", "x=y"}, {"c", "line\nbreak"}, {"d", `back\slash`}, {"e", "plain"}})
+	assert.Equal(t, `a="" b="x=y" c="line\nbreak" d="back\\slash" e=plain`, buf.String())
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/notifications"
 	"github.com/lukaszbudnik/migrator/types"
 )
@@ -24,23 +25,28 @@ type SourceMigrationFilters struct {
 
 // Coordinator interface abstracts all operations performed by migrator
 type Coordinator interface {
-	GetTenants() []types.Tenant
-	GetVersions() []types.Version
-	GetVersionsByFile(string) []types.Version
+	GetTenants() ([]types.Tenant, error)
+	GetVersions() ([]types.Version, error)
+	GetVersionsByFile(string) ([]types.Version, error)
 	GetVersionByID(int32) (*types.Version, error)
 	GetDBMigrationByID(int32) (*types.DBMigration, error)
-	GetSourceMigrations(*SourceMigrationFilters) []types.Migration
+	GetSourceMigrations(*SourceMigrationFilters) ([]types.Migration, error)
 	GetSourceMigrationByFile(string) (*types.Migration, error)
 	// deprecated in v2020.1.0 sunset in v2021.1.0
 	// Version now contains slice of DBMigration
-	GetAppliedMigrations() []types.MigrationDB
-	VerifySourceMigrationsCheckSums() (bool, []types.Migration)
+	GetAppliedMigrations() ([]types.MigrationDB, error)
+	VerifySourceMigrationsCheckSums() error
+	VerifySourceMigrations() (*types.Verification, error)
 	// Deprecated, uses CreateVersion under the hood
-	ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration)
+	ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration, error)
 	// Deprecated, uses CreateTenant under the hood
-	AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration)
-	CreateVersion(string, types.Action, bool) *types.CreateResults
-	CreateTenant(string, types.Action, bool, string) *types.CreateResults
+	AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration, error)
+	CreateVersion(string, types.Action, bool) (*types.CreateResults, error)
+	CreateTenant(string, types.Action, bool, string) (*types.CreateResults, error)
+	RevertVersion(int32, bool) (*types.CreateResults, error)
+	ImportHistory(types.HistoryTool, string, string, bool) (*types.ImportResults, error)
+	RepairChecksums([]string, string, string) (*types.RepairResults, error)
+	Plan() (*types.Plan, error)
 	Dispose()
 }
 
@@ -71,15 +77,15 @@ func New(ctx context.Context, config *config.Config, newConnector db.Factory, ne
 	return coordinator
 }
 
-func (c *coordinator) GetTenants() []types.Tenant {
+func (c *coordinator) GetTenants() ([]types.Tenant, error) {
 	return c.connector.GetTenants()
 }
 
-func (c *coordinator) GetVersions() []types.Version {
+func (c *coordinator) GetVersions() ([]types.Version, error) {
 	return c.connector.GetVersions()
 }
 
-func (c *coordinator) GetVersionsByFile(file string) []types.Version {
+func (c *coordinator) GetVersionsByFile(file string) ([]types.Version, error) {
 	return c.connector.GetVersionsByFile(file)
 }
 
@@ -87,14 +93,20 @@ func (c *coordinator) GetVersionByID(ID int32) (*types.Version, error) {
 	return c.connector.GetVersionByID(ID)
 }
 
-func (c *coordinator) GetSourceMigrations(filters *SourceMigrationFilters) []types.Migration {
-	allSourceMigrations := c.loader.GetSourceMigrations()
+func (c *coordinator) GetSourceMigrations(filters *SourceMigrationFilters) ([]types.Migration, error) {
+	allSourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
 	filteredMigrations := c.filterMigrations(allSourceMigrations, filters)
-	return filteredMigrations
+	return filteredMigrations, nil
 }
 
 func (c *coordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
-	allSourceMigrations := c.loader.GetSourceMigrations()
+	allSourceMigrations, err := c.loader.GetSourceMigrations()
+	if err != nil {
+		return nil, err
+	}
 	filters := SourceMigrationFilters{
 		File: &file,
 	}
@@ -109,38 +121,68 @@ func (c *coordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
 	return c.connector.GetDBMigrationByID(ID)
 }
 
-func (c *coordinator) GetAppliedMigrations() []types.MigrationDB {
+func (c *coordinator) GetAppliedMigrations() ([]types.MigrationDB, error) {
 	return c.connector.GetAppliedMigrations()
 }
 
+// getSourceAndAppliedMigrations returns all source migrations and all applied DB migrations
+func (c *coordinator) getSourceAndAppliedMigrations() ([]types.Migration, []types.MigrationDB, error) {
+	sourceMigrations, err := c.GetSourceMigrations(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	appliedMigrations, err := c.GetAppliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sourceMigrations, appliedMigrations, nil
+}
+
 // VerifySourceMigrationsCheckSums verifies if CheckSum of source and applied DB migrations match
 // VerifySourceMigrationsCheckSums allows CheckSum of scripts to be different (they are applied every time and are often updated)
-// returns bool indicating if offending (i.e., modified) disk migrations were found
-// if bool is false the function returns a slice of offending migrations
-// if bool is true the slice of effending migrations is empty
-func (c *coordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+// returns ErrChecksumMismatch with offending (i.e., modified) migrations when checksums do not match
+func (c *coordinator) VerifySourceMigrationsCheckSums() error {
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return err
+	}
 
-	flattenedAppliedMigration := c.flattenAppliedMigrations(appliedMigrations)
+	offendingMigrations := c.modifiedMigrations(sourceMigrations, c.flattenAppliedMigrations(appliedMigrations))
+	metrics.SetModifiedMigrations(len(offendingMigrations))
+	if len(offendingMigrations) > 0 {
+		return &ErrChecksumMismatch{Migrations: offendingMigrations}
+	}
+	return nil
+}
 
-	intersect := c.intersect(sourceMigrations, flattenedAppliedMigration)
+// VerifySourceMigrations verifies source migrations against applied DB migrations
+// in addition to checksums it reports out-of-order pending migrations and applied migrations missing from source
+// out-of-order and missing migrations fail verification only when fail verification policy is set
+func (c *coordinator) VerifySourceMigrations() (*types.Verification, error) {
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	flattenedAppliedMigrations := c.flattenAppliedMigrations(appliedMigrations)
 
-	var offendingMigrations []types.Migration
-	var result = true
-	for _, t := range intersect {
-		if t.source.MigrationType == types.MigrationTypeSingleScript || t.source.MigrationType == types.MigrationTypeTenantScript {
-			continue
-		}
-		if t.source.CheckSum != t.applied.CheckSum {
-			offendingMigrations = append(offendingMigrations, t.source)
-			result = false
-		}
+	verification := &types.Verification{
+		ModifiedMigrations:   c.modifiedMigrations(sourceMigrations, flattenedAppliedMigrations),
+		OutOfOrderMigrations: c.outOfOrderMigrations(sourceMigrations, flattenedAppliedMigrations),
+		MissingMigrations:    c.missingMigrations(sourceMigrations, flattenedAppliedMigrations),
+	}
+	if verification.ModifiedMigrations == nil {
+		verification.ModifiedMigrations = []types.Migration{}
 	}
-	return result, offendingMigrations
+	verification.Verified = len(verification.ModifiedMigrations) == 0
+	if c.getVerificationPolicy() == config.VerificationPolicyFail && (len(verification.OutOfOrderMigrations) > 0 || len(verification.MissingMigrations) > 0) {
+		verification.Verified = false
+	}
+
+	metrics.SetModifiedMigrations(len(verification.ModifiedMigrations))
+	return verification, nil
 }
 
-func (c *coordinator) ApplyMigrations(mode types.MigrationsModeType) (*types.MigrationResults, []types.Migration) {
+func (c *coordinator) ApplyMigrations(mode types.MigrationsModeType) (*types.MigrationResults, []types.Migration, error) {
 
 	// convert to new API params
 	versionName := "API v1 ApplyMigrations"
@@ -152,34 +194,73 @@ func (c *coordinator) ApplyMigrations(mode types.MigrationsModeType) (*types.Mig
 		action = types.ActionSync
 	}
 
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
 
-	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
-	common.LogInfo(c.ctx, "Found migrations to apply: %d", len(migrationsToApply))
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	results, _ := c.connector.CreateVersion(versionName, action, dryRun, migrationsToApply)
+	migrationsToApply, err := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
+	if err != nil {
+		return nil, nil, err
+	}
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}), "Found migrations to apply: %d", len(migrationsToApply))
+
+	if err := c.checkVerificationPolicy(action, sourceMigrations, appliedMigrations); err != nil {
+		return nil, nil, err
+	}
 
+	results, version, err := c.connector.CreateVersion(versionName, c.loader.GetCommitSha(), action, dryRun, migrationsToApply)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.recordVersion(action.String(), dryRun, results, version)
 	c.sendNotification(results)
 
-	return results, migrationsToApply
+	return results, migrationsToApply, nil
 }
 
-func (c *coordinator) CreateVersion(versionName string, action types.Action, dryRun bool) *types.CreateResults {
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+func (c *coordinator) CreateVersion(versionName string, action types.Action, dryRun bool) (*types.CreateResults, error) {
+	// migrator lock must be acquired before computing migrations to apply
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
-	common.LogInfo(c.ctx, "Found migrations to apply: %d", len(migrationsToApply))
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
 
-	summary, version := c.connector.CreateVersion(versionName, action, dryRun, migrationsToApply)
+	migrationsToApply, err := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}), "Found migrations to apply: %d", len(migrationsToApply))
 
+	if err := c.checkVerificationPolicy(action, sourceMigrations, appliedMigrations); err != nil {
+		return nil, err
+	}
+
+	summary, version, err := c.connector.CreateVersion(versionName, c.loader.GetCommitSha(), action, dryRun, migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordVersion(action.String(), dryRun, summary, version)
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
 }
 
-func (c *coordinator) AddTenantAndApplyMigrations(mode types.MigrationsModeType, tenant string) (*types.MigrationResults, []types.Migration) {
+func (c *coordinator) AddTenantAndApplyMigrations(mode types.MigrationsModeType, tenant string) (*types.MigrationResults, []types.Migration, error) {
 	// convert to new API params
 	versionName := "API v1 AddTenantAndApplyMigrations"
 	action := types.ActionApply
@@ -190,31 +271,116 @@ func (c *coordinator) AddTenantAndApplyMigrations(mode types.MigrationsModeType,
 		action = types.ActionSync
 	}
 
-	sourceMigrations := c.GetSourceMigrations(nil)
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	sourceMigrations, err := c.GetSourceMigrations(nil)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// filter only tenant schemas
 	migrationsToApply := c.filterTenantMigrations(sourceMigrations)
-	common.LogInfo(c.ctx, "Migrations to apply for new tenant: %d", len(migrationsToApply))
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}, common.Field{Key: common.FieldTenant, Value: tenant}), "Migrations to apply for new tenant: %d", len(migrationsToApply))
 
-	summary, _ := c.connector.CreateTenant(versionName, action, dryRun, tenant, migrationsToApply)
+	summary, version, err := c.connector.CreateTenant(versionName, c.loader.GetCommitSha(), action, dryRun, tenant, migrationsToApply)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	c.recordVersion(action.String(), dryRun, summary, version)
 	c.sendNotification(summary)
 
-	return summary, migrationsToApply
+	return summary, migrationsToApply, nil
 }
 
-func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string) *types.CreateResults {
-	sourceMigrations := c.GetSourceMigrations(nil)
+func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sourceMigrations, err := c.GetSourceMigrations(nil)
+	if err != nil {
+		return nil, err
+	}
 
 	// filter only tenant schemas
 	migrationsToApply := c.filterTenantMigrations(sourceMigrations)
-	common.LogInfo(c.ctx, "Migrations to apply for new tenant: %d", len(migrationsToApply))
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}, common.Field{Key: common.FieldTenant, Value: tenant}), "Migrations to apply for new tenant: %d", len(migrationsToApply))
 
-	summary, version := c.connector.CreateTenant(versionName, action, dryRun, tenant, migrationsToApply)
+	summary, version, err := c.connector.CreateTenant(versionName, c.loader.GetCommitSha(), action, dryRun, tenant, migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
 
+	c.recordVersion(action.String(), dryRun, summary, version)
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// RevertVersion reverts all migrations applied in a given version using their down migrations
+// scripts are not reverted, if any of the migrations does not have a down migration the whole revert is rejected
+func (c *coordinator) RevertVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	version, err := c.connector.GetVersionByID(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsToRevert := 0
+	for _, m := range version.DBMigrations {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+		if m.DownContents == "" {
+			return nil, fmt.Errorf("Down migration not found for migration: %v", m.File)
+		}
+		migrationsToRevert++
+	}
+
+	if migrationsToRevert == 0 {
+		return nil, fmt.Errorf("Version has no migrations to revert ID: %v", ID)
+	}
+
+	versionName := fmt.Sprintf("Revert version %v: %v", version.ID, version.Name)
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}), "Found migrations to revert: %d", migrationsToRevert)
+	summary, revertVersion, err := c.connector.RevertVersion(versionName, dryRun, version)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordVersion("Revert", dryRun, summary, revertVersion)
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: revertVersion}, nil
+}
+
+// Plan returns migrations which would be applied by CreateVersion together with schemas and SQL executed in every schema
+// plan does not acquire migrator lock and does not execute any migration
+func (c *coordinator) Plan() (*types.Plan, error) {
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsToApply, err := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Found migrations to apply: %d", len(migrationsToApply))
+
+	return c.connector.PlanMigrations(migrationsToApply)
 }
 
 func (c *coordinator) Dispose() {
@@ -278,14 +444,65 @@ func (c *coordinator) difference(sourceMigrations []types.Migration, flattenedAp
 }
 
 // computeMigrationsToApply computes which source migrations should be applied to DB based on migrations already present in DB
-func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.MigrationDB) []types.Migration {
+func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.MigrationDB) ([]types.Migration, error) {
 	flattenedAppliedMigrations := c.flattenAppliedMigrations(appliedMigrations)
 
 	len := len(flattenedAppliedMigrations)
 	common.LogInfo(c.ctx, "Number of flattened DB migrations: %d", len)
 
 	out := c.difference(sourceMigrations, flattenedAppliedMigrations)
-	return out
+
+	// with per-tenant and per-migration transaction strategies some tenants may have failed
+	// tenant migrations which are not applied to all tenants are applied again
+	// connector skips tenants for which a given migration was already applied
+	if c.config != nil && c.config.TransactionStrategy != "" && c.config.TransactionStrategy != config.TransactionStrategySingle {
+		return c.withFailedTenantMigrations(sourceMigrations, appliedMigrations, out)
+	}
+
+	return out, nil
+}
+
+// withFailedTenantMigrations adds to migrations tenant migrations which were applied only to some of the tenants
+// the source migrations order is preserved
+func (c *coordinator) withFailedTenantMigrations(sourceMigrations []types.Migration, appliedMigrations []types.MigrationDB, migrations []types.Migration) ([]types.Migration, error) {
+	tenants, err := c.connector.GetTenants()
+	if err != nil {
+		return nil, err
+	}
+
+	// key is Migration.File
+	appliedTenants := map[string]map[string]bool{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		if appliedTenants[m.File] == nil {
+			appliedTenants[m.File] = map[string]bool{}
+		}
+		appliedTenants[m.File][m.Schema] = true
+	}
+
+	include := map[string]bool{}
+	for _, m := range migrations {
+		include[m.File] = true
+	}
+	for file, schemas := range appliedTenants {
+		for _, t := range tenants {
+			if !schemas[t.Name] {
+				common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldFile, Value: file}, common.Field{Key: common.FieldTenant, Value: t.Name}), "Tenant migration not applied to tenant, retrying")
+				include[file] = true
+				break
+			}
+		}
+	}
+
+	out := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if include[m.File] {
+			out = append(out, m)
+		}
+	}
+	return out, nil
 }
 
 // filterTenantMigrations returns only migrations which are of type MigrationTypeTenantSchema
@@ -300,13 +517,21 @@ func (c *coordinator) filterTenantMigrations(sourceMigrations []types.Migration)
 	return filteredTenantMigrations
 }
 
+// recordVersion updates metrics, versions created in dry-run mode are rolled back and are not recorded
+func (c *coordinator) recordVersion(action string, dryRun bool, results *types.MigrationResults, version *types.Version) {
+	if dryRun || version == nil {
+		return
+	}
+	metrics.VersionCreated(action, results)
+}
+
 // errors are silently discarded, adding tenant or applying migrations
 // must not fail because of notification error
 func (c *coordinator) sendNotification(results *types.MigrationResults) {
 	bytes, _ := json.Marshal(results)
 	text := string(bytes)
 	if resp, err := c.notifier.Notify(text); err != nil {
-		common.LogError(c.ctx, "Notifier error: %v", err.Error())
+		common.LogWarn(c.ctx, "Notifier error: %v", err.Error())
 	} else {
 		common.LogInfo(c.ctx, "Notifier response: %v", resp)
 	}
@@ -17,7 +17,7 @@ import (
 type mockedDiskLoader struct {
 }
 
-func (m *mockedDiskLoader) GetSourceMigrations() []types.Migration {
+func (m *mockedDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	// 5 migrations in total
 	// 4 migrations with type MigrationTypeSingleMigration
 	// 3 migrations with sourceDir source and type MigrationTypeSingleMigration
@@ -29,7 +29,15 @@ func (m *mockedDiskLoader) GetSourceMigrations() []types.Migration {
 	m3 := types.Migration{Name: "201602220001.sql", SourceDir: "config", File: "config/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 	m4 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 	m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
-	return []types.Migration{m1, m2, m3, m4, m5}
+	return []types.Migration{m1, m2, m3, m4, m5}, nil
+}
+
+func (m *mockedDiskLoader) HealthCheck() error {
+	return nil
+}
+
+func (m *mockedDiskLoader) GetCommitSha() string {
+	return "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
 }
 
 func newMockedDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
@@ -56,11 +64,12 @@ func newErrorMockedNotifier(_ context.Context, _ *config.Config) notifications.N
 }
 
 type mockedBrokenCheckSumDiskLoader struct {
+	mockedDiskLoader
 }
 
-func (m *mockedBrokenCheckSumDiskLoader) GetSourceMigrations() []types.Migration {
+func (m *mockedBrokenCheckSumDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "xxx"}
-	return []types.Migration{m1}
+	return []types.Migration{m1}, nil
 }
 
 func newBrokenCheckSumMockedDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
@@ -68,53 +77,110 @@ func newBrokenCheckSumMockedDiskLoader(_ context.Context, _ *config.Config) load
 }
 
 type mockedDifferentScriptCheckSumMockedDiskLoader struct {
+	mockedDiskLoader
 }
 
-func (m *mockedDifferentScriptCheckSumMockedDiskLoader) GetSourceMigrations() []types.Migration {
+func (m *mockedDifferentScriptCheckSumMockedDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	m2 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc", CheckSum: "sha256-1"}
-	return []types.Migration{m1, m2}
+	return []types.Migration{m1, m2}, nil
 }
 
 func newDifferentScriptCheckSumMockedDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
 	return new(mockedDifferentScriptCheckSumMockedDiskLoader)
 }
 
+type mockedFlywayDiskLoader struct {
+	mockedDiskLoader
+}
+
+func (m *mockedFlywayDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
+	m1 := types.Migration{Name: "V1__init.sql", SourceDir: "source", File: "source/V1__init.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc\n"}
+	m2 := types.Migration{Name: "V1.1__users.sql", SourceDir: "source", File: "source/V1.1__users.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table users"}
+	m3 := types.Migration{Name: "V2__tenants.sql", SourceDir: "tenant", File: "tenant/V2__tenants.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def"}
+	m4 := types.Migration{Name: "V2_1__config.sql", SourceDir: "config", File: "config/V2_1__config.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table config"}
+	m5 := types.Migration{Name: "R__views.sql", SourceDir: "source-scripts", File: "source-scripts/R__views.sql", MigrationType: types.MigrationTypeSingleScript, Contents: "create view abc"}
+	return []types.Migration{m1, m2, m3, m4, m5}, nil
+}
+
+func newMockedFlywayDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
+	return new(mockedFlywayDiskLoader)
+}
+
 type mockedConnector struct {
 }
 
 func (m *mockedConnector) Dispose() {
 }
 
-func (m *mockedConnector) CreateTenant(string, types.Action, bool, string, []types.Migration) (*types.MigrationResults, *types.Version) {
-	return &types.MigrationResults{}, &types.Version{}
+func (m *mockedConnector) CreateTenant(_ string, commitSha string, _ types.Action, _ bool, _ string, _ []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	return &types.MigrationResults{}, &types.Version{CommitSha: commitSha}, nil
+}
+
+func (m *mockedConnector) CreateVersion(_ string, commitSha string, _ types.Action, _ bool, _ []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	return &types.MigrationResults{}, &types.Version{CommitSha: commitSha}, nil
 }
 
-func (m *mockedConnector) CreateVersion(string, types.Action, bool, []types.Migration) (*types.MigrationResults, *types.Version) {
-	return &types.MigrationResults{}, &types.Version{}
+func (m *mockedConnector) PlanMigrations(migrations []types.Migration) (*types.Plan, error) {
+	plan := &types.Plan{Tenants: 3, Migrations: []types.PlannedMigration{}}
+	for _, m := range migrations {
+		plan.Migrations = append(plan.Migrations, types.PlannedMigration{Migration: m, Schemas: []types.PlannedSchema{{Schema: "a", SQL: m.Contents}}})
+	}
+	return plan, nil
+}
+
+func (m *mockedConnector) GetHistoryEntries(tool types.HistoryTool, table string) ([]types.HistoryEntry, error) {
+	if tool == types.HistoryToolLiquibase {
+		e1 := types.HistoryEntry{Version: "1", Description: "lukasz", Script: "db/source/201602220000.sql", CheckSum: "8:xyz", Type: "EXECUTED", Success: true}
+		e2 := types.HistoryEntry{Version: "2", Description: "lukasz", Script: "db/source/201602220001.sql", CheckSum: "8:xyz", Type: "EXECUTED", Success: true}
+		e3 := types.HistoryEntry{Version: "3", Description: "lukasz", Script: "db/tenant/201602220003.sql", CheckSum: "8:xyz", Type: "FAILED", Success: false}
+		e4 := types.HistoryEntry{Version: "4", Description: "lukasz", Script: "db/legacy/201501010000.sql", CheckSum: "8:xyz", Type: "MARK_RAN", Success: true}
+		return []types.HistoryEntry{e1, e2, e3, e4}, nil
+	}
+	// checksums are CRC32 of lines as computed by Flyway
+	e1 := types.HistoryEntry{Version: "", Description: "<< Flyway Schema Creation >>", Script: "\"source\"", Type: "SCHEMA", Success: true}
+	e2 := types.HistoryEntry{Version: "1", Description: "init", Script: "V1__init.sql", CheckSum: "703928161", Type: "SQL", Success: true}
+	e3 := types.HistoryEntry{Version: "1.1", Description: "users", Script: "V1.1__users.sql", CheckSum: "123", Type: "SQL", Success: true}
+	e4 := types.HistoryEntry{Version: "2.0", Description: "tenants", Script: "tenant/V2__tenants.sql", CheckSum: "-1601282348", Type: "SQL", Success: true}
+	e5 := types.HistoryEntry{Version: "3", Description: "removed", Script: "V3__removed.sql", CheckSum: "1", Type: "SQL", Success: true}
+	e6 := types.HistoryEntry{Version: "", Description: "views", Script: "R__views.sql", CheckSum: "1", Type: "SQL", Success: true}
+	e7 := types.HistoryEntry{Version: "2.1", Description: "config", Script: "V2_1__config.sql", CheckSum: "1", Type: "SQL", Success: false}
+	return []types.HistoryEntry{e1, e2, e3, e4, e5, e6, e7}, nil
+}
+
+func (m *mockedConnector) Lock() (func(), error) {
+	return func() {}, nil
+}
+
+func (m *mockedConnector) RevertVersion(versionName string, _ bool, version *types.Version) (*types.MigrationResults, *types.Version, error) {
+	return &types.MigrationResults{}, &types.Version{ID: version.ID + 1, Name: versionName}, nil
+}
+
+func (m *mockedConnector) RepairChecksums(versionName, commitSha string, migrations []types.Migration) (*types.Version, error) {
+	return &types.Version{ID: 13, Name: versionName, CommitSha: commitSha}, nil
 }
 
 func (m *mockedConnector) AddTenantAndApplyMigrations(types.MigrationsModeType, string, []types.Migration) *types.MigrationResults {
 	return &types.MigrationResults{}
 }
 
-func (m *mockedConnector) GetTenants() []types.Tenant {
+func (m *mockedConnector) GetTenants() ([]types.Tenant, error) {
 	a := types.Tenant{Name: "a"}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
-	return []types.Tenant{a, b, c}
+	return []types.Tenant{a, b, c}, nil
 }
 
-func (m *mockedConnector) GetVersions() []types.Version {
+func (m *mockedConnector) GetVersions() ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
 	b := types.Version{ID: 121, Name: "bb", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -1)}}
 	c := types.Version{ID: 122, Name: "ccc", Created: graphql.Time{Time: time.Now()}}
-	return []types.Version{a, b, c}
+	return []types.Version{a, b, c}, nil
 }
 
-func (m *mockedConnector) GetVersionsByFile(file string) []types.Version {
+func (m *mockedConnector) GetVersionsByFile(file string) ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
-	return []types.Version{a}
+	return []types.Version{a}, nil
 }
 
 func (m *mockedConnector) GetVersionByID(ID int32) (*types.Version, error) {
@@ -122,11 +188,11 @@ func (m *mockedConnector) GetVersionByID(ID int32) (*types.Version, error) {
 	return &a, nil
 }
 
-func (m *mockedConnector) GetAppliedMigrations() []types.MigrationDB {
+func (m *mockedConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
 	ms := []types.MigrationDB{{Migration: m1, Schema: "source", AppliedAt: graphql.Time{Time: d1}}}
-	return ms
+	return ms, nil
 }
 
 func (m *mockedConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
@@ -148,15 +214,94 @@ type mockedDifferentScriptCheckSumMockedConnector struct {
 	mockedConnector
 }
 
-func (m *mockedDifferentScriptCheckSumMockedConnector) GetAppliedMigrations() []types.MigrationDB {
+func (m *mockedDifferentScriptCheckSumMockedConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
 	m2 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc", CheckSum: "sha256-2"}
 	d2 := time.Date(2016, 02, 22, 16, 41, 1, 456, time.UTC)
 	ms := []types.MigrationDB{{Migration: m1, Schema: "source", AppliedAt: graphql.Time{Time: d1}}, {Migration: m2, Schema: "customer1", AppliedAt: graphql.Time{Time: d2}}}
-	return ms
+	return ms, nil
 }
 
 func newDifferentScriptCheckSumMockedConnector(context.Context, *config.Config) db.Connector {
 	return &mockedDifferentScriptCheckSumMockedConnector{mockedConnector{}}
 }
+
+type mockedVerificationConnector struct {
+	mockedConnector
+}
+
+func (m *mockedVerificationConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
+	// source/201602220000.sql is ordered before applied source/201602220001.sql and is out-of-order
+	// source/201501010000.sql was removed from source, down migrations and scripts are not reported as missing
+	m1 := types.Migration{Name: "201501010000.sql", SourceDir: "source", File: "source/201501010000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "source", File: "source/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	m3 := types.Migration{Name: "201602220002.down.sql", SourceDir: "source", File: "source/201602220002.down.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	m4 := types.Migration{Name: "cleanup.sql", SourceDir: "source-scripts", File: "source-scripts/cleanup.sql", MigrationType: types.MigrationTypeSingleScript, Contents: "select def"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return []types.MigrationDB{{Migration: m1, Schema: "source", AppliedAt: graphql.Time{Time: d1}}, {Migration: m2, Schema: "source", AppliedAt: graphql.Time{Time: d1}}, {Migration: m3, Schema: "source", AppliedAt: graphql.Time{Time: d1}}, {Migration: m4, Schema: "source", AppliedAt: graphql.Time{Time: d1}}}, nil
+}
+
+func newMockedVerificationConnector(context.Context, *config.Config) db.Connector {
+	return &mockedVerificationConnector{mockedConnector{}}
+}
+
+type mockedRevertConnector struct {
+	mockedConnector
+}
+
+func (m *mockedRevertConnector) GetVersionByID(ID int32) (*types.Version, error) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc", DownContents: "drop table abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def"}
+	// migration without down migration is only added to version with ID 2
+	dbMigrations := []types.DBMigration{{Migration: m1, ID: 1, Schema: "source"}}
+	if ID == 2 {
+		dbMigrations = append(dbMigrations, types.DBMigration{Migration: m2, ID: 2, Schema: "abc"})
+	}
+	a := types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}, DBMigrations: dbMigrations}
+	return &a, nil
+}
+
+func newMockedRevertConnector(context.Context, *config.Config) db.Connector {
+	return &mockedRevertConnector{mockedConnector{}}
+}
+
+type mockedLockedConnector struct {
+	mockedConnector
+}
+
+func (m *mockedLockedConnector) Lock() (func(), error) {
+	return nil, db.ErrMigrationInProgress
+}
+
+func newMockedLockedConnector(context.Context, *config.Config) db.Connector {
+	return &mockedLockedConnector{mockedConnector{}}
+}
+
+type mockedErrorConnector struct {
+	mockedConnector
+}
+
+func (m *mockedErrorConnector) CreateVersion(_ string, _ string, _ types.Action, _ bool, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	return nil, nil, &db.ErrMigrationFailed{File: migrations[0].File, Schema: "source", Cause: errors.New("trouble maker")}
+}
+
+func (m *mockedErrorConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
+	return []types.MigrationDB{}, nil
+}
+
+func newMockedErrorConnector(context.Context, *config.Config) db.Connector {
+	return &mockedErrorConnector{mockedConnector{}}
+}
+
+type mockedErrorDiskLoader struct {
+	mockedDiskLoader
+}
+
+func (m *mockedErrorDiskLoader) GetSourceMigrations() ([]types.Migration, error) {
+	return nil, &loader.ErrLoadFailed{BaseLocation: "/tmp/migrations", Cause: errors.New("no such file or directory")}
+}
+
+func newMockedErrorDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
+	return new(mockedErrorDiskLoader)
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/graph-gophers/graphql-go"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/loader"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -101,7 +104,8 @@ func TestComputeMigrationsToApply(t *testing.T) {
 		loader:    newMockedDiskLoader(context.TODO(), nil),
 		notifier:  newMockedNotifier(context.TODO(), nil),
 	}
-	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	migrations, err := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	assert.Nil(t, err)
 
 	// that should be 5 now...
 	assert.Len(t, migrations, 5)
@@ -145,7 +149,8 @@ func TestComputeMigrationsToApplyDifferentTimestamps(t *testing.T) {
 		loader:    newMockedDiskLoader(context.TODO(), nil),
 		notifier:  newMockedNotifier(context.TODO(), nil),
 	}
-	migrations := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	migrations, err := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 3)
 
@@ -154,6 +159,38 @@ func TestComputeMigrationsToApplyDifferentTimestamps(t *testing.T) {
 	assert.Equal(t, dev1p2.File, migrations[2].File)
 }
 
+func TestComputeMigrationsToApplyRetryFailedTenants(t *testing.T) {
+	mdef1 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
+	mdef2 := types.Migration{Name: "20181112", SourceDir: "tenants", File: "tenants/20181112", MigrationType: types.MigrationTypeTenantMigration}
+	mdef3 := types.Migration{Name: "20181113", SourceDir: "public", File: "public/20181113", MigrationType: types.MigrationTypeSingleMigration}
+
+	diskMigrations := []types.Migration{mdef1, mdef2, mdef3}
+	// mocked connector returns tenants a, b, c and mdef2 failed for tenant c
+	dbMigrations := []types.MigrationDB{{Migration: mdef1, Schema: "a"}, {Migration: mdef1, Schema: "b"}, {Migration: mdef1, Schema: "c"}, {Migration: mdef2, Schema: "a"}, {Migration: mdef2, Schema: "b"}}
+
+	coordinator := &coordinator{
+		ctx:       context.TODO(),
+		connector: newMockedConnector(context.TODO(), nil),
+		loader:    newMockedDiskLoader(context.TODO(), nil),
+		notifier:  newMockedNotifier(context.TODO(), nil),
+		config:    &config.Config{TransactionStrategy: config.TransactionStrategyPerTenant},
+	}
+	migrations, err := coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, mdef2.File, migrations[0].File)
+	assert.Equal(t, mdef3.File, migrations[1].File)
+
+	// single transaction strategy does not retry
+	coordinator.config.TransactionStrategy = config.TransactionStrategySingle
+	migrations, err = coordinator.computeMigrationsToApply(diskMigrations, dbMigrations)
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 1)
+	assert.Equal(t, mdef3.File, migrations[0].File)
+}
+
 func TestFilterTenantMigrations(t *testing.T) {
 	mdef1 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
 	mdef2 := types.Migration{Name: "20181111", SourceDir: "public", File: "public/20181111", MigrationType: types.MigrationTypeSingleMigration}
@@ -218,48 +255,68 @@ func TestIntersect(t *testing.T) {
 func TestVerifySourceMigrationsCheckSumsOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
-	assert.True(t, verified)
-	assert.Empty(t, offendingMigrations)
+	err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.Nil(t, err)
 }
 
 func TestVerifySourceMigrationsCheckSumsKO(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
-	assert.False(t, verified)
-	assert.Equal(t, coordinator.GetSourceMigrations(nil)[0], offendingMigrations[0])
+	err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.IsType(t, &ErrChecksumMismatch{}, err)
+	assert.Equal(t, "Checksum verification failed. Please review offending migrations.", err.Error())
+	sourceMigrations, _ := coordinator.GetSourceMigrations(nil)
+	assert.Equal(t, sourceMigrations, err.(*ErrChecksumMismatch).Migrations)
 }
 
 func TestVerifySourceMigrationsAndScriptsCheckSumsOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newDifferentScriptCheckSumMockedConnector, newDifferentScriptCheckSumMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	verified, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums()
-	assert.True(t, verified)
-	assert.Empty(t, offendingMigrations)
+	err := coordinator.VerifySourceMigrationsCheckSums()
+	assert.Nil(t, err)
+}
+
+func TestPlan(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	plan, err := coordinator.Plan()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), plan.Tenants)
+	assert.Len(t, plan.Migrations, 4)
+	// first source migration is already applied so getting the 2nd one
+	sourceMigrations, err := coordinator.GetSourceMigrations(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, sourceMigrations[1], plan.Migrations[0].Migration)
 }
 
 func TestApplyMigrations(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	_, appliedMigrations := coordinator.ApplyMigrations(types.ModeTypeApply)
+	_, appliedMigrations, err := coordinator.ApplyMigrations(types.ModeTypeApply)
+	assert.Nil(t, err)
 	assert.Len(t, appliedMigrations, 4)
 	// first source migration is already applied so getting the 2nd one
-	assert.Equal(t, coordinator.GetSourceMigrations(nil)[1], appliedMigrations[0])
+	sourceMigrations, err := coordinator.GetSourceMigrations(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, sourceMigrations[1], appliedMigrations[0])
 }
 
 func TestAddTenantAndApplyMigrations(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	_, appliedMigrations := coordinator.AddTenantAndApplyMigrations(types.ModeTypeApply, "new")
+	_, appliedMigrations, err := coordinator.AddTenantAndApplyMigrations(types.ModeTypeApply, "new")
+	assert.Nil(t, err)
 	assert.Len(t, appliedMigrations, 1)
-	assert.Equal(t, coordinator.GetSourceMigrations(nil)[4], appliedMigrations[0])
+	sourceMigrations, err := coordinator.GetSourceMigrations(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, sourceMigrations[4], appliedMigrations[0])
 }
 
 func TestGetTenants(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	tenants := coordinator.GetTenants()
+	tenants, err := coordinator.GetTenants()
+	assert.Nil(t, err)
 	a := types.Tenant{Name: "a"}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
@@ -269,7 +326,8 @@ func TestGetTenants(t *testing.T) {
 func TestGetVersions(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	versions := coordinator.GetVersions()
+	versions, err := coordinator.GetVersions()
+	assert.Nil(t, err)
 
 	assert.Equal(t, int32(12), versions[0].ID)
 	assert.Equal(t, int32(121), versions[1].ID)
@@ -287,7 +345,8 @@ func TestGetVersionByID(t *testing.T) {
 func TestGetVersionsByFile(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
-	versions := coordinator.GetVersionsByFile("tenants/abc.sql")
+	versions, err := coordinator.GetVersionsByFile("tenants/abc.sql")
+	assert.Nil(t, err)
 
 	assert.Equal(t, int32(12), versions[0].ID)
 }
@@ -304,10 +363,13 @@ func TestGetMigrationByID(t *testing.T) {
 func TestApplyMigrationsNotifierError(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	_, appliedMigrations := coordinator.ApplyMigrations(types.ModeTypeApply)
+	_, appliedMigrations, err := coordinator.ApplyMigrations(types.ModeTypeApply)
+	assert.Nil(t, err)
 	assert.Len(t, appliedMigrations, 4)
 	// first source migration is already applied so getting the 2nd one
-	assert.Equal(t, coordinator.GetSourceMigrations(nil)[1], appliedMigrations[0])
+	sourceMigrations, err := coordinator.GetSourceMigrations(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, sourceMigrations[1], appliedMigrations[0])
 }
 
 func TestGetSourceMigrationByFile(t *testing.T) {
@@ -335,7 +397,8 @@ func TestGetSourceMigrationsFilterMigrationType(t *testing.T) {
 	filters := SourceMigrationFilters{
 		MigrationType: &migrationType,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 4)
 }
 
@@ -348,7 +411,8 @@ func TestGetSourceMigrationsFilterMigrationTypeSourceDir(t *testing.T) {
 		MigrationType: &migrationType,
 		SourceDir:     &sourceDir,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 3)
 }
 
@@ -361,7 +425,8 @@ func TestGetSourceMigrationsFilterMigrationTypeName(t *testing.T) {
 		MigrationType: &migrationType,
 		Name:          &name,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 2)
 }
 
@@ -372,24 +437,116 @@ func TestGetSourceMigrationsFilterFile(t *testing.T) {
 	filters := SourceMigrationFilters{
 		File: &file,
 	}
-	migrations := coordinator.GetSourceMigrations(&filters)
+	migrations, err := coordinator.GetSourceMigrations(&filters)
+	assert.Nil(t, err)
 	assert.True(t, len(migrations) == 1)
 }
 
 func TestCreateVersion(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
+	assert.Equal(t, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", results.Version.CommitSha)
 }
 
 func TestCreateTenant(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateTenant("commit-sha", types.ActionSync, true, "NewTenant")
+	results, err := coordinator.CreateTenant("commit-sha", types.ActionSync, true, "NewTenant")
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
 }
+
+func TestRevertVersion(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedRevertConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RevertVersion(1, false)
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Summary)
+	assert.Equal(t, "Revert version 1: a", results.Version.Name)
+}
+
+func TestRevertVersionMissingDownMigration(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedRevertConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RevertVersion(2, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "Down migration not found for migration: tenants/201602220001.sql", err.Error())
+}
+
+func TestRevertVersionNoMigrations(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RevertVersion(3, true)
+	assert.Nil(t, results)
+	assert.Equal(t, "Version has no migrations to revert ID: 3", err.Error())
+}
+
+func TestMigrationInProgress(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedLockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	assert.Nil(t, results)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+
+	results, err = coordinator.CreateTenant("commit-sha", types.ActionApply, false, "NewTenant")
+	assert.Nil(t, results)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+
+	results, err = coordinator.RevertVersion(1, false)
+	assert.Nil(t, results)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+
+	_, appliedMigrations, err := coordinator.ApplyMigrations(types.ModeTypeApply)
+	assert.Nil(t, appliedMigrations)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+
+	_, appliedMigrations, err = coordinator.AddTenantAndApplyMigrations(types.ModeTypeApply, "new")
+	assert.Nil(t, appliedMigrations)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+}
+
+func TestCreateVersionMigrationFailed(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedErrorConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	assert.Nil(t, results)
+	assert.IsType(t, &db.ErrMigrationFailed{}, err)
+	assert.Equal(t, "source/201602220000.sql", err.(*db.ErrMigrationFailed).File)
+	assert.Equal(t, "SQL migration source/201602220000.sql failed with error: trouble maker", err.Error())
+}
+
+func TestLoaderErrors(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedErrorDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	_, err := coordinator.GetSourceMigrations(nil)
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.GetSourceMigrationByFile("source/201602220000.sql")
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	err = coordinator.VerifySourceMigrationsCheckSums()
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.VerifySourceMigrations()
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.Plan()
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.CreateTenant("commit-sha", types.ActionApply, false, "new")
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, _, err = coordinator.ApplyMigrations(types.ModeTypeApply)
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, _, err = coordinator.AddTenantAndApplyMigrations(types.ModeTypeApply, "new")
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.RepairChecksums(nil, "reason", "user")
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+	_, err = coordinator.ImportHistory(types.HistoryToolFlyway, "", "", false)
+	assert.IsType(t, &loader.ErrLoadFailed{}, err)
+}
@@ -0,0 +1,257 @@
+package coordinator
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const (
+	defaultFlywayHistoryTable    = "flyway_schema_history"
+	defaultLiquibaseHistoryTable = "DATABASECHANGELOG"
+)
+
+// history table name is interpolated into SQL and must be a plain, optionally schema-qualified, identifier
+var historyTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// Liquibase exec types of changesets which were applied or marked as applied
+var liquibaseAppliedExecTypes = map[string]bool{"EXECUTED": true, "RERAN": true, "MARK_RAN": true}
+
+// liquibaseChangeSetLine matches changeset line of Liquibase formatted SQL, for example --changeset lukasz:1
+var liquibaseChangeSetLine = regexp.MustCompile(`(?i)^\s*--\s*changeset\s`)
+
+// liquibaseMetadataLine matches lines of Liquibase formatted SQL which are not a part of changeset SQL
+var liquibaseMetadataLine = regexp.MustCompile(`(?i)^\s*--\s*(liquibase\s+formatted\s+sql|changeset\s|rollback\s|comment:|preconditions\s|precondition-)`)
+
+// ImportHistory reads Flyway or Liquibase history table, maps its entries to source migrations,
+// and records matched migrations, which are not yet applied, as a new version without executing them
+// entries which could not be mapped to source migrations are returned as unmatched
+func (c *coordinator) ImportHistory(tool types.HistoryTool, table, versionName string, dryRun bool) (*types.ImportResults, error) {
+	if tool != types.HistoryToolFlyway && tool != types.HistoryToolLiquibase {
+		return nil, fmt.Errorf("Unknown history tool: %v", tool)
+	}
+	if table == "" {
+		table = defaultFlywayHistoryTable
+		if tool == types.HistoryToolLiquibase {
+			table = defaultLiquibaseHistoryTable
+		}
+	}
+	if !historyTableName.MatchString(table) {
+		return nil, fmt.Errorf("Invalid history table name: %v", table)
+	}
+	if versionName == "" {
+		versionName = fmt.Sprintf("Imported from %v", tool)
+	}
+
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := c.connector.GetHistoryEntries(tool, table)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, unmatched, warnings := matchHistoryEntries(tool, entries, sourceMigrations)
+
+	// migrations already known to migrator are skipped so that import can be repeated
+	imported := []types.Migration{}
+	for _, m := range c.difference(sourceMigrations, c.flattenAppliedMigrations(appliedMigrations)) {
+		if matched[m.File] {
+			imported = append(imported, m)
+		}
+	}
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}), "Found history entries: %d, migrations to import: %d, unmatched entries: %d, warnings: %d", len(entries), len(imported), len(unmatched), len(warnings))
+
+	summary, version, err := c.connector.CreateVersion(versionName, c.loader.GetCommitSha(), types.ActionSync, dryRun, imported)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordVersion("Import", dryRun, summary, version)
+	c.sendNotification(summary)
+
+	return &types.ImportResults{Summary: summary, Version: version, Imported: imported, Unmatched: unmatched, Warnings: warnings}, nil
+}
+
+// matchHistoryEntries maps history entries to source migrations, scripts are never matched as they are applied every time
+// Flyway entries are matched by version and checksum, Liquibase entries are matched by changelog file name
+// returns files of matched source migrations, unmatched entries together with reasons,
+// and matched Liquibase entries whose checksum does not match source migration
+func matchHistoryEntries(tool types.HistoryTool, entries []types.HistoryEntry, sourceMigrations []types.Migration) (map[string]bool, []types.UnmatchedHistoryEntry, []types.UnmatchedHistoryEntry) {
+	// key is Flyway version or Liquibase file name
+	candidates := map[string][]types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		key := m.Name
+		if tool == types.HistoryToolFlyway {
+			// the same versions as used by semver migration ordering
+			version, ok := loader.SemverMigrationVersion(m.Name)
+			if !ok {
+				continue
+			}
+			key = version
+		}
+		candidates[key] = append(candidates[key], m)
+	}
+
+	matched := map[string]bool{}
+	unmatched := []types.UnmatchedHistoryEntry{}
+	warnings := []types.UnmatchedHistoryEntry{}
+	for _, entry := range entries {
+		var migration *types.Migration
+		var reason string
+		if tool == types.HistoryToolFlyway {
+			migration, reason = matchFlywayEntry(entry, candidates)
+		} else {
+			migration, reason = matchLiquibaseEntry(entry, candidates)
+		}
+		if migration == nil {
+			unmatched = append(unmatched, types.UnmatchedHistoryEntry{HistoryEntry: entry, Reason: reason})
+			continue
+		}
+		matched[migration.File] = true
+		if tool == types.HistoryToolLiquibase {
+			if reason := verifyLiquibaseCheckSum(entry, migration); reason != "" {
+				warnings = append(warnings, types.UnmatchedHistoryEntry{HistoryEntry: entry, Reason: reason})
+			}
+		}
+	}
+
+	return matched, unmatched, warnings
+}
+
+func matchFlywayEntry(entry types.HistoryEntry, candidates map[string][]types.Migration) (*types.Migration, string) {
+	if !entry.Success {
+		return nil, "Failed migration"
+	}
+	if entry.Type != "SQL" {
+		return nil, fmt.Sprintf("Unsupported migration type: %v", entry.Type)
+	}
+	if entry.Version == "" {
+		return nil, "Repeatable migrations are not imported, scripts are applied every time"
+	}
+	versionCandidates := candidates[loader.NormaliseSemver(entry.Version)]
+	if len(versionCandidates) == 0 {
+		return nil, "Source migration not found"
+	}
+	checkSumCandidates := []types.Migration{}
+	for _, m := range versionCandidates {
+		if flywayCheckSum(m.Contents) == entry.CheckSum {
+			checkSumCandidates = append(checkSumCandidates, m)
+		}
+	}
+	if len(checkSumCandidates) == 0 {
+		return nil, fmt.Sprintf("Checksum mismatch: %v", versionCandidates[0].File)
+	}
+	return pickHistoryCandidate(entry, checkSumCandidates)
+}
+
+func matchLiquibaseEntry(entry types.HistoryEntry, candidates map[string][]types.Migration) (*types.Migration, string) {
+	if !liquibaseAppliedExecTypes[entry.Type] {
+		return nil, fmt.Sprintf("Unsupported exec type: %v", entry.Type)
+	}
+	nameCandidates := candidates[path.Base(strings.Replace(entry.Script, "\\", "/", -1))]
+	if len(nameCandidates) == 0 {
+		return nil, "Source migration not found"
+	}
+	return pickHistoryCandidate(entry, nameCandidates)
+}
+
+// verifyLiquibaseCheckSum returns checksum mismatch reason when entry has checksum version 8 (Liquibase 4)
+// and source migration is a formatted SQL changelog with a single changeset,
+// checksums of other changelogs depend on parsed changelog attributes and are not verified
+func verifyLiquibaseCheckSum(entry types.HistoryEntry, migration *types.Migration) string {
+	if !strings.HasPrefix(entry.CheckSum, "8:") {
+		return ""
+	}
+	checkSum, ok := liquibaseCheckSum(migration.Contents)
+	if !ok || strings.EqualFold(checkSum, entry.CheckSum) {
+		return ""
+	}
+	return fmt.Sprintf("Checksum mismatch: %v, expected: %v, actual: %v", migration.File, entry.CheckSum, checkSum)
+}
+
+// pickHistoryCandidate returns the only candidate, when there are more candidates (the same migration name in multiple source directories)
+// the one whose source directory is a part of entry's script path is returned
+func pickHistoryCandidate(entry types.HistoryEntry, candidates []types.Migration) (*types.Migration, string) {
+	if len(candidates) == 1 {
+		return &candidates[0], ""
+	}
+	script := "/" + strings.TrimPrefix(strings.Replace(entry.Script, "\\", "/", -1), "/")
+	var found []types.Migration
+	for _, m := range candidates {
+		if strings.HasSuffix(script, "/"+path.Base(m.SourceDir)+"/"+m.Name) {
+			found = append(found, m)
+		}
+	}
+	if len(found) != 1 {
+		files := []string{}
+		for _, m := range candidates {
+			files = append(files, m.File)
+		}
+		return nil, fmt.Sprintf("Ambiguous source migrations: %v", strings.Join(files, ", "))
+	}
+	return &found[0], ""
+}
+
+// liquibaseCheckSum computes Liquibase checksum (version 8) of formatted SQL changelog with a single changeset,
+// false is returned for other changelogs
+// change checksum is MD5 of SQL change attributes (end delimiter, split statements, strip comments) followed by SQL with collapsed whitespace,
+// changeset checksum is MD5 of change checksum followed by a colon
+func liquibaseCheckSum(contents string) (string, bool) {
+	lines := strings.Split(strings.Replace(contents, "\r\n", "\n", -1), "\n")
+	changeSets := 0
+	sql := []string{}
+	for _, line := range lines {
+		if liquibaseChangeSetLine.MatchString(line) {
+			changeSets++
+		}
+		if !liquibaseMetadataLine.MatchString(line) {
+			sql = append(sql, line)
+		}
+	}
+	if changeSets != 1 {
+		return "", false
+	}
+	change := "8:" + md5Hex("null:true:false:"+strings.Join(strings.Fields(strings.Join(sql, "\n")), " "))
+	return "8:" + md5Hex(change+":"), true
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// flywayCheckSum computes Flyway checksum of migration contents which is CRC32 of all lines without line terminators
+// Flyway stores it as a signed 32-bit integer
+func flywayCheckSum(contents string) string {
+	contents = strings.TrimPrefix(contents, "\ufeff")
+	contents = strings.Replace(contents, "\r\n", "\n", -1)
+	contents = strings.Replace(contents, "\r", "\n", -1)
+	contents = strings.TrimSuffix(contents, "\n")
+
+	var crc uint32
+	if contents != "" {
+		for _, line := range strings.Split(contents, "\n") {
+			crc = crc32.Update(crc, crc32.IEEETable, []byte(line))
+		}
+	}
+	return fmt.Sprintf("%d", int32(crc))
+}
@@ -0,0 +1,131 @@
+package coordinator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func importedFiles(results *types.ImportResults) []string {
+	files := []string{}
+	for _, m := range results.Imported {
+		files = append(files, m.File)
+	}
+	return files
+}
+
+func unmatchedReasons(results *types.ImportResults) []string {
+	reasons := []string{}
+	for _, u := range results.Unmatched {
+		reasons = append(reasons, u.Script+": "+u.Reason)
+	}
+	return reasons
+}
+
+func TestImportHistoryFlyway(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedFlywayDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.ImportHistory(types.HistoryToolFlyway, "", "", false)
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Summary)
+	assert.Equal(t, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", results.Version.CommitSha)
+	assert.Equal(t, []string{"source/V1__init.sql", "tenant/V2__tenants.sql"}, importedFiles(results))
+	assert.Equal(t, []string{
+		`"source": Unsupported migration type: SCHEMA`,
+		"V1.1__users.sql: Checksum mismatch: source/V1.1__users.sql",
+		"V3__removed.sql: Source migration not found",
+		"R__views.sql: Repeatable migrations are not imported, scripts are applied every time",
+		"V2_1__config.sql: Failed migration",
+	}, unmatchedReasons(results))
+}
+
+func TestImportHistoryLiquibase(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.ImportHistory(types.HistoryToolLiquibase, "migrations.DATABASECHANGELOG", "liquibase", true)
+	assert.Nil(t, err)
+	// source/201602220000.sql is already applied, source/201602220001.sql is picked over config/201602220001.sql using changelog path
+	assert.Equal(t, []string{"source/201602220001.sql"}, importedFiles(results))
+	assert.Equal(t, []string{
+		"db/tenant/201602220003.sql: Unsupported exec type: FAILED",
+		"db/legacy/201501010000.sql: Source migration not found",
+	}, unmatchedReasons(results))
+}
+
+func TestImportHistoryErrors(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	_, err := coordinator.ImportHistory("Rails", "", "", false)
+	assert.Equal(t, "Unknown history tool: Rails", err.Error())
+
+	_, err = coordinator.ImportHistory(types.HistoryToolFlyway, "history; drop table users", "", false)
+	assert.Equal(t, "Invalid history table name: history; drop table users", err.Error())
+
+	coordinator = New(context.TODO(), nil, newMockedLockedConnector, newMockedDiskLoader, newMockedNotifier)
+	_, err = coordinator.ImportHistory(types.HistoryToolFlyway, "", "", false)
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+}
+
+func TestPickHistoryCandidateAmbiguous(t *testing.T) {
+	m1 := types.Migration{Name: "V1__a.sql", SourceDir: "ref", File: "ref/V1__a.sql"}
+	m2 := types.Migration{Name: "V1__a.sql", SourceDir: "config", File: "config/V1__a.sql"}
+
+	migration, reason := pickHistoryCandidate(types.HistoryEntry{Script: "V1__a.sql"}, []types.Migration{m1, m2})
+	assert.Nil(t, migration)
+	assert.Equal(t, "Ambiguous source migrations: ref/V1__a.sql, config/V1__a.sql", reason)
+
+	migration, _ = pickHistoryCandidate(types.HistoryEntry{Script: "config\\V1__a.sql"}, []types.Migration{m1, m2})
+	assert.Equal(t, &m2, migration)
+}
+
+func TestLiquibaseCheckSum(t *testing.T) {
+	contents := "--liquibase formatted sql\n\n--changeset lukasz:1\ncreate table abc (\n  id int\n);\n--rollback drop table abc;\n"
+	checkSum, ok := liquibaseCheckSum(contents)
+	assert.True(t, ok)
+	assert.Regexp(t, "^8:[0-9a-f]{32}$", checkSum)
+	// whitespace, line terminators and rollback statements do not change checksum
+	same, _ := liquibaseCheckSum("--liquibase formatted sql\r\n--changeset lukasz:1\r\ncreate   table abc (\r\n\tid int\r\n);\r\n--rollback drop table xyz;")
+	assert.Equal(t, checkSum, same)
+	different, _ := liquibaseCheckSum("--liquibase formatted sql\n--changeset lukasz:1\ncreate table abc (id bigint);")
+	assert.NotEqual(t, checkSum, different)
+
+	// plain SQL files and changelogs with multiple changesets are not verified
+	_, ok = liquibaseCheckSum("create table abc (id int);")
+	assert.False(t, ok)
+	_, ok = liquibaseCheckSum("--changeset lukasz:1\nselect 1;\n--changeset lukasz:2\nselect 2;")
+	assert.False(t, ok)
+}
+
+func TestMatchHistoryEntriesLiquibaseCheckSum(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "ref", File: "ref/001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "--changeset lukasz:1\ncreate table abc (id int);"}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "ref", File: "ref/002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "--changeset lukasz:2\ncreate table def (id int);"}
+	checkSum, _ := liquibaseCheckSum(m1.Contents)
+	entries := []types.HistoryEntry{
+		{Version: "1", Script: "db/001.sql", CheckSum: checkSum, Type: "EXECUTED", Success: true},
+		{Version: "2", Script: "db/002.sql", CheckSum: "8:00000000000000000000000000000000", Type: "EXECUTED", Success: true},
+	}
+
+	matched, unmatched, warnings := matchHistoryEntries(types.HistoryToolLiquibase, entries, []types.Migration{m1, m2})
+	// checksum mismatch does not prevent import
+	assert.Equal(t, map[string]bool{"ref/001.sql": true, "ref/002.sql": true}, matched)
+	assert.Empty(t, unmatched)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, "db/002.sql", warnings[0].Script)
+	assert.True(t, strings.HasPrefix(warnings[0].Reason, "Checksum mismatch: ref/002.sql, expected: 8:00000000000000000000000000000000, actual: 8:"))
+}
+
+func TestFlywayCheckSum(t *testing.T) {
+	// CRC32 of "line1line2", line terminators and BOM are ignored
+	assert.Equal(t, "-2086620103", flywayCheckSum("line1\nline2"))
+	assert.Equal(t, "-2086620103", flywayCheckSum("\ufeffline1\r\nline2\n"))
+	assert.Equal(t, "-2086620103", flywayCheckSum("line1\rline2\r\n"))
+	assert.Equal(t, "0", flywayCheckSum(""))
+}
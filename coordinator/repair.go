@@ -0,0 +1,93 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// versions name column is varchar(200)
+const maxVersionNameLength = 200
+
+// RepairChecksums updates checksums and contents of applied migrations which were intentionally modified in source,
+// when files is nil all modified migrations are repaired, the repair is recorded as a new DB version with user and reason
+func (c *coordinator) RepairChecksums(files []string, reason, user string) (*types.RepairResults, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("Checksum repair requires a reason")
+	}
+
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sourceMigrations, appliedMigrations, err := c.getSourceAndAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	modified := c.modifiedMigrations(sourceMigrations, c.flattenAppliedMigrations(appliedMigrations))
+
+	migrationsToRepair, err := selectMigrationsToRepair(files, modified)
+	if err != nil {
+		return nil, err
+	}
+
+	versionName := repairVersionName(user, reason)
+	common.LogInfo(common.WithFields(c.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}), "Found migrations to repair: %d", len(migrationsToRepair))
+	version, err := c.connector.RepairChecksums(versionName, c.loader.GetCommitSha(), migrationsToRepair)
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordVersion("Repair", false, nil, version)
+
+	return &types.RepairResults{Version: version, Repaired: migrationsToRepair}, nil
+}
+
+// selectMigrationsToRepair returns modified migrations for passed files, or all modified migrations when files is nil
+// every passed file must be a modified migration so that a typo never silently repairs nothing
+func selectMigrationsToRepair(files []string, modified []types.Migration) ([]types.Migration, error) {
+	if len(modified) == 0 {
+		return nil, errors.New("No migrations to repair, checksums of all applied migrations match source migrations")
+	}
+	if files == nil {
+		return modified, nil
+	}
+	if len(files) == 0 {
+		return nil, errors.New("No migrations to repair, files list is empty")
+	}
+
+	modifiedByFile := map[string]types.Migration{}
+	for _, m := range modified {
+		modifiedByFile[m.File] = m
+	}
+
+	selected := []types.Migration{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		m, ok := modifiedByFile[file]
+		if !ok {
+			return nil, fmt.Errorf("Migration is not applied or its checksum matches source migration: %v", file)
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// repairVersionName returns name of the audit version, name is truncated to fit versions name column
+func repairVersionName(user, reason string) string {
+	name := []rune(fmt.Sprintf("Checksum repair by %v: %v", user, reason))
+	if len(name) > maxVersionNameLength {
+		name = name[:maxVersionNameLength]
+	}
+	return string(name)
+}
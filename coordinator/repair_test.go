@@ -0,0 +1,58 @@
+package coordinator
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/db"
+)
+
+func TestRepairChecksums(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	// all modified migrations are repaired when files are not passed
+	results, err := coordinator.RepairChecksums(nil, " fixed comment ", "ci")
+	assert.Nil(t, err)
+	assert.Equal(t, "Checksum repair by ci: fixed comment", results.Version.Name)
+	assert.Equal(t, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", results.Version.CommitSha)
+	assert.Len(t, results.Repaired, 1)
+	assert.Equal(t, "source/201602220000.sql", results.Repaired[0].File)
+	assert.Equal(t, "xxx", results.Repaired[0].CheckSum)
+
+	// duplicated files are repaired once
+	results, err = coordinator.RepairChecksums([]string{"source/201602220000.sql", "source/201602220000.sql"}, "fixed comment", "ci")
+	assert.Nil(t, err)
+	assert.Len(t, results.Repaired, 1)
+}
+
+func TestRepairChecksumsErrors(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	_, err := coordinator.RepairChecksums(nil, "  ", "ci")
+	assert.Equal(t, "Checksum repair requires a reason", err.Error())
+
+	_, err = coordinator.RepairChecksums([]string{"source/201602220000.sql", "source/201602220001.sql"}, "fixed comment", "ci")
+	assert.Equal(t, "Migration is not applied or its checksum matches source migration: source/201602220001.sql", err.Error())
+
+	_, err = coordinator.RepairChecksums([]string{}, "fixed comment", "ci")
+	assert.Equal(t, "No migrations to repair, files list is empty", err.Error())
+
+	coordinator = New(context.TODO(), nil, newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	_, err = coordinator.RepairChecksums(nil, "fixed comment", "ci")
+	assert.Equal(t, "No migrations to repair, checksums of all applied migrations match source migrations", err.Error())
+
+	coordinator = New(context.TODO(), nil, newMockedLockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	_, err = coordinator.RepairChecksums(nil, "fixed comment", "ci")
+	assert.Equal(t, db.ErrMigrationInProgress, err)
+}
+
+func TestRepairVersionName(t *testing.T) {
+	name := repairVersionName("ci", strings.Repeat("ą", 300))
+	assert.Len(t, []rune(name), maxVersionNameLength)
+	assert.True(t, strings.HasPrefix(name, "Checksum repair by ci: ą"))
+}
@@ -0,0 +1,140 @@
+package coordinator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// VerificationError is returned by CreateVersion and ApplyMigrations when fail verification policy is set
+// and out-of-order migrations or migrations missing from source are found
+type VerificationError struct {
+	OutOfOrderMigrations []types.Migration
+	MissingMigrations    []types.Migration
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("Verification failed, out-of-order migrations: [%v], migrations missing from source: [%v]", migrationFiles(e.OutOfOrderMigrations), migrationFiles(e.MissingMigrations))
+}
+
+// ErrChecksumMismatch is returned by VerifySourceMigrationsCheckSums when checksums of applied migrations
+// do not match source migrations
+type ErrChecksumMismatch struct {
+	Migrations []types.Migration
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return "Checksum verification failed. Please review offending migrations."
+}
+
+// checkVerificationPolicy enforces verification policy before migrations are applied
+// synchronised migrations are not executed and are not checked
+func (c *coordinator) checkVerificationPolicy(action types.Action, sourceMigrations []types.Migration, appliedMigrations []types.MigrationDB) error {
+	policy := c.getVerificationPolicy()
+	if action != types.ActionApply || policy == config.VerificationPolicyAllow {
+		return nil
+	}
+
+	flattenedAppliedMigrations := c.flattenAppliedMigrations(appliedMigrations)
+	outOfOrderMigrations := c.outOfOrderMigrations(sourceMigrations, flattenedAppliedMigrations)
+	missingMigrations := c.missingMigrations(sourceMigrations, flattenedAppliedMigrations)
+	if len(outOfOrderMigrations) == 0 && len(missingMigrations) == 0 {
+		return nil
+	}
+
+	err := &VerificationError{OutOfOrderMigrations: outOfOrderMigrations, MissingMigrations: missingMigrations}
+	if policy == config.VerificationPolicyWarn {
+		common.LogWarn(c.ctx, "%v, verification policy is %v, continuing", err.Error(), policy)
+		return nil
+	}
+	return err
+}
+
+// getVerificationPolicy returns verification policy which is either the default one or overridden by user in config
+func (c *coordinator) getVerificationPolicy() string {
+	if c.config == nil || c.config.VerificationPolicy == "" {
+		return config.VerificationPolicyAllow
+	}
+	return c.config.VerificationPolicy
+}
+
+// modifiedMigrations returns source migrations which CheckSum does not match applied DB migration
+// scripts are allowed to be different (they are applied every time and are often updated)
+func (c *coordinator) modifiedMigrations(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []types.Migration {
+	var modified []types.Migration
+	for _, t := range c.intersect(sourceMigrations, flattenedAppliedMigrations) {
+		if !isMigration(t.source) {
+			continue
+		}
+		if t.source.CheckSum != t.applied.CheckSum {
+			modified = append(modified, t.source)
+		}
+	}
+	return modified
+}
+
+// outOfOrderMigrations returns pending migrations which are ordered before the last applied migration
+// source migrations are already ordered by loader
+func (c *coordinator) outOfOrderMigrations(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []types.Migration {
+	applied := map[string]bool{}
+	for _, m := range flattenedAppliedMigrations {
+		applied[m.File] = true
+	}
+
+	last := -1
+	for i, m := range sourceMigrations {
+		if isMigration(m) && applied[m.File] {
+			last = i
+		}
+	}
+
+	outOfOrder := []types.Migration{}
+	for _, m := range sourceMigrations[:last+1] {
+		if isMigration(m) && !applied[m.File] {
+			outOfOrder = append(outOfOrder, m)
+		}
+	}
+	return outOfOrder
+}
+
+// missingMigrations returns applied migrations which source does not exist anymore
+// scripts and down migrations recorded by revertVersion are not reported
+func (c *coordinator) missingMigrations(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []types.Migration {
+	existsInSource := map[string]bool{}
+	for _, m := range sourceMigrations {
+		existsInSource[m.File] = true
+	}
+
+	reported := map[string]bool{}
+	missing := []types.Migration{}
+	for _, m := range flattenedAppliedMigrations {
+		if !isMigration(m) || isDownMigration(m) || existsInSource[m.File] || reported[m.File] {
+			continue
+		}
+		reported[m.File] = true
+		missing = append(missing, m)
+	}
+	return missing
+}
+
+// isMigration returns true for single and tenant migrations, scripts are applied every time
+func isMigration(m types.Migration) bool {
+	return m.MigrationType == types.MigrationTypeSingleMigration || m.MigrationType == types.MigrationTypeTenantMigration
+}
+
+// isDownMigration returns true for down migrations, for example 001_add_users.down.sql
+func isDownMigration(m types.Migration) bool {
+	return strings.HasSuffix(strings.TrimSuffix(m.Name, filepath.Ext(m.Name)), ".down")
+}
+
+func migrationFiles(migrations []types.Migration) string {
+	files := []string{}
+	for _, m := range migrations {
+		files = append(files, m.File)
+	}
+	return strings.Join(files, ", ")
+}
@@ -0,0 +1,70 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func TestVerifySourceMigrations(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newMockedVerificationConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	verification, err := coordinator.VerifySourceMigrations()
+	assert.Nil(t, err)
+	// out-of-order and missing migrations are allowed by default
+	assert.True(t, verification.Verified)
+	assert.Len(t, verification.ModifiedMigrations, 0)
+	assert.Equal(t, "source/201602220000.sql", migrationFiles(verification.OutOfOrderMigrations))
+	assert.Equal(t, "source/201501010000.sql", migrationFiles(verification.MissingMigrations))
+}
+
+func TestVerifySourceMigrationsFailPolicy(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{VerificationPolicy: config.VerificationPolicyFail}, newMockedVerificationConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	verification, err := coordinator.VerifySourceMigrations()
+	assert.Nil(t, err)
+	assert.False(t, verification.Verified)
+}
+
+func TestVerifySourceMigrationsCheckSum(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{VerificationPolicy: config.VerificationPolicyFail}, newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	verification, err := coordinator.VerifySourceMigrations()
+	assert.Nil(t, err)
+	assert.False(t, verification.Verified)
+	assert.Equal(t, "source/201602220000.sql", migrationFiles(verification.ModifiedMigrations))
+	assert.Len(t, verification.OutOfOrderMigrations, 0)
+	assert.Len(t, verification.MissingMigrations, 0)
+}
+
+func TestCreateVersionVerificationPolicy(t *testing.T) {
+	for _, policy := range []string{"", config.VerificationPolicyAllow, config.VerificationPolicyWarn} {
+		coordinator := New(context.TODO(), &config.Config{VerificationPolicy: policy}, newMockedVerificationConnector, newMockedDiskLoader, newMockedNotifier)
+		results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+		assert.Nil(t, err)
+		assert.NotNil(t, results.Version)
+	}
+
+	coordinator := New(context.TODO(), &config.Config{VerificationPolicy: config.VerificationPolicyFail}, newMockedVerificationConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.CreateVersion("commit-sha", types.ActionApply, true)
+	assert.Nil(t, results)
+	assert.IsType(t, &VerificationError{}, err)
+	assert.Equal(t, "Verification failed, out-of-order migrations: [source/201602220000.sql], migrations missing from source: [source/201501010000.sql]", err.Error())
+
+	_, _, err = coordinator.ApplyMigrations(types.ModeTypeApply)
+	assert.IsType(t, &VerificationError{}, err)
+
+	// sync does not execute migrations
+	results, err = coordinator.CreateVersion("commit-sha", types.ActionSync, false)
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Version)
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// error codes returned in GraphQL errors extensions
+const (
+	ErrorCodeMigrationFailed     = "MIGRATION_FAILED"
+	ErrorCodeMigrationInProgress = "MIGRATION_IN_PROGRESS"
+	ErrorCodeNotFound            = "NOT_FOUND"
+	ErrorCodeChecksumMismatch    = "CHECKSUM_MISMATCH"
+	ErrorCodeVerificationFailed  = "VERIFICATION_FAILED"
+	ErrorCodeSourceLoadFailed    = "SOURCE_LOAD_FAILED"
+)
+
+// extendedError is an error which code and details are returned by graphql-go in errors[].extensions
+type extendedError struct {
+	err        error
+	extensions map[string]interface{}
+}
+
+func (e *extendedError) Error() string {
+	return e.err.Error()
+}
+
+// Extensions implements graphql-go interface for errors with extensions
+func (e *extendedError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// extendError adds code and details to known errors, other errors are returned unchanged
+func extendError(err error) error {
+	var extensions map[string]interface{}
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *db.ErrMigrationFailed:
+		extensions = map[string]interface{}{"code": ErrorCodeMigrationFailed, "file": e.File, "schema": e.Schema, "statementIndex": e.StatementIndex, "dbErrorCode": e.Code, "line": e.Line, "statementPosition": e.StatementPosition}
+	case *db.ErrNotFound:
+		extensions = map[string]interface{}{"code": ErrorCodeNotFound, "entity": e.Entity, "id": e.ID}
+	case *coordinator.ErrChecksumMismatch:
+		extensions = map[string]interface{}{"code": ErrorCodeChecksumMismatch, "files": migrationFiles(e.Migrations)}
+	case *coordinator.VerificationError:
+		extensions = map[string]interface{}{"code": ErrorCodeVerificationFailed, "outOfOrderMigrations": migrationFiles(e.OutOfOrderMigrations), "missingMigrations": migrationFiles(e.MissingMigrations)}
+	case *loader.ErrLoadFailed:
+		extensions = map[string]interface{}{"code": ErrorCodeSourceLoadFailed, "baseLocation": e.BaseLocation}
+	default:
+		if err != db.ErrMigrationInProgress {
+			return err
+		}
+		extensions = map[string]interface{}{"code": ErrorCodeMigrationInProgress}
+	}
+	return &extendedError{err: err, extensions: extensions}
+}
+
+func migrationFiles(migrations []types.Migration) []string {
+	files := []string{}
+	for _, m := range migrations {
+		files = append(files, m.File)
+	}
+	return files
+}
@@ -1,7 +1,12 @@
 package data
 
 import (
+	"context"
+	"errors"
+
+	"github.com/lukaszbudnik/migrator/auth"
 	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/jobs"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -25,6 +30,10 @@ enum Action {
   // importing source migrations from a legacy tool or synchronising tenant migrations when tenant was created using external tool
   Sync
 }
+enum HistoryTool {
+  Flyway
+  Liquibase
+}
 scalar Time
 interface Migration {
   name: String!
@@ -33,6 +42,8 @@ interface Migration {
   file: String!
   contents: String!
   checkSum: String!
+  // contents of the paired down migration, empty if migration does not have down migration
+  downContents: String!
 }
 type SourceMigration implements Migration {
   name: String!
@@ -41,6 +52,7 @@ type SourceMigration implements Migration {
   file: String!
   contents: String!
   checkSum: String!
+  downContents: String!
 }
 type DBMigration implements Migration {
   id: Int!
@@ -50,17 +62,51 @@ type DBMigration implements Migration {
   file: String!
   contents: String!
   checkSum: String!
+  downContents: String!
   schema: String!
   created: Time!
 }
 type Tenant {
   name: String!
 }
+type PlannedSchema {
+  schema: String!
+  // migration contents with schema placeholder substituted
+  sql: String!
+}
+type PlannedMigration implements Migration {
+  name: String!
+  migrationType: MigrationType!
+  sourceDir: String!
+  file: String!
+  contents: String!
+  checkSum: String!
+  downContents: String!
+  // schemas migration will be applied to
+  schemas: [PlannedSchema!]!
+}
+type Plan {
+  // number of tenants in the system
+  tenants: Int!
+  migrations: [PlannedMigration!]!
+}
 type Version {
   id: Int!
   name: String!
   created: Time!
+  commitSha: String!
   dbMigrations: [DBMigration!]!
+  // tenants for which all migrations were applied, set only for per-tenant and per-migration transaction strategies
+  succeededTenants: [String!]!
+  // tenants for which migrations failed, set only for per-tenant and per-migration transaction strategies
+  failedTenants: [FailedTenant!]!
+  // Partial and Failed are possible only for per-tenant and per-migration transaction strategies
+  state: VersionState!
+}
+enum VersionState {
+  Succeeded
+  Partial
+  Failed
 }
 input SourceMigrationFilters {
   name: String
@@ -72,12 +118,24 @@ input VersionInput {
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  // when true operation is executed asynchronously and only job is returned, see job(id: String!)
+  async: Boolean = false
 }
 input TenantInput {
   tenantName: String!
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  // when true operation is executed asynchronously and only job is returned, see job(id: String!)
+  async: Boolean = false
+}
+input ImportInput {
+  tool: HistoryTool!
+  // history table, defaults to flyway_schema_history for Flyway and DATABASECHANGELOG for Liquibase
+  table: String
+  // defaults to "Imported from Flyway" or "Imported from Liquibase"
+  versionName: String
+  dryRun: Boolean = false
 }
 type Summary {
   // date time operation started
@@ -102,10 +160,95 @@ type Summary {
   tenantScriptsTotal: Int!
   // sum of singleScripts and tenantScriptsTotal
   scriptsGrandTotal: Int!
+  // tenants for which all migrations were applied, set only for per-tenant and per-migration transaction strategies
+  succeededTenants: [String!]!
+  // tenants for which migrations failed, set only for per-tenant and per-migration transaction strategies
+  failedTenants: [FailedTenant!]!
+}
+type FailedTenant {
+  name: String!
+  // file of the migration which failed
+  file: String!
+  error: String!
+  // 0-based index of the failed statement in the file
+  statementIndex: Int!
+  // DB error code: SQLSTATE for PostgreSQL, error number for MySQL and MS SQL, empty when not reported by DB driver
+  dbErrorCode: String!
+  // 1-based line of the file and 1-based character position in the failed statement, 0 when not reported by DB driver
+  line: Int!
+  statementPosition: Int!
 }
 type CreateResults {
+  // null when operation is executed asynchronously
+  summary: Summary
+  version: Version
+  // set only when operation is executed asynchronously
+  job: Job
+}
+type UnmatchedHistoryEntry {
+  // Flyway version or Liquibase changeset ID
+  version: String!
+  // Flyway description or Liquibase changeset author
+  description: String!
+  // Flyway script or Liquibase changelog file name
+  script: String!
+  checkSum: String!
+  // Flyway migration type or Liquibase exec type
+  type: String!
+  success: Boolean!
+  // why the entry could not be mapped to a source migration or why it needs attention
+  reason: String!
+}
+type ImportResults {
   summary: Summary!
+  // null when there were no migrations to import
   version: Version
+  // source migrations recorded as applied
+  imported: [SourceMigration!]!
+  unmatched: [UnmatchedHistoryEntry!]!
+  // imported entries which need attention, for example Liquibase checksum mismatches
+  warnings: [UnmatchedHistoryEntry!]!
+}
+type RepairResults {
+  // version which records who repaired checksums and why, it has no DB migrations
+  version: Version!
+  // source migrations which checksums and contents were stored as applied migrations
+  repaired: [SourceMigration!]!
+}
+type Verification {
+  // false when checksums of applied migrations changed, or when fail verification policy is set and there are out-of-order or missing migrations
+  verified: Boolean!
+  // source migrations which checksums do not match applied migrations
+  modifiedMigrations: [SourceMigration!]!
+  // pending migrations which are ordered before the last applied migration
+  outOfOrderMigrations: [SourceMigration!]!
+  // applied migrations which do not exist in source migrations anymore
+  missingMigrations: [SourceMigration!]!
+}
+enum JobState {
+  Queued
+  Running
+  Succeeded
+  Failed
+}
+type Job {
+  id: String!
+  // createVersion or createTenant
+  operation: String!
+  state: JobState!
+  createdAt: Time!
+  startedAt: Time
+  finishedAt: Time
+  // migrations applied so far, updated while job is running
+  progress: Summary
+  // set when job succeeded
+  results: CreateResults
+  // set when job failed
+  error: String
+  // host name of migrator instance which executes the job
+  replica: String!
+  // refreshed periodically by the instance which executes the job until job finishes
+  updatedAt: Time!
 }
 type Query {
   // returns array of SourceMigration objects
@@ -130,77 +273,201 @@ type Query {
   dbMigration(id: Int!): DBMigration
   // returns array of Tenant objects
   tenants(): [Tenant!]!
+  // returns migrations which would be applied by createVersion together with schemas and SQL executed in every schema
+  // plan does not execute any SQL
+  plan(): Plan!
+  // verifies checksums of source migrations, reports out-of-order migrations and applied migrations missing from source
+  verification(): Verification!
+  // returns a single Job, jobs are created by createVersion and createTenant operations executed asynchronously
+  // jobs are stored in migrator schema and are removed 24 hours after they finished
+  job(id: String!): Job
 }
+// all mutations require operator role when HTTP API authentication is configured
 type Mutation {
   // creates new DB version by applying all eligible DB migrations & scripts
   createVersion(input: VersionInput!): CreateResults!
   // creates new tenant by applying only tenant-specific DB migrations & scripts, also creates new DB version
   createTenant(input: TenantInput!): CreateResults!
+  // reverts all migrations applied in a given version by executing their down migrations in reverse order
+  // all reverted migrations must have down migrations, scripts are not reverted
+  // the revert itself is recorded as a new DB version
+  revertVersion(id: Int!, dryRun: Boolean = false): CreateResults!
+  // imports Flyway or Liquibase history table, entries are mapped to source migrations which are recorded as applied (without executing them) in a new DB version
+  // Flyway entries are matched by version and checksum, Liquibase entries are matched by changelog file name
+  // source migrations already applied by migrator are skipped, entries which could not be mapped are returned as unmatched
+  importHistory(input: ImportInput!): ImportResults!
+  // updates checksums and contents of applied migrations which were intentionally modified in source, for example a fixed comment
+  // files are optional, when not set all modified migrations are repaired, reason is required
+  // the repair is recorded as a new DB version with the name of the authenticated user and the reason
+  repairChecksums(files: [String!], reason: String!): RepairResults!
 }
 `
 
+// ErrAsyncNotSupported is returned when asynchronous operation is requested but RootResolver has no jobs Manager
+var ErrAsyncNotSupported = errors.New("Asynchronous operations are not supported")
+
 // RootResolver is resolver for all the migrator data
 type RootResolver struct {
 	Coordinator coordinator.Coordinator
+	Jobs        jobs.Manager
 }
 
 // Tenants resolves all tenants
 func (r *RootResolver) Tenants() ([]types.Tenant, error) {
-	tenants := r.Coordinator.GetTenants()
-	return tenants, nil
+	tenants, err := r.Coordinator.GetTenants()
+	return tenants, extendError(err)
+}
+
+// Plan resolves migrations which would be applied by createVersion
+func (r *RootResolver) Plan() (*types.Plan, error) {
+	plan, err := r.Coordinator.Plan()
+	return plan, extendError(err)
+}
+
+// Verification resolves verification of source migrations against applied migrations
+func (r *RootResolver) Verification() (*types.Verification, error) {
+	verification, err := r.Coordinator.VerifySourceMigrations()
+	return verification, extendError(err)
 }
 
 // Versions resoves all versions, optionally can return versions with specific source migration (file is the identifier for source migrations)
 func (r *RootResolver) Versions(args struct {
 	File *string
 }) ([]types.Version, error) {
+	var versions []types.Version
+	var err error
 	if args.File != nil {
-		return r.Coordinator.GetVersionsByFile(*args.File), nil
+		versions, err = r.Coordinator.GetVersionsByFile(*args.File)
+	} else {
+		versions, err = r.Coordinator.GetVersions()
 	}
-	return r.Coordinator.GetVersions(), nil
+	return versions, extendError(err)
 }
 
 // Version resolves version by ID
 func (r *RootResolver) Version(args struct {
 	ID int32
 }) (*types.Version, error) {
-	return r.Coordinator.GetVersionByID(args.ID)
+	version, err := r.Coordinator.GetVersionByID(args.ID)
+	return version, extendError(err)
 }
 
 // SourceMigrations resolves source migrations using optional filters
 func (r *RootResolver) SourceMigrations(args struct {
 	Filters *coordinator.SourceMigrationFilters
 }) ([]types.Migration, error) {
-	sourceMigrations := r.Coordinator.GetSourceMigrations(args.Filters)
-	return sourceMigrations, nil
+	sourceMigrations, err := r.Coordinator.GetSourceMigrations(args.Filters)
+	return sourceMigrations, extendError(err)
 }
 
 // SourceMigration resolves source migration by its file name
 func (r *RootResolver) SourceMigration(args struct {
 	File string
 }) (*types.Migration, error) {
-	return r.Coordinator.GetSourceMigrationByFile(args.File)
+	sourceMigration, err := r.Coordinator.GetSourceMigrationByFile(args.File)
+	return sourceMigration, extendError(err)
 }
 
 // DBMigration resolves DB migration by ID
 func (r *RootResolver) DBMigration(args struct {
 	ID int32
 }) (*types.MigrationDB, error) {
-	return r.Coordinator.GetDBMigrationByID(args.ID)
+	dbMigration, err := r.Coordinator.GetDBMigrationByID(args.ID)
+	return dbMigration, extendError(err)
 }
 
 // CreateVersion creates new DB version
-func (r *RootResolver) CreateVersion(args struct {
+func (r *RootResolver) CreateVersion(ctx context.Context, args struct {
 	Input types.VersionInput
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun)
-	return results, nil
+	if err := auth.Authorize(ctx, auth.RoleOperator); err != nil {
+		return nil, err
+	}
+	if args.Input.Async {
+		return r.submit(ctx, "createVersion", func(coordinator coordinator.Coordinator) (*types.CreateResults, error) {
+			return coordinator.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun)
+		})
+	}
+	results, err := r.Coordinator.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun)
+	return results, extendError(err)
 }
 
 // CreateTenant creates new tenant
-func (r *RootResolver) CreateTenant(args struct {
+func (r *RootResolver) CreateTenant(ctx context.Context, args struct {
 	Input types.TenantInput
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName)
-	return results, nil
+	if err := auth.Authorize(ctx, auth.RoleOperator); err != nil {
+		return nil, err
+	}
+	if args.Input.Async {
+		return r.submit(ctx, "createTenant", func(coordinator coordinator.Coordinator) (*types.CreateResults, error) {
+			return coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName)
+		})
+	}
+	results, err := r.Coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName)
+	return results, extendError(err)
+}
+
+// RevertVersion reverts version by ID
+func (r *RootResolver) RevertVersion(ctx context.Context, args struct {
+	ID     int32
+	DryRun bool
+}) (*types.CreateResults, error) {
+	if err := auth.Authorize(ctx, auth.RoleOperator); err != nil {
+		return nil, err
+	}
+	results, err := r.Coordinator.RevertVersion(args.ID, args.DryRun)
+	return results, extendError(err)
+}
+
+// ImportHistory imports Flyway or Liquibase history table
+func (r *RootResolver) ImportHistory(ctx context.Context, args struct {
+	Input types.ImportInput
+}) (*types.ImportResults, error) {
+	if err := auth.Authorize(ctx, auth.RoleOperator); err != nil {
+		return nil, err
+	}
+	var table, versionName string
+	if args.Input.Table != nil {
+		table = *args.Input.Table
+	}
+	if args.Input.VersionName != nil {
+		versionName = *args.Input.VersionName
+	}
+	results, err := r.Coordinator.ImportHistory(args.Input.Tool, table, versionName, args.Input.DryRun)
+	return results, extendError(err)
+}
+
+// RepairChecksums updates checksums of modified applied migrations, user is read from context
+func (r *RootResolver) RepairChecksums(ctx context.Context, args struct {
+	Files  *[]string
+	Reason string
+}) (*types.RepairResults, error) {
+	if err := auth.Authorize(ctx, auth.RoleOperator); err != nil {
+		return nil, err
+	}
+	var files []string
+	if args.Files != nil {
+		files = *args.Files
+	}
+	results, err := r.Coordinator.RepairChecksums(files, args.Reason, auth.User(ctx))
+	return results, extendError(err)
+}
+
+// Job resolves asynchronous job by ID
+func (r *RootResolver) Job(args struct {
+	ID string
+}) (*types.Job, error) {
+	if r.Jobs == nil {
+		return nil, ErrAsyncNotSupported
+	}
+	return r.Jobs.GetJob(args.ID)
+}
+
+func (r *RootResolver) submit(ctx context.Context, name string, operation jobs.Operation) (*types.CreateResults, error) {
+	if r.Jobs == nil {
+		return nil, ErrAsyncNotSupported
+	}
+	job := r.Jobs.Submit(ctx, name, operation)
+	return &types.CreateResults{Job: job}, nil
 }
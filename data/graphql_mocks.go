@@ -1,11 +1,17 @@
 package data
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/jobs"
+	"github.com/lukaszbudnik/migrator/loader"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -19,18 +25,54 @@ func (m *mockedCoordinator) safeString(value *string) string {
 	return *value
 }
 
-func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) *types.CreateResults {
+func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) (*types.CreateResults, error) {
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: version}
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: version}, nil
 }
 
-func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) *types.CreateResults {
+func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) (*types.CreateResults, error) {
 	// re-use mocked version from GetVersionByID...
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: version}
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: version}, nil
 }
 
-func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) []types.Migration {
+func (m *mockedCoordinator) RevertVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	version, _ := m.GetVersionByID(ID + 1)
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) ImportHistory(tool types.HistoryTool, table, versionName string, dryRun bool) (*types.ImportResults, error) {
+	version, _ := m.GetVersionByID(0)
+	version.Name = versionName
+	imported := []types.Migration{version.DBMigrations[0].Migration}
+	unmatched := []types.UnmatchedHistoryEntry{{HistoryEntry: types.HistoryEntry{Version: "2", Description: "removed", Script: table + "/V2__removed.sql", CheckSum: "123", Type: "SQL", Success: true}, Reason: "Source migration not found"}}
+	warnings := []types.UnmatchedHistoryEntry{{HistoryEntry: types.HistoryEntry{Version: "1", Description: "lukasz", Script: table + "/201602220000.sql", CheckSum: "8:abc", Type: "EXECUTED", Success: true}, Reason: "Checksum mismatch: source/201602220000.sql"}}
+	return &types.ImportResults{Summary: &types.MigrationResults{SingleMigrations: 1}, Version: version, Imported: imported, Unmatched: unmatched, Warnings: warnings}, nil
+}
+
+func (m *mockedCoordinator) RepairChecksums(files []string, reason, user string) (*types.RepairResults, error) {
+	version, _ := m.GetVersionByID(0)
+	version.Name = fmt.Sprintf("Checksum repair by %v: %v", user, reason)
+	version.DBMigrations = []types.DBMigration{}
+	repaired := []types.Migration{}
+	sourceMigrations, _ := m.GetSourceMigrations(nil)
+	for _, m := range sourceMigrations {
+		for _, file := range files {
+			if m.File == file {
+				repaired = append(repaired, m)
+			}
+		}
+	}
+	return &types.RepairResults{Version: version, Repaired: repaired}, nil
+}
+
+func (m *mockedCoordinator) Plan() (*types.Plan, error) {
+	m1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.abc", CheckSum: "sha256"}
+	schemas := []types.PlannedSchema{{Schema: "abc", SQL: "create table abc.abc"}, {Schema: "def", SQL: "create table def.abc"}}
+	return &types.Plan{Tenants: 2, Migrations: []types.PlannedMigration{{Migration: m1, Schemas: schemas}}}, nil
+}
+
+func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) ([]types.Migration, error) {
 
 	if filters == nil {
 		m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
@@ -38,11 +80,11 @@ func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigra
 		m3 := types.Migration{Name: "201602220001.sql", SourceDir: "config", File: "config/201602220001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 		m4 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
 		m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
-		return []types.Migration{m1, m2, m3, m4, m5}
+		return []types.Migration{m1, m2, m3, m4, m5}, nil
 	}
 
 	m1 := types.Migration{Name: m.safeString(filters.Name), SourceDir: m.safeString(filters.SourceDir), File: m.safeString(filters.File), MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
-	return []types.Migration{m1}
+	return []types.Migration{m1}, nil
 }
 
 func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
@@ -56,23 +98,23 @@ func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migrat
 func (m *mockedCoordinator) Dispose() {
 }
 
-func (m *mockedCoordinator) GetTenants() []types.Tenant {
+func (m *mockedCoordinator) GetTenants() ([]types.Tenant, error) {
 	a := types.Tenant{Name: "a"}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
-	return []types.Tenant{a, b, c}
+	return []types.Tenant{a, b, c}, nil
 }
 
-func (m *mockedCoordinator) GetVersions() []types.Version {
+func (m *mockedCoordinator) GetVersions() ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
 	b := types.Version{ID: 121, Name: "bb", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -1)}}
 	c := types.Version{ID: 122, Name: "ccc", Created: graphql.Time{Time: time.Now()}}
-	return []types.Version{a, b, c}
+	return []types.Version{a, b, c}, nil
 }
 
-func (m *mockedCoordinator) GetVersionsByFile(file string) []types.Version {
+func (m *mockedCoordinator) GetVersionsByFile(file string) ([]types.Version, error) {
 	a := types.Version{ID: 12, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}}
-	return []types.Version{a}
+	return []types.Version{a}, nil
 }
 
 func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
@@ -90,14 +132,14 @@ func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
 	db4 := types.MigrationDB{Migration: m3, Schema: "def", Created: graphql.Time{Time: d3}}
 	db5 := types.MigrationDB{Migration: m3, Schema: "xyz", Created: graphql.Time{Time: d3}}
 
-	a := types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}, DBMigrations: []types.MigrationDB{db1, db2, db3, db4, db5}}
+	a := types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: time.Now().AddDate(0, 0, -2)}, DBMigrations: []types.MigrationDB{db1, db2, db3, db4, db5}, SucceededTenants: []string{"abc", "def"}, FailedTenants: []types.FailedTenant{{Name: "xyz", File: "tenants/202002180000.sql", Error: "trouble maker"}}, State: types.VersionStatePartial}
 
 	return &a, nil
 }
 
 // not used in GraphQL
-func (m *mockedCoordinator) GetAppliedMigrations() []types.MigrationDB {
-	return []types.MigrationDB{}
+func (m *mockedCoordinator) GetAppliedMigrations() ([]types.MigrationDB, error) {
+	return []types.MigrationDB{}, nil
 }
 
 func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
@@ -107,14 +149,62 @@ func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, er
 	return &db, nil
 }
 
-func (m *mockedCoordinator) ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration) {
-	return &types.MigrationResults{}, []types.Migration{}
+func (m *mockedCoordinator) ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration, error) {
+	return &types.MigrationResults{}, []types.Migration{}, nil
+}
+
+func (m *mockedCoordinator) AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration, error) {
+	return &types.MigrationResults{}, []types.Migration{}, nil
+}
+
+func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() error {
+	return nil
+}
+
+func (m *mockedCoordinator) VerifySourceMigrations() (*types.Verification, error) {
+	missing := types.Migration{Name: "201501010000.sql", SourceDir: "source", File: "source/201501010000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	return &types.Verification{Verified: true, ModifiedMigrations: []types.Migration{}, OutOfOrderMigrations: []types.Migration{}, MissingMigrations: []types.Migration{missing}}, nil
+}
+
+type mockedErrorCoordinator struct {
+	mockedCoordinator
+}
+
+func (m *mockedErrorCoordinator) CreateVersion(string, types.Action, bool) (*types.CreateResults, error) {
+	return nil, &db.ErrMigrationFailed{File: "tenants/202002180000.sql", Schema: "abc", StatementIndex: 1, Code: "42601", Line: 2, StatementPosition: 18, Cause: errors.New("syntax error")}
+}
+
+func (m *mockedErrorCoordinator) CreateTenant(string, types.Action, bool, string) (*types.CreateResults, error) {
+	return nil, db.ErrMigrationInProgress
+}
+
+func (m *mockedErrorCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
+	return nil, &db.ErrNotFound{Entity: "Version", ID: ID}
+}
+
+func (m *mockedErrorCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) ([]types.Migration, error) {
+	return nil, &loader.ErrLoadFailed{BaseLocation: "/migrations", Cause: errors.New("no such file or directory")}
+}
+
+func (m *mockedErrorCoordinator) VerifySourceMigrations() (*types.Verification, error) {
+	missing := types.Migration{Name: "201501010000.sql", SourceDir: "source", File: "source/201501010000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	return nil, &coordinator.VerificationError{OutOfOrderMigrations: []types.Migration{}, MissingMigrations: []types.Migration{missing}}
+}
+
+type mockedJobs struct {
+	operation string
 }
 
-func (m *mockedCoordinator) AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration) {
-	return &types.MigrationResults{}, []types.Migration{}
+func (m *mockedJobs) Submit(ctx context.Context, name string, operation jobs.Operation) *types.Job {
+	m.operation = name
+	return &types.Job{ID: "abc", Operation: name, State: types.JobStateQueued, CreatedAt: graphql.Time{Time: time.Now()}}
 }
 
-func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
-	return true, nil
+func (m *mockedJobs) GetJob(ID string) (*types.Job, error) {
+	if ID != "abc" {
+		return nil, fmt.Errorf("Job not found ID: %v", ID)
+	}
+	version := &types.Version{ID: 123, Name: "commit-sha"}
+	summary := &types.MigrationResults{SingleMigrations: 1, MigrationsGrandTotal: 1}
+	return &types.Job{ID: ID, Operation: "createVersion", State: types.JobStateSucceeded, CreatedAt: graphql.Time{Time: time.Now()}, Progress: summary, Results: &types.CreateResults{Summary: summary, Version: version}, Replica: "migrator-0"}, nil
 }
@@ -8,6 +8,9 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/auth"
+	"github.com/lukaszbudnik/migrator/tracing"
 )
 
 func TestTenants(t *testing.T) {
@@ -32,6 +35,62 @@ func TestTenants(t *testing.T) {
 	assert.Equal(t, 3, results)
 }
 
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Plan"
+	query := `query Plan {
+      plan {
+        tenants
+        migrations {
+          file
+          migrationType
+          schemas {
+            schema
+            sql
+          }
+        }
+      }
+    }`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"plan":{"tenants":2,"migrations":[{"file":"tenants/201602220001.sql","migrationType":"TenantMigration","schemas":[{"schema":"abc","sql":"create table abc.abc"},{"schema":"def","sql":"create table def.abc"}]}]}}`, string(resp.Data))
+}
+
+func TestVerification(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Verification"
+	query := `query Verification {
+      verification {
+        verified
+        modifiedMigrations {
+          file
+        }
+        outOfOrderMigrations {
+          file
+        }
+        missingMigrations {
+          file
+          migrationType
+        }
+      }
+    }`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.JSONEq(t, `{"verification":{"verified":true,"modifiedMigrations":[],"outOfOrderMigrations":[],"missingMigrations":[{"file":"source/201501010000.sql","migrationType":"SingleMigration"}]}}`, string(resp.Data))
+}
+
 func TestVersions(t *testing.T) {
 	ctx := context.Background()
 
@@ -106,6 +165,13 @@ func TestVersionByID(t *testing.T) {
           schema
           migrationType
         }
+        succeededTenants
+        failedTenants {
+          name
+          file
+          error
+        }
+        state
       }
     }`
 	variables := map[string]interface{}{
@@ -127,6 +193,11 @@ func TestVersionByID(t *testing.T) {
 	assert.Equal(t, "tenants/202002180000.sql", lastDBMigration["file"])
 	assert.Equal(t, "TenantMigration", lastDBMigration["migrationType"])
 	assert.Equal(t, "xyz", lastDBMigration["schema"])
+	assert.Equal(t, []interface{}{"abc", "def"}, version["succeededTenants"])
+	failedTenant := version["failedTenants"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "xyz", failedTenant["name"])
+	assert.Equal(t, "trouble maker", failedTenant["error"])
+	assert.Equal(t, "Partial", version["state"])
 }
 
 func TestSourceMigrationsNoFilters(t *testing.T) {
@@ -421,6 +492,9 @@ func TestCreateVersionWithDefaults(t *testing.T) {
       tenants
       migrationsGrandTotal
       scriptsGrandTotal
+      failedTenants {
+        name
+      }
     }
   }
 }`
@@ -449,7 +523,8 @@ func TestCreateVersionWithDefaults(t *testing.T) {
 	assert.NotNil(t, summary["tenants"])
 	assert.NotNil(t, summary["migrationsGrandTotal"])
 	assert.NotNil(t, summary["scriptsGrandTotal"])
-	// we return only 4 fields in above query others should be nil including duration
+	assert.Equal(t, []interface{}{}, summary["failedTenants"])
+	// we return only 5 fields in above query others should be nil including duration
 	assert.Nil(t, summary["duration"])
 }
 
@@ -634,3 +709,312 @@ func TestCreateTenantNonDefaultParams(t *testing.T) {
 	// we return only 4 fields in above query others should be nil including duration
 	assert.Nil(t, summary["duration"])
 }
+
+func TestRevertVersion(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RevertVersion"
+	query := `mutation RevertVersion($id: Int!, $dryRun: Boolean) {
+  revertVersion(id: $id, dryRun: $dryRun) {
+    version {
+      id,
+      name,
+    }
+    summary {
+      startedAt
+      migrationsGrandTotal
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id":     123,
+		"dryRun": true,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["revertVersion"].(map[string]interface{})
+
+	version := results["version"].(map[string]interface{})
+	// revert is recorded as a new version
+	assert.Equal(t, float64(124), version["id"])
+	summary := results["summary"].(map[string]interface{})
+	assert.NotNil(t, summary["startedAt"])
+}
+
+func TestImportHistory(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "ImportHistory"
+	query := `mutation ImportHistory($input: ImportInput!) {
+  importHistory(input: $input) {
+    summary {
+      singleMigrations
+    }
+    version {
+      name
+    }
+    imported {
+      file
+    }
+    unmatched {
+      version
+      script
+      checkSum
+      type
+      success
+      reason
+    }
+    warnings {
+      script
+      reason
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"tool":        "Flyway",
+			"table":       "legacy",
+			"versionName": "Imported from Flyway",
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"importHistory":{"summary":{"singleMigrations":1},"version":{"name":"Imported from Flyway"},"imported":[{"file":"source/201602220000.sql"}],"unmatched":[{"version":"2","script":"legacy/V2__removed.sql","checkSum":"123","type":"SQL","success":true,"reason":"Source migration not found"}],"warnings":[{"script":"legacy/201602220000.sql","reason":"Checksum mismatch: source/201602220000.sql"}]}}`, string(resp.Data))
+}
+
+func TestCreateVersionAsync(t *testing.T) {
+	ctx := context.Background()
+
+	jobs := &mockedJobs{}
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}, Jobs: jobs}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      startedAt
+    }
+    job {
+      id
+      state
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["createVersion"].(map[string]interface{})
+
+	assert.Nil(t, results["summary"])
+	job := results["job"].(map[string]interface{})
+	assert.Equal(t, "abc", job["id"])
+	assert.Equal(t, "Queued", job["state"])
+	assert.Equal(t, "createVersion", jobs.operation)
+}
+
+func TestCreateTenantAsyncNotSupported(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateTenant"
+	query := `mutation CreateTenant($input: TenantInput!) {
+  createTenant(input: $input) {
+    job {
+      id
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"tenantName":  "new_tenant",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, ErrAsyncNotSupported.Error(), resp.Errors[0].Message)
+}
+
+func TestJob(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}, Jobs: &mockedJobs{}}, opts...)
+
+	opName := "Job"
+	query := `query Job($id: String!) {
+  job(id: $id) {
+    id
+    operation
+    state
+    progress {
+      migrationsGrandTotal
+    }
+    results {
+      version {
+        id
+      }
+    }
+    error
+    replica
+  }
+}`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{"id": "abc"})
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job := jsonMap["job"].(map[string]interface{})
+	assert.Equal(t, "Succeeded", job["state"])
+	assert.Equal(t, "createVersion", job["operation"])
+	assert.Equal(t, float64(1), job["progress"].(map[string]interface{})["migrationsGrandTotal"])
+	assert.Equal(t, float64(123), job["results"].(map[string]interface{})["version"].(map[string]interface{})["id"])
+	assert.Nil(t, job["error"])
+	assert.Equal(t, "migrator-0", job["replica"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": "xyz"})
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "Job not found ID: xyz", resp.Errors[0].Message)
+}
+
+func TestRepairChecksums(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.RoleKey{}, auth.RoleOperator)
+	ctx = context.WithValue(ctx, auth.UserKey{}, "ci")
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RepairChecksums"
+	query := `mutation RepairChecksums($files: [String!], $reason: String!) {
+  repairChecksums(files: $files, reason: $reason) {
+    version {
+      name
+    }
+    repaired {
+      file
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"files":  []interface{}{"source/201602220001.sql"},
+		"reason": "fixed comment",
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"repairChecksums":{"version":{"name":"Checksum repair by ci: fixed comment"},"repaired":[{"file":"source/201602220001.sql"}]}}`, string(resp.Data))
+
+	// reason is required
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"files": []interface{}{"source/201602220001.sql"}})
+	assert.Len(t, resp.Errors, 1)
+}
+
+func TestMutationsRequireOperatorRole(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.RoleKey{}, auth.RoleReader)
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	resp := schema.Exec(ctx, `mutation { revertVersion(id: 123) { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, auth.ErrForbidden.Error(), resp.Errors[0].Message)
+
+	resp = schema.Exec(ctx, `mutation { createTenant(input: {tenantName: "abc", versionName: "commit-sha"}) { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, auth.ErrForbidden.Error(), resp.Errors[0].Message)
+
+	resp = schema.Exec(ctx, `mutation { importHistory(input: {tool: Flyway}) { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, auth.ErrForbidden.Error(), resp.Errors[0].Message)
+
+	resp = schema.Exec(ctx, `mutation { repairChecksums(reason: "typo") { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, auth.ErrForbidden.Error(), resp.Errors[0].Message)
+
+	// readers can query data
+	resp = schema.Exec(ctx, `query { tenants { name } }`, "", nil)
+	assert.Empty(t, resp.Errors)
+}
+
+func TestErrorExtensions(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedErrorCoordinator{}}, opts...)
+
+	resp := schema.Exec(ctx, `mutation { createVersion(input: {versionName: "commit-sha"}) { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "SQL migration tenants/202002180000.sql failed with error: syntax error", resp.Errors[0].Message)
+	assert.Equal(t, map[string]interface{}{"code": ErrorCodeMigrationFailed, "file": "tenants/202002180000.sql", "schema": "abc", "statementIndex": 1, "dbErrorCode": "42601", "line": 2, "statementPosition": 18}, resp.Errors[0].Extensions)
+
+	resp = schema.Exec(ctx, `mutation { createTenant(input: {tenantName: "abc", versionName: "commit-sha"}) { version { id } } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"code": ErrorCodeMigrationInProgress}, resp.Errors[0].Extensions)
+
+	resp = schema.Exec(ctx, `query { version(id: 123) { id } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "Version not found ID: 123", resp.Errors[0].Message)
+	assert.Equal(t, map[string]interface{}{"code": ErrorCodeNotFound, "entity": "Version", "id": int32(123)}, resp.Errors[0].Extensions)
+
+	resp = schema.Exec(ctx, `query { sourceMigrations { file } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"code": ErrorCodeSourceLoadFailed, "baseLocation": "/migrations"}, resp.Errors[0].Extensions)
+
+	resp = schema.Exec(ctx, `query { verification { verified } }`, "", nil)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"code": ErrorCodeVerificationFailed, "outOfOrderMigrations": []string{}, "missingMigrations": []string{"source/201501010000.sql"}}, resp.Errors[0].Extensions)
+
+	// other errors are returned unchanged
+	assert.Nil(t, extendError(nil))
+	assert.Equal(t, ErrAsyncNotSupported, extendError(ErrAsyncNotSupported))
+}
+
+func TestFieldAttributes(t *testing.T) {
+	attributes := fieldAttributes("Mutation", "createTenant", map[string]interface{}{"input": map[string]interface{}{"name": "abc"}, "async": true})
+	assert.Equal(t, []tracing.Attribute{{Key: "graphql.type", Value: "Mutation"}, {Key: "graphql.field", Value: "createTenant"}, {Key: "graphql.args", Value: "async,input"}}, attributes)
+
+	attributes = fieldAttributes("Query", "tenants", nil)
+	assert.Equal(t, []tracing.Attribute{{Key: "graphql.type", Value: "Query"}, {Key: "graphql.field", Value: "tenants"}}, attributes)
+}
+
+func TestOperationLabel(t *testing.T) {
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.Tracer(Tracer{})}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	ctx := WithOperation(context.Background())
+	schema.Exec(ctx, `query Random { tenants { name } }`, "Random", nil)
+	assert.Equal(t, "tenants", OperationLabel(ctx))
+
+	ctx = WithOperation(context.Background())
+	schema.Exec(ctx, `query { tenants { name } versions { id } }`, "", nil)
+	assert.Equal(t, OperationOther, OperationLabel(ctx))
+
+	ctx = WithOperation(context.Background())
+	schema.Exec(ctx, `query { abc }`, "", nil)
+	assert.Equal(t, OperationOther, OperationLabel(ctx))
+
+	assert.Equal(t, OperationOther, OperationLabel(context.Background()))
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace"
+
+	"github.com/lukaszbudnik/migrator/tracing"
+)
+
+// OperationOther is returned by OperationLabel for requests which did not resolve exactly one root field
+const OperationOther = "other"
+
+// Tracer creates spans for GraphQL requests and non-trivial fields (fields which are resolved by resolver methods)
+// it also records root fields of executed operations, see WithOperation
+type Tracer struct{}
+
+type operationKey struct{}
+
+// operation contains root fields resolved by a single GraphQL request, root fields may be resolved concurrently
+type operation struct {
+	mutex      sync.Mutex
+	rootFields map[string]bool
+}
+
+// WithOperation returns context in which Tracer records root fields of executed GraphQL operation
+func WithOperation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, operationKey{}, &operation{rootFields: map[string]bool{}})
+}
+
+// OperationLabel returns name of the single root field resolved in context created by WithOperation
+// requests which failed to parse or validate or which resolved multiple root fields are returned as OperationOther,
+// unlike client-provided operation names root fields are defined by schema and can be safely used as metrics labels
+func OperationLabel(ctx context.Context) string {
+	op, ok := ctx.Value(operationKey{}).(*operation)
+	if !ok {
+		return OperationOther
+	}
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+	if len(op.rootFields) != 1 {
+		return OperationOther
+	}
+	for field := range op.rootFields {
+		return field
+	}
+	return OperationOther
+}
+
+// TraceQuery starts span for GraphQL request
+func (Tracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, trace.TraceQueryFinishFunc) {
+	ctx, span := tracing.StartSpan(ctx, "GraphQL request", tracing.Attribute{Key: "graphql.operationName", Value: operationName})
+	return ctx, func(errs []*errors.QueryError) {
+		if len(errs) > 0 {
+			message := errs[0].Error()
+			if len(errs) > 1 {
+				message += fmt.Sprintf(" (and %d more errors)", len(errs)-1)
+			}
+			span.SetError(message)
+		}
+		span.End()
+	}
+}
+
+// TraceField starts span for GraphQL field, trivial fields are not traced
+func (Tracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, trace.TraceFieldFinishFunc) {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok && (typeName == "Query" || typeName == "Mutation") {
+		op.mutex.Lock()
+		op.rootFields[fieldName] = true
+		op.mutex.Unlock()
+	}
+
+	if trivial {
+		return ctx, func(*errors.QueryError) {}
+	}
+
+	ctx, span := tracing.StartSpan(ctx, label, fieldAttributes(typeName, fieldName, args)...)
+	return ctx, func(err *errors.QueryError) {
+		if err != nil {
+			span.SetError(err.Error())
+		}
+		span.End()
+	}
+}
+
+// fieldAttributes returns span attributes of GraphQL field, argument values can contain tenant names
+// or repair reasons and are not exported, only sorted argument names are
+func fieldAttributes(typeName, fieldName string, args map[string]interface{}) []tracing.Attribute {
+	attributes := []tracing.Attribute{{Key: "graphql.type", Value: typeName}, {Key: "graphql.field", Value: fieldName}}
+	if len(args) == 0 {
+		return attributes
+	}
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(attributes, tracing.Attribute{Key: "graphql.args", Value: strings.Join(names, ",")})
+}
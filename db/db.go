@@ -2,34 +2,93 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
 
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/tracing"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
 // Connector interface abstracts all DB operations performed by migrator
 type Connector interface {
-	GetTenants() []types.Tenant
-	GetVersions() []types.Version
-	GetVersionsByFile(file string) []types.Version
+	GetTenants() ([]types.Tenant, error)
+	GetVersions() ([]types.Version, error)
+	GetVersionsByFile(file string) ([]types.Version, error)
 	GetVersionByID(ID int32) (*types.Version, error)
 	GetDBMigrationByID(ID int32) (*types.DBMigration, error)
 	// deprecated in v2020.1.0 sunset in v2021.1.0
-	GetAppliedMigrations() []types.MigrationDB
-	CreateVersion(string, types.Action, bool, []types.Migration) (*types.MigrationResults, *types.Version)
-	CreateTenant(string, types.Action, bool, string, []types.Migration) (*types.MigrationResults, *types.Version)
+	GetAppliedMigrations() ([]types.MigrationDB, error)
+	CreateVersion(string, string, types.Action, bool, []types.Migration) (*types.MigrationResults, *types.Version, error)
+	CreateTenant(string, string, types.Action, bool, string, []types.Migration) (*types.MigrationResults, *types.Version, error)
+	RevertVersion(string, bool, *types.Version) (*types.MigrationResults, *types.Version, error)
+	RepairChecksums(string, string, []types.Migration) (*types.Version, error)
+	PlanMigrations([]types.Migration) (*types.Plan, error)
+	GetHistoryEntries(types.HistoryTool, string) ([]types.HistoryEntry, error)
+	Lock() (func(), error)
 	Dispose()
 }
 
+// Pinger checks if DB is reachable
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// ErrMigrationInProgress is returned when migrator lock could not be acquired within configured timeout
+var ErrMigrationInProgress = errors.New("Another migration is in progress, please try again later")
+
+// ErrMigrationFailed is returned when SQL of a migration failed in a given schema
+// StatementIndex is 0-based index of failed statement in migration file
+// Code, Line and StatementPosition are set only when DB driver reports them, Line is 1-based line of migration file
+// and StatementPosition is 1-based character position in the failed statement
+type ErrMigrationFailed struct {
+	File              string
+	Schema            string
+	StatementIndex    int
+	Code              string
+	Line              int
+	StatementPosition int
+	Cause             error
+}
+
+func (e *ErrMigrationFailed) Error() string {
+	return fmt.Sprintf("SQL migration %v failed with error: %v", e.File, e.Cause.Error())
+}
+
+// Unwrap returns the underlying DB error
+func (e *ErrMigrationFailed) Unwrap() error {
+	return e.Cause
+}
+
+// ErrNotFound is returned when version or DB migration with a given ID does not exist
+type ErrNotFound struct {
+	Entity string
+	ID     int32
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("%v not found ID: %v", e.Entity, e.ID)
+}
+
+// ProgressKey is used together with context for setting/getting ProgressFunc
+type ProgressKey struct{}
+
+// ProgressFunc is called by Connector with a snapshot of results after every applied migration
+type ProgressFunc func(*types.MigrationResults)
+
 // baseConnector struct is a base struct for implementing DB specific dialects
 type baseConnector struct {
 	ctx     context.Context
@@ -42,73 +101,200 @@ type baseConnector struct {
 type Factory func(context.Context, *config.Config) Connector
 
 // New constructs Connector instance based on the passed Config
+// when DB cannot be connected to or initialised all methods of returned Connector return the error
 func New(ctx context.Context, config *config.Config) Connector {
 	dialect := newDialect(config)
+	if dialect == nil {
+		return &unavailableConnector{fmt.Errorf("Failed to create Connector unknown driver: %v", config.Driver)}
+	}
 	connector := &baseConnector{ctx, config, dialect, nil}
-	connector.connect()
-	connector.init()
+	if err := connector.connect(); err != nil {
+		common.LogError(ctx, "%v", err)
+		return &unavailableConnector{err}
+	}
+	if err := connector.init(); err != nil {
+		common.LogError(ctx, "%v", err)
+		connector.Dispose()
+		return &unavailableConnector{err}
+	}
 	return connector
 }
 
+// NewPinger returns Pinger which keeps a single long-lived DB connection
+// unlike New it does not initialise migrator schema and tables so it can be safely used by frequent readiness probes
+func NewPinger(config *config.Config) Pinger {
+	dialect := newDialect(config)
+	if dialect == nil {
+		return &unavailableConnector{fmt.Errorf("Failed to create Connector unknown driver: %v", config.Driver)}
+	}
+	connector := &baseConnector{context.Background(), config, dialect, nil}
+	if err := connector.connect(); err != nil {
+		return &unavailableConnector{err}
+	}
+	connector.db.SetMaxOpenConns(1)
+	return connector
+}
+
+// unavailableConnector is returned by New when DB cannot be connected to or initialised, all its methods return the error
+type unavailableConnector struct {
+	err error
+}
+
+func (uc *unavailableConnector) GetTenants() ([]types.Tenant, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetVersions() ([]types.Version, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetVersionsByFile(file string) ([]types.Version, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetVersionByID(ID int32) (*types.Version, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) CreateVersion(versionName, commitSha string, action types.Action, dryRun bool, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	return nil, nil, uc.err
+}
+
+func (uc *unavailableConnector) CreateTenant(versionName, commitSha string, action types.Action, dryRun bool, tenant string, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	return nil, nil, uc.err
+}
+
+func (uc *unavailableConnector) RevertVersion(versionName string, dryRun bool, version *types.Version) (*types.MigrationResults, *types.Version, error) {
+	return nil, nil, uc.err
+}
+
+func (uc *unavailableConnector) RepairChecksums(versionName, commitSha string, migrations []types.Migration) (*types.Version, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) PlanMigrations(migrations []types.Migration) (*types.Plan, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) GetHistoryEntries(tool types.HistoryTool, table string) ([]types.HistoryEntry, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) Lock() (func(), error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) PingContext(context.Context) error {
+	return uc.err
+}
+
+func (uc *unavailableConnector) Dispose() {
+}
+
 const (
 	migratorSchema           = "migrator"
 	migratorTenantsTable     = "migrator_tenants"
 	migratorMigrationsTable  = "migrator_migrations"
 	migratorVersionsTable    = "migrator_versions"
+	migratorJobsTable        = "migrator_jobs"
 	defaultSchemaPlaceHolder = "{schema}"
+	// migratorLockName is used by MySQL and MS SQL named locks
+	migratorLockName = "migrator"
+	// migratorLockID is used by PostgreSQL advisory locks which are identified by a number
+	migratorLockID         = 6378732
+	defaultLockWaitTimeout = 60
 )
 
+// lockRetryInterval is the interval between attempts to acquire migrator lock
+var lockRetryInterval = time.Second
+
 // connect connects to a database
-func (bc *baseConnector) connect() {
+func (bc *baseConnector) connect() error {
 	db, err := sql.Open(bc.config.Driver, bc.config.DataSource)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to open connction to DB: %v", err.Error()))
+		return fmt.Errorf("Failed to open connction to DB: %v", err.Error())
 	}
 	bc.db = db
+	return nil
 }
 
 // init initialises migrator by making sure proper schema/table are created
-func (bc *baseConnector) init() {
+func (bc *baseConnector) init() error {
 	if err := bc.db.Ping(); err != nil {
-		panic(fmt.Sprintf("Failed to connect to database: %v", err))
+		return fmt.Errorf("Failed to connect to database: %v", err)
 	}
 
 	tx, err := bc.db.Begin()
 	if err != nil {
-		panic(fmt.Sprintf("Could not start DB transaction: %v", err))
+		return fmt.Errorf("Could not start DB transaction: %v", err)
 	}
+	// rollback after successful commit is a no-op
+	defer tx.Rollback()
 
 	// make sure migrator schema exists
 	createSchema := bc.dialect.GetCreateSchemaSQL(migratorSchema)
-	if _, err := bc.db.Query(createSchema); err != nil {
-		panic(fmt.Sprintf("Could not create migrator schema: %v", err))
+	if _, err := bc.db.Exec(createSchema); err != nil {
+		return fmt.Errorf("Could not create migrator schema: %v", err)
 	}
 
 	// make sure migrations table exists
 	createMigrationsTable := bc.dialect.GetCreateMigrationsTableSQL()
-	if _, err := bc.db.Query(createMigrationsTable); err != nil {
-		panic(fmt.Sprintf("Could not create migrations table: %v", err))
+	if _, err := bc.db.Exec(createMigrationsTable); err != nil {
+		return fmt.Errorf("Could not create migrations table: %v", err)
 	}
 
 	// make sure versions table exists
 	createVersionsTableSQLs := bc.dialect.GetCreateVersionsTableSQL()
 	for _, createVersionsTableSQL := range createVersionsTableSQLs {
-		if _, err := bc.db.Query(createVersionsTableSQL); err != nil {
-			panic(fmt.Sprintf("Could not create versions table: %v", err))
+		if _, err := bc.db.Exec(createVersionsTableSQL); err != nil {
+			return fmt.Errorf("Could not create versions table: %v", err)
+		}
+	}
+
+	// make sure down contents column exists
+	addDownContentsColumnSQLs := bc.dialect.GetAddDownContentsColumnSQL()
+	for _, addDownContentsColumnSQL := range addDownContentsColumnSQLs {
+		if _, err := bc.db.Exec(addDownContentsColumnSQL); err != nil {
+			return fmt.Errorf("Could not add down contents column: %v", err)
+		}
+	}
+
+	// make sure commit sha column exists
+	addCommitShaColumnSQLs := bc.dialect.GetAddCommitShaColumnSQL()
+	for _, addCommitShaColumnSQL := range addCommitShaColumnSQLs {
+		if _, err := bc.db.Exec(addCommitShaColumnSQL); err != nil {
+			return fmt.Errorf("Could not add commit sha column: %v", err)
+		}
+	}
+
+	// make sure tenants column exists
+	addTenantsColumnSQLs := bc.dialect.GetAddTenantsColumnSQL()
+	for _, addTenantsColumnSQL := range addTenantsColumnSQLs {
+		if _, err := bc.db.Exec(addTenantsColumnSQL); err != nil {
+			return fmt.Errorf("Could not add tenants column: %v", err)
 		}
 	}
 
 	// if using default migrator tenants table make sure it exists
 	if bc.config.TenantSelectSQL == "" {
 		createTenantsTable := bc.dialect.GetCreateTenantsTableSQL()
-		if _, err := bc.db.Query(createTenantsTable); err != nil {
-			panic(fmt.Sprintf("Could not create default tenants table: %v", err))
+		if _, err := bc.db.Exec(createTenantsTable); err != nil {
+			return fmt.Errorf("Could not create default tenants table: %v", err)
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		panic(fmt.Sprintf("Could not commit transaction: %v", err))
+		return fmt.Errorf("Could not commit transaction: %v", err)
 	}
+	return nil
 }
 
 // Dispose closes all resources allocated by connector
@@ -118,6 +304,64 @@ func (bc *baseConnector) Dispose() {
 	}
 }
 
+// PingContext verifies that connection to DB is still alive
+func (bc *baseConnector) PingContext(ctx context.Context) error {
+	return bc.db.PingContext(ctx)
+}
+
+// Lock acquires DB-wide migrator lock which prevents concurrent migrations,
+// the lock is held by a dedicated DB connection until the returned function is called
+// if lock cannot be acquired within configured timeout ErrMigrationInProgress is returned
+func (bc *baseConnector) Lock() (func(), error) {
+	conn, err := bc.db.Conn(bc.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get DB connection for migrator lock: %v", err)
+	}
+
+	lockSQL := bc.dialect.GetLockSQL()
+	deadline := time.Now().Add(time.Duration(bc.getLockWaitTimeout()) * time.Second)
+	for {
+		var acquired int
+		if err := conn.QueryRowContext(bc.ctx, lockSQL).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Could not acquire migrator lock: %v", err)
+		}
+		if acquired == 1 {
+			break
+		}
+		if time.Now().Add(lockRetryInterval).After(deadline) {
+			conn.Close()
+			common.LogError(bc.ctx, "Could not acquire migrator lock within %v seconds", bc.getLockWaitTimeout())
+			return nil, ErrMigrationInProgress
+		}
+		common.LogInfo(bc.ctx, "Migrator lock is held by another migration, waiting")
+		time.Sleep(lockRetryInterval)
+	}
+
+	common.LogInfo(bc.ctx, "Migrator lock acquired")
+
+	unlock := func() {
+		// lock must be released even if the request context was cancelled
+		if _, err := conn.ExecContext(context.Background(), bc.dialect.GetUnlockSQL()); err != nil {
+			common.LogError(bc.ctx, "Could not release migrator lock: %v", err)
+		} else {
+			common.LogInfo(bc.ctx, "Migrator lock released")
+		}
+		conn.Close()
+	}
+
+	return unlock, nil
+}
+
+// getLockWaitTimeout returns lock wait timeout in seconds
+// which is either the default one or overridden by user in config
+func (bc *baseConnector) getLockWaitTimeout() int {
+	if bc.config.LockWaitTimeout > 0 {
+		return bc.config.LockWaitTimeout
+	}
+	return defaultLockWaitTimeout
+}
+
 // getTenantSelectSQL returns SQL to be executed to list all DB tenants
 func (bc *baseConnector) getTenantSelectSQL() string {
 	var tenantSelectSQL string
@@ -130,44 +374,53 @@ func (bc *baseConnector) getTenantSelectSQL() string {
 }
 
 // GetTenants returns a list of all DB tenants
-func (bc *baseConnector) GetTenants() []types.Tenant {
+func (bc *baseConnector) GetTenants() ([]types.Tenant, error) {
+	_, span := tracing.StartSpan(bc.ctx, "db.GetTenants")
+	defer span.End()
+
 	tenantSelectSQL := bc.getTenantSelectSQL()
 
 	tenants := []types.Tenant{}
 
 	rows, err := bc.db.Query(tenantSelectSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query tenants: %v", err))
+		span.SetError(err.Error())
+		return nil, fmt.Errorf("Could not query tenants: %v", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var name string
 		if err = rows.Scan(&name); err != nil {
-			panic(fmt.Sprintf("Could not read tenants: %v", err))
+			span.SetError(err.Error())
+			return nil, fmt.Errorf("Could not read tenants: %v", err)
 		}
 		tenants = append(tenants, types.Tenant{Name: name})
 	}
 
-	return tenants
+	metrics.SetTenants(len(tenants))
+	span.SetAttributes(tracing.Attribute{Key: "tenants", Value: len(tenants)})
+
+	return tenants, nil
 }
 
-func (bc *baseConnector) GetVersions() []types.Version {
+func (bc *baseConnector) GetVersions() ([]types.Version, error) {
 	versionsSelectSQL := bc.dialect.GetVersionsSelectSQL()
 
 	rows, err := bc.db.Query(versionsSelectSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("Could not query versions: %v", err)
 	}
 
 	return bc.readVersions(rows)
 }
 
-func (bc *baseConnector) GetVersionsByFile(file string) []types.Version {
+func (bc *baseConnector) GetVersionsByFile(file string) ([]types.Version, error) {
 	versionsSelectSQL := bc.dialect.GetVersionsByFileSQL()
 
 	rows, err := bc.db.Query(versionsSelectSQL, file)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("Could not query versions: %v", err)
 	}
 
 	return bc.readVersions(rows)
@@ -178,71 +431,98 @@ func (bc *baseConnector) GetVersionByID(ID int32) (*types.Version, error) {
 
 	rows, err := bc.db.Query(versionsSelectSQL, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("Could not query versions: %v", err)
 	}
 
-	// readVersions is generic and returns a slice of Version objects
-	// we are querying by ID and are interested in only the first one
-	versions := bc.readVersions(rows)
-
-	if len(versions) == 0 {
-		return nil, fmt.Errorf("Version not found ID: %v", ID)
-	}
-
-	return &versions[0], nil
+	return bc.firstVersion(rows, ID)
 }
 
-func (bc *baseConnector) getVersionByIDInTx(tx *sql.Tx, ID int32) *types.Version {
+func (bc *baseConnector) getVersionByIDInTx(tx *sql.Tx, ID int32) (*types.Version, error) {
 	versionsSelectSQL := bc.dialect.GetVersionByIDSQL()
 
 	rows, err := tx.Query(versionsSelectSQL, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query versions: %v", err))
+		return nil, fmt.Errorf("Could not query versions: %v", err)
 	}
 
+	return bc.firstVersion(rows, ID)
+}
+
+// firstVersion returns version read from rows returned by a query by ID
+func (bc *baseConnector) firstVersion(rows *sql.Rows, ID int32) (*types.Version, error) {
 	// readVersions is generic and returns a slice of Version objects
 	// we are querying by ID and are interested in only the first one
-	versions := bc.readVersions(rows)
+	versions, err := bc.readVersions(rows)
+	if err != nil {
+		return nil, err
+	}
 
-	// when running in transaction version must be found
 	if len(versions) == 0 {
-		panic(fmt.Sprintf("Version not found ID: %v", ID))
+		return nil, &ErrNotFound{Entity: "Version", ID: ID}
 	}
 
-	return &versions[0]
+	return &versions[0], nil
 }
 
-func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
+// readVersions reads and closes rows returned by versions queries
+func (bc *baseConnector) readVersions(rows *sql.Rows) ([]types.Version, error) {
+	defer rows.Close()
+
 	versions := []types.Version{}
 	versionsMap := map[int64]*types.Version{}
 
 	for rows.Next() {
+		// migration columns come from left join and are null for versions without migrations
+		// (for example when all version's migrations were reverted)
 		var (
 			vid           int64
 			vname         string
 			vcreated      time.Time
-			mid           int64
-			name          string
-			sourceDir     string
-			filename      string
-			migrationType types.MigrationType
-			schema        string
-			created       time.Time
-			contents      string
-			checksum      string
+			vcommitSha    sql.NullString
+			vtenants      sql.NullString
+			mid           sql.NullInt64
+			name          sql.NullString
+			sourceDir     sql.NullString
+			filename      sql.NullString
+			migrationType sql.NullInt64
+			schema        sql.NullString
+			created       *time.Time
+			contents      sql.NullString
+			checksum      sql.NullString
+			downContents  sql.NullString
 		)
 
-		if err := rows.Scan(&vid, &vname, &vcreated, &mid, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-			panic(fmt.Sprintf("Could not read versions: %v", err))
+		if err := rows.Scan(&vid, &vname, &vcreated, &vcommitSha, &vtenants, &mid, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum, &downContents); err != nil {
+			return nil, fmt.Errorf("Could not read versions: %v", err)
 		}
 		if versionsMap[vid] == nil {
-			version := types.Version{ID: int32(vid), Name: vname, Created: graphql.Time{Time: vcreated}}
+			version := types.Version{ID: int32(vid), Name: vname, Created: graphql.Time{Time: vcreated}, CommitSha: vcommitSha.String, DBMigrations: []types.DBMigration{}, SucceededTenants: []string{}, FailedTenants: []types.FailedTenant{}, State: types.VersionStateSucceeded}
+			if vtenants.Valid {
+				var tenants versionTenants
+				if err := json.Unmarshal([]byte(vtenants.String), &tenants); err != nil {
+					return nil, fmt.Errorf("Could not read version tenants: %v", err)
+				}
+				if tenants.SucceededTenants != nil {
+					version.SucceededTenants = tenants.SucceededTenants
+				}
+				if tenants.FailedTenants != nil {
+					version.FailedTenants = tenants.FailedTenants
+				}
+				// versions stored before state was introduced don't have it
+				if len(tenants.State) > 0 {
+					version.State = tenants.State
+				}
+			}
 			versionsMap[vid] = &version
 		}
 
+		if !mid.Valid {
+			continue
+		}
+
 		version := versionsMap[vid]
-		migration := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
-		version.DBMigrations = append(version.DBMigrations, types.MigrationDB{Migration: migration, ID: int32(mid), Schema: schema, AppliedAt: graphql.Time{Time: created}, Created: graphql.Time{Time: created}})
+		migration := types.Migration{Name: name.String, SourceDir: sourceDir.String, File: filename.String, MigrationType: types.MigrationType(migrationType.Int64), Contents: contents.String, CheckSum: checksum.String, DownContents: downContents.String}
+		version.DBMigrations = append(version.DBMigrations, types.MigrationDB{Migration: migration, ID: int32(mid.Int64), Schema: schema.String, AppliedAt: graphql.Time{Time: *created}, Created: graphql.Time{Time: *created}})
 	}
 
 	// map to versions
@@ -253,7 +533,7 @@ func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
 	sort.Slice(versions, func(i, j int) bool {
 		return versions[i].ID > versions[j].ID
 	})
-	return versions
+	return versions, nil
 }
 
 func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
@@ -261,11 +541,12 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 
 	rows, err := bc.db.Query(query, ID)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
+		return nil, fmt.Errorf("Could not query DB migrations: %v", err.Error())
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
-		return nil, fmt.Errorf("DB migration not found ID: %v", ID)
+		return nil, &ErrNotFound{Entity: "DB migration", ID: ID}
 	}
 
 	var (
@@ -278,26 +559,28 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 		created       time.Time
 		contents      string
 		checksum      string
+		downContents  sql.NullString
 	)
-	if err = rows.Scan(&id, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-		panic(fmt.Sprintf("Could not read DB migration: %v", err.Error()))
+	if err = rows.Scan(&id, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum, &downContents); err != nil {
+		return nil, fmt.Errorf("Could not read DB migration: %v", err.Error())
 	}
-	m := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
+	m := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum, DownContents: downContents.String}
 	db := types.MigrationDB{Migration: m, ID: int32(id), Schema: schema, AppliedAt: graphql.Time{Time: created}, Created: graphql.Time{Time: created}}
 
 	return &db, nil
 }
 
 // GetAppliedMigrations returns a list of all applied DB migrations
-func (bc *baseConnector) GetAppliedMigrations() []types.MigrationDB {
+func (bc *baseConnector) GetAppliedMigrations() ([]types.MigrationDB, error) {
 	query := bc.dialect.GetMigrationSelectSQL()
 
 	dbMigrations := []types.MigrationDB{}
 
 	rows, err := bc.db.Query(query)
 	if err != nil {
-		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
+		return nil, fmt.Errorf("Could not query DB migrations: %v", err.Error())
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var (
@@ -309,106 +592,247 @@ func (bc *baseConnector) GetAppliedMigrations() []types.MigrationDB {
 			created       time.Time
 			contents      string
 			checksum      string
+			downContents  sql.NullString
 		)
-		if err = rows.Scan(&name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
-			panic(fmt.Sprintf("Could not read DB migration: %v", err.Error()))
+		if err = rows.Scan(&name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum, &downContents); err != nil {
+			return nil, fmt.Errorf("Could not read DB migration: %v", err.Error())
 		}
-		mdef := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
+		mdef := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum, DownContents: downContents.String}
 		dbMigrations = append(dbMigrations, types.MigrationDB{Migration: mdef, Schema: schema, AppliedAt: graphql.Time{Time: created}, Created: graphql.Time{Time: created}})
 	}
-	return dbMigrations
+	return dbMigrations, nil
+}
+
+// GetHistoryEntries returns entries of Flyway or Liquibase history table in the order they were applied
+func (bc *baseConnector) GetHistoryEntries(tool types.HistoryTool, table string) ([]types.HistoryEntry, error) {
+	var query string
+	if tool == types.HistoryToolLiquibase {
+		query = bc.dialect.GetLiquibaseHistorySelectSQL(table)
+	} else {
+		query = bc.dialect.GetFlywayHistorySelectSQL(table)
+	}
+
+	rows, err := bc.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("Could not query %v history table %v: %v", tool, table, err.Error())
+	}
+	defer rows.Close()
+
+	entries := []types.HistoryEntry{}
+	for rows.Next() {
+		var entry types.HistoryEntry
+		if tool == types.HistoryToolLiquibase {
+			var md5sum sql.NullString
+			if err = rows.Scan(&entry.Version, &entry.Description, &entry.Script, &md5sum, &entry.Type); err != nil {
+				return nil, fmt.Errorf("Could not read %v history entry: %v", tool, err.Error())
+			}
+			entry.CheckSum = md5sum.String
+			entry.Success = entry.Type != "FAILED"
+		} else {
+			// repeatable migrations have no version, Flyway's own entries have no checksum
+			var version sql.NullString
+			var checksum sql.NullInt64
+			if err = rows.Scan(&version, &entry.Description, &entry.Script, &checksum, &entry.Type, &entry.Success); err != nil {
+				return nil, fmt.Errorf("Could not read %v history entry: %v", tool, err.Error())
+			}
+			entry.Version = version.String
+			if checksum.Valid {
+				entry.CheckSum = fmt.Sprintf("%d", checksum.Int64)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
 }
 
 // CreateVersion creates new DB version and applies passed migrations
-func (bc *baseConnector) CreateVersion(versionName string, action types.Action, dryRun bool, migrations []types.Migration) (*types.MigrationResults, *types.Version) {
+func (bc *baseConnector) CreateVersion(versionName, commitSha string, action types.Action, dryRun bool, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
 	if len(migrations) == 0 {
 		return &types.MigrationResults{
 			StartedAt: graphql.Time{Time: time.Now()},
 			Duration:  0,
-		}, nil
+		}, nil, nil
 	}
 
-	tenants := bc.GetTenants()
-
-	tx, err := bc.db.Begin()
+	ctx := common.WithFields(bc.ctx, common.Field{Key: common.FieldVersionName, Value: versionName})
+	tenants, err := bc.GetTenants()
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		return nil, nil, err
 	}
 
-	defer func() {
-		r := recover()
-		if r == nil {
-			if dryRun {
-				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
-				tx.Rollback()
-			} else {
-				common.LogInfo(bc.ctx, "Running %v, committing transaction", action)
-				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
-				}
-			}
-		} else {
-			common.LogInfo(bc.ctx, "Recovered in CreateVersion. Transaction rollback.")
-			tx.Rollback()
-			panic(r)
-		}
-	}()
+	// dry-run always uses a single transaction which is rolled back
+	if !dryRun && bc.config.TransactionStrategy != "" && bc.config.TransactionStrategy != config.TransactionStrategySingle {
+		return bc.applyMigrationsPerTenant(ctx, versionName, commitSha, action, tenants, migrations)
+	}
 
-	results, versionID := bc.applyMigrationsInTx(tx, versionName, action, tenants, migrations)
-	version := bc.getVersionByIDInTx(tx, int32(versionID))
+	var results *types.MigrationResults
+	var version *types.Version
+	err = bc.inTx(ctx, dryRun, func(tx *sql.Tx) error {
+		var versionID int64
+		var err error
+		if results, versionID, err = bc.applyMigrationsInTx(ctx, tx, versionName, commitSha, action, tenants, migrations); err != nil {
+			return err
+		}
+		version, err = bc.getVersionByIDInTx(tx, int32(versionID))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return results, version
+	return results, version, nil
 }
 
 // CreateTenant creates new tenant and applies passed tenant migrations
-func (bc *baseConnector) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string, migrations []types.Migration) (*types.MigrationResults, *types.Version) {
+func (bc *baseConnector) CreateTenant(versionName, commitSha string, action types.Action, dryRun bool, tenant string, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	ctx := common.WithFields(bc.ctx, common.Field{Key: common.FieldVersionName, Value: versionName}, common.Field{Key: common.FieldTenant, Value: tenant})
 	tenantInsertSQL := bc.getTenantInsertSQL()
 
-	tx, err := bc.db.Begin()
+	var results *types.MigrationResults
+	var version *types.Version
+	err := bc.inTx(ctx, dryRun, func(tx *sql.Tx) error {
+		createSchema := bc.dialect.GetCreateSchemaSQL(tenant)
+		if _, err := tx.Exec(createSchema); err != nil {
+			return fmt.Errorf("Create schema failed: %v", err)
+		}
+
+		insert, err := bc.db.Prepare(tenantInsertSQL)
+		if err != nil {
+			return fmt.Errorf("Could not create prepared statement: %v", err)
+		}
+
+		if _, err = tx.Stmt(insert).Exec(tenant); err != nil {
+			return fmt.Errorf("Failed to add tenant entry: %v", err)
+		}
+
+		tenantStruct := types.Tenant{Name: tenant}
+		var versionID int64
+		if results, versionID, err = bc.applyMigrationsInTx(ctx, tx, versionName, commitSha, action, []types.Tenant{tenantStruct}, migrations); err != nil {
+			return err
+		}
+
+		version, err = bc.getVersionByIDInTx(tx, int32(versionID))
+		return err
+	})
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		return nil, nil, err
 	}
 
-	defer func() {
-		r := recover()
-		if r == nil {
-			if dryRun {
-				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
-				tx.Rollback()
-			} else {
-				common.LogInfo(bc.ctx, "Running %v action, committing transaction", action)
-				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
-				}
-			}
-		} else {
-			common.LogInfo(bc.ctx, "Recovered in CreateTenant. Transaction rollback.")
-			tx.Rollback()
-			panic(r)
+	return results, version, nil
+}
+
+// RevertVersion executes down migrations of all migrations applied in passed version in reverse order,
+// removes reverted migrations from migrator migrations table and records executed down migrations as a new DB version
+func (bc *baseConnector) RevertVersion(versionName string, dryRun bool, version *types.Version) (*types.MigrationResults, *types.Version, error) {
+	ctx := common.WithFields(bc.ctx, common.Field{Key: common.FieldVersionName, Value: versionName})
+
+	var results *types.MigrationResults
+	var revertVersion *types.Version
+	err := bc.inTx(ctx, dryRun, func(tx *sql.Tx) error {
+		var versionID int64
+		var err error
+		if results, versionID, err = bc.revertMigrationsInTx(ctx, tx, versionName, version); err != nil {
+			return err
 		}
-	}()
+		revertVersion, err = bc.getVersionByIDInTx(tx, int32(versionID))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return results, revertVersion, nil
+}
 
-	createSchema := bc.dialect.GetCreateSchemaSQL(tenant)
-	if _, err = tx.Exec(createSchema); err != nil {
-		panic(fmt.Sprintf("Create schema failed: %v", err))
+// RepairChecksums updates contents and checksums of passed applied migrations in all schemas and records the repair as a new DB version
+// repaired migrations stay in versions in which they were applied, the new version has no DB migrations
+func (bc *baseConnector) RepairChecksums(versionName, commitSha string, migrations []types.Migration) (*types.Version, error) {
+	updateChecksumSQL := bc.dialect.GetMigrationChecksumUpdateSQL()
+	update, err := bc.db.Prepare(updateChecksumSQL)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create prepared statement for migration checksum update: %v", err)
 	}
 
-	insert, err := bc.db.Prepare(tenantInsertSQL)
+	ctx := common.WithFields(bc.ctx, common.Field{Key: common.FieldVersionName, Value: versionName})
+	var version *types.Version
+	err = bc.inTx(ctx, false, func(tx *sql.Tx) error {
+		versionID, err := bc.insertVersionInTx(tx, versionName, commitSha)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			common.LogInfo(common.WithFields(ctx, common.Field{Key: common.FieldFile, Value: m.File}), "Repairing checksum, new checksum: %v", m.CheckSum)
+			if _, err := tx.Stmt(update).Exec(m.Contents, m.CheckSum, m.File); err != nil {
+				return fmt.Errorf("Failed to update migration entry: %v", err.Error())
+			}
+		}
+		version, err = bc.getVersionByIDInTx(tx, int32(versionID))
+		return err
+	})
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement: %v", err))
+		return nil, err
 	}
 
-	_, err = tx.Stmt(insert).Exec(tenant)
+	return version, nil
+}
+
+// PlanMigrations returns schemas and SQL which would be executed when applying passed migrations,
+// it only reads tenants and applied migrations and does not open any transaction
+func (bc *baseConnector) PlanMigrations(migrations []types.Migration) (*types.Plan, error) {
+	tenants, err := bc.GetTenants()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to add tenant entry: %v", err))
+		return nil, err
+	}
+
+	// with per-tenant and per-migration transaction strategies tenant migrations are applied only to tenants which don't have them yet
+	perTenant := bc.config.TransactionStrategy != "" && bc.config.TransactionStrategy != config.TransactionStrategySingle
+	applied := map[string]map[string]bool{}
+	if perTenant {
+		if applied, err = bc.getAppliedMigrationsBySchema(); err != nil {
+			return nil, err
+		}
 	}
 
-	tenantStruct := types.Tenant{Name: tenant}
-	results, versionID := bc.applyMigrationsInTx(tx, versionName, action, []types.Tenant{tenantStruct}, migrations)
+	plan := &types.Plan{Tenants: int32(len(tenants)), Migrations: []types.PlannedMigration{}}
+	for _, m := range migrations {
+		var schemas []string
+		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+			for _, t := range tenants {
+				if m.MigrationType == types.MigrationTypeTenantMigration && applied[t.Name][m.File] {
+					continue
+				}
+				schemas = append(schemas, t.Name)
+			}
+		} else {
+			schemas = []string{filepath.Base(m.SourceDir)}
+		}
 
-	version := bc.getVersionByIDInTx(tx, int32(versionID))
+		planned := types.PlannedMigration{Migration: m, Schemas: []types.PlannedSchema{}}
+		for _, s := range schemas {
+			sql := bc.dialect.ReplaceSchemaPlaceHolder(m.Contents, bc.getSchemaPlaceHolder(), s)
+			planned.Schemas = append(planned.Schemas, types.PlannedSchema{Schema: s, SQL: sql})
+		}
+		plan.Migrations = append(plan.Migrations, planned)
+	}
+
+	return plan, nil
+}
 
-	return results, version
+// getAppliedMigrationsBySchema returns files of applied migrations grouped by schema
+func (bc *baseConnector) getAppliedMigrationsBySchema() (map[string]map[string]bool, error) {
+	dbMigrations, err := bc.GetAppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]map[string]bool{}
+	for _, m := range dbMigrations {
+		if applied[m.Schema] == nil {
+			applied[m.Schema] = map[string]bool{}
+		}
+		applied[m.Schema][m.File] = true
+	}
+	return applied, nil
 }
 
 // getTenantInsertSQL returns tenant insert SQL statement from configuration file
@@ -437,7 +861,7 @@ func (bc *baseConnector) getSchemaPlaceHolder() string {
 	return schemaPlaceHolder
 }
 
-func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration) (*types.MigrationResults, int64) {
+func (bc *baseConnector) applyMigrationsInTx(ctx context.Context, tx *sql.Tx, versionName, commitSha string, action types.Action, tenants []types.Tenant, migrations []types.Migration) (*types.MigrationResults, int64, error) {
 
 	results := &types.MigrationResults{
 		StartedAt: graphql.Time{Time: time.Now()},
@@ -450,26 +874,15 @@ func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, act
 		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
 	}()
 
-	schemaPlaceHolder := bc.getSchemaPlaceHolder()
-
-	var versionID int64
-	versionInsertSQL := bc.dialect.GetVersionInsertSQL()
-	versionInsert, err := bc.db.Prepare(versionInsertSQL)
+	versionID, err := bc.insertVersionInTx(tx, versionName, commitSha)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement for version: %v", err))
-	}
-	stmt := tx.Stmt(versionInsert)
-	if bc.dialect.LastInsertIDSupported() {
-		result, _ := stmt.Exec(versionName)
-		versionID, _ = result.LastInsertId()
-	} else {
-		stmt.QueryRow(versionName).Scan(&versionID)
+		return nil, 0, err
 	}
 
 	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
 	insert, err := bc.db.Prepare(insertMigrationSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+		return nil, 0, fmt.Errorf("Could not create prepared statement for migration: %v", err)
 	}
 
 	for _, m := range migrations {
@@ -483,17 +896,8 @@ func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, act
 		}
 
 		for _, s := range schemas {
-			common.LogInfo(bc.ctx, "Applying migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
-
-			if action == types.ActionApply {
-				contents := strings.Replace(m.Contents, schemaPlaceHolder, s, -1)
-				if _, err = tx.Exec(contents); err != nil {
-					panic(fmt.Sprintf("SQL migration %v failed with error: %v", m.File, err.Error()))
-				}
-			}
-
-			if _, err = tx.Stmt(insert).Exec(m.Name, m.SourceDir, m.File, m.MigrationType, s, m.Contents, m.CheckSum, versionID); err != nil {
-				panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
+			if err := bc.applyMigrationInTx(ctx, tx, insert, action, m, s, versionID); err != nil {
+				return nil, 0, err
 			}
 		}
 
@@ -512,7 +916,489 @@ func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, act
 			results.TenantScriptsTotal += int32(len(schemas))
 		}
 
+		bc.reportProgress(results)
+	}
+
+	return results, versionID, nil
+}
+
+// reportProgress passes a snapshot of results to ProgressFunc stored in context, if any
+func (bc *baseConnector) reportProgress(results *types.MigrationResults) {
+	progress, ok := bc.ctx.Value(ProgressKey{}).(ProgressFunc)
+	if !ok {
+		return
+	}
+	snapshot := *results
+	snapshot.Duration = int32(time.Now().Sub(results.StartedAt.Time))
+	snapshot.MigrationsGrandTotal = snapshot.TenantMigrationsTotal + snapshot.SingleMigrations
+	snapshot.ScriptsGrandTotal = snapshot.TenantScriptsTotal + snapshot.SingleScripts
+	snapshot.SucceededTenants = append([]string{}, results.SucceededTenants...)
+	snapshot.FailedTenants = append([]types.FailedTenant{}, results.FailedTenants...)
+	progress(&snapshot)
+}
+
+// applyMigrationInTx applies (or only records when synchronising) migration in passed schema
+// failed SQL migrations are returned as ErrMigrationFailed
+func (bc *baseConnector) applyMigrationInTx(ctx context.Context, tx *sql.Tx, insert *sql.Stmt, action types.Action, m types.Migration, schema string, versionID int64) error {
+	ctx = migrationContext(ctx, m, schema)
+	ctx, span := tracing.StartSpan(ctx, "db.ApplyMigration", migrationSpanAttributes(m, schema, action.String())...)
+	defer span.End()
+
+	if action == types.ActionApply {
+		common.LogDebug(ctx, "Applying migration type: %d", m.MigrationType)
+		started := time.Now()
+		contents := bc.dialect.ReplaceSchemaPlaceHolder(m.Contents, bc.getSchemaPlaceHolder(), schema)
+		if err := bc.execStatements(ctx, tx, m.File, schema, contents); err != nil {
+			span.SetError(err.Error())
+			return err
+		}
+		metrics.ObserveMigration(m.MigrationType, m.File, started)
+		common.LogInfo(common.WithFields(ctx, common.Field{Key: common.FieldDuration, Value: time.Since(started)}), "Applied migration type: %d", m.MigrationType)
+	} else {
+		common.LogInfo(ctx, "Synchronised migration type: %d", m.MigrationType)
+	}
+
+	if _, err := tx.Stmt(insert).Exec(m.Name, m.SourceDir, m.File, m.MigrationType, schema, m.Contents, m.CheckSum, versionID, m.DownContents); err != nil {
+		span.SetError(err.Error())
+		return fmt.Errorf("Failed to add migration entry: %v", err.Error())
+	}
+	return nil
+}
+
+// migrationSpanAttributes returns attributes of span created for migration executed in a given schema
+func migrationSpanAttributes(m types.Migration, schema, action string) []tracing.Attribute {
+	return []tracing.Attribute{
+		{Key: common.FieldFile, Value: m.File},
+		{Key: common.FieldSchema, Value: schema},
+		{Key: "migrationType", Value: m.MigrationType},
+		{Key: "action", Value: action},
+	}
+}
+
+// migrationContext returns context with migration file and tenant (for tenant migrations and scripts) or schema log fields
+func migrationContext(ctx context.Context, m types.Migration, schema string) context.Context {
+	schemaField := common.Field{Key: common.FieldSchema, Value: schema}
+	if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+		schemaField.Key = common.FieldTenant
+	}
+	return common.WithFields(ctx, common.Field{Key: common.FieldFile, Value: m.File}, schemaField)
+}
+
+// applyMigrationsPerTenant applies migrations using per-tenant or per-migration transaction strategy.
+// Version and single schema migrations are committed first and are always fatal when they fail.
+// Tenant migrations are then applied to every tenant in separate transactions
+// and a failure of one tenant does not affect other tenants.
+// Tenant migrations which were already applied to a given tenant are skipped
+// which allows to retry tenants which failed previously.
+func (bc *baseConnector) applyMigrationsPerTenant(ctx context.Context, versionName, commitSha string, action types.Action, tenants []types.Tenant, migrations []types.Migration) (*types.MigrationResults, *types.Version, error) {
+	perMigration := bc.config.TransactionStrategy == config.TransactionStrategyPerMigration
+
+	results := &types.MigrationResults{
+		StartedAt:        graphql.Time{Time: time.Now()},
+		Tenants:          int32(len(tenants)),
+		SucceededTenants: []string{},
+		FailedTenants:    []types.FailedTenant{},
+	}
+
+	defer func() {
+		results.Duration = int32(time.Now().Sub(results.StartedAt.Time))
+		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+	}()
+
+	applied, err := bc.getAppliedMigrationsBySchema()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var singleMigrations, tenantMigrations []types.Migration
+	for _, m := range migrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+			tenantMigrations = append(tenantMigrations, m)
+		} else {
+			singleMigrations = append(singleMigrations, m)
+		}
+	}
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.Prepare(insertMigrationSQL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not create prepared statement for migration: %v", err)
+	}
+
+	var versionID int64
+	err = bc.inTx(ctx, false, func(tx *sql.Tx) error {
+		var err error
+		if versionID, err = bc.insertVersionInTx(tx, versionName, commitSha); err != nil {
+			return err
+		}
+		if !perMigration {
+			for _, m := range singleMigrations {
+				if err := bc.applyMigrationInTx(ctx, tx, insert, action, m, filepath.Base(m.SourceDir), versionID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, m := range singleMigrations {
+		if perMigration {
+			if err := bc.inTx(ctx, false, func(tx *sql.Tx) error {
+				return bc.applyMigrationInTx(ctx, tx, insert, action, m, filepath.Base(m.SourceDir), versionID)
+			}); err != nil {
+				// version and migrations applied so far are already committed
+				if err := bc.updateVersionTenants(versionID, results, types.VersionStateFailed); err != nil {
+					return nil, nil, err
+				}
+				return nil, nil, err
+			}
+		}
+		if m.MigrationType == types.MigrationTypeSingleMigration {
+			results.SingleMigrations++
+		}
+		if m.MigrationType == types.MigrationTypeSingleScript {
+			results.SingleScripts++
+		}
+		bc.reportProgress(results)
+	}
+
+	tenantMigrationFiles := map[string]bool{}
+	tenantScriptFiles := map[string]bool{}
+
+	// tenants are migrated in parallel by a bounded pool of workers, every worker uses its own connection
+	// outcomes are stored by tenant index so that reported tenants keep the order of tenants
+	outcomes := make([]tenantOutcome, len(tenants))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	// progress is reported in order in which tenants finish
+	var mutex sync.Mutex
+	progress := *results
+	for w := 0; w < bc.getTenantConcurrency(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outcome := bc.applyTenantMigrations(ctx, insert, action, tenants[i], tenantMigrations, applied[tenants[i].Name], perMigration, versionID)
+				outcomes[i] = outcome
+				mutex.Lock()
+				outcome.addTo(&progress, tenants[i])
+				bc.reportProgress(&progress)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := range tenants {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, outcome := range outcomes {
+		outcome.addTo(results, tenants[i])
+		for _, m := range outcome.succeeded {
+			if m.MigrationType == types.MigrationTypeTenantMigration {
+				tenantMigrationFiles[m.File] = true
+			} else {
+				tenantScriptFiles[m.File] = true
+			}
+		}
+	}
+
+	results.TenantMigrations = int32(len(tenantMigrationFiles))
+	results.TenantScripts = int32(len(tenantScriptFiles))
+
+	if err := bc.updateVersionTenants(versionID, results, versionState(results)); err != nil {
+		return nil, nil, err
+	}
+
+	version, err := bc.GetVersionByID(int32(versionID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return results, version, nil
+}
+
+// versionTenants is stored as JSON in tenants column of versions table
+type versionTenants struct {
+	SucceededTenants []string             `json:"succeededTenants"`
+	FailedTenants    []types.FailedTenant `json:"failedTenants"`
+	State            types.VersionState   `json:"state"`
+}
+
+// versionState returns Failed when all tenants failed and Partial when some of them failed
+func versionState(results *types.MigrationResults) types.VersionState {
+	if len(results.FailedTenants) == 0 {
+		return types.VersionStateSucceeded
+	}
+	if len(results.SucceededTenants) == 0 {
+		return types.VersionStateFailed
+	}
+	return types.VersionStatePartial
+}
+
+// updateVersionTenants stores succeeded and failed tenants and state together with version
+func (bc *baseConnector) updateVersionTenants(versionID int64, results *types.MigrationResults, state types.VersionState) error {
+	tenants, err := json.Marshal(versionTenants{results.SucceededTenants, results.FailedTenants, state})
+	if err != nil {
+		return fmt.Errorf("Could not serialise version tenants: %v", err)
+	}
+	if _, err := bc.db.Exec(bc.dialect.GetVersionTenantsUpdateSQL(), string(tenants), versionID); err != nil {
+		return fmt.Errorf("Could not update version tenants: %v", err)
+	}
+	return nil
+}
+
+// tenantOutcome contains migrations successfully applied to a tenant and, if any, the failure
+type tenantOutcome struct {
+	succeeded []types.Migration
+	failed    *types.FailedTenant
+}
+
+// addTo adds tenant outcome to results
+func (o tenantOutcome) addTo(results *types.MigrationResults, tenant types.Tenant) {
+	if o.failed != nil {
+		results.FailedTenants = append(results.FailedTenants, *o.failed)
+	} else {
+		results.SucceededTenants = append(results.SucceededTenants, tenant.Name)
+	}
+	for _, m := range o.succeeded {
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			results.TenantMigrationsTotal++
+		} else {
+			results.TenantScriptsTotal++
+		}
+	}
+}
+
+// applyTenantMigrations applies tenant migrations to a single tenant using per-tenant or per-migration transaction strategy
+// migrations already applied to the tenant are skipped, scripts are applied every time
+func (bc *baseConnector) applyTenantMigrations(ctx context.Context, insert *sql.Stmt, action types.Action, tenant types.Tenant, tenantMigrations []types.Migration, applied map[string]bool, perMigration bool, versionID int64) tenantOutcome {
+	var pending []types.Migration
+	for _, m := range tenantMigrations {
+		if m.MigrationType == types.MigrationTypeTenantScript || !applied[m.File] {
+			pending = append(pending, m)
+		}
+	}
+
+	var outcome tenantOutcome
+	var current types.Migration
+	var err error
+	if perMigration {
+		for _, m := range pending {
+			current = m
+			if err = bc.inTx(ctx, false, func(tx *sql.Tx) error {
+				return bc.applyMigrationInTx(ctx, tx, insert, action, m, tenant.Name, versionID)
+			}); err != nil {
+				break
+			}
+			outcome.succeeded = append(outcome.succeeded, m)
+		}
+	} else {
+		err = bc.inTx(ctx, false, func(tx *sql.Tx) error {
+			for _, m := range pending {
+				current = m
+				if err := bc.applyMigrationInTx(ctx, tx, insert, action, m, tenant.Name, versionID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			outcome.succeeded = pending
+		}
+	}
+
+	if err != nil {
+		common.LogError(common.WithFields(ctx, common.Field{Key: common.FieldTenant, Value: tenant.Name}, common.Field{Key: common.FieldFile, Value: current.File}), "Applying migrations for tenant failed: %v", err)
+		outcome.failed = &types.FailedTenant{Name: tenant.Name, File: current.File, Error: err.Error()}
+		if migrationFailed, ok := err.(*ErrMigrationFailed); ok {
+			outcome.failed.StatementIndex = int32(migrationFailed.StatementIndex)
+			outcome.failed.DBErrorCode = migrationFailed.Code
+			outcome.failed.Line = int32(migrationFailed.Line)
+			outcome.failed.StatementPosition = int32(migrationFailed.StatementPosition)
+		}
+	}
+
+	return outcome
+}
+
+// execStatements splits migration into statements and executes them one by one
+// failed statement is returned as ErrMigrationFailed
+func (bc *baseConnector) execStatements(ctx context.Context, tx *sql.Tx, file, schema, contents string) error {
+	for i, s := range bc.dialect.SplitStatements(contents) {
+		started := time.Now()
+		_, span := tracing.StartSpan(ctx, "db.ExecStatement", tracing.Attribute{Key: common.FieldStatementIndex, Value: i}, tracing.Attribute{Key: "line", Value: s.line})
+		if _, err := tx.Exec(s.sql); err != nil {
+			span.SetError(err.Error())
+			span.End()
+			return bc.migrationFailed(file, schema, i, s, err)
+		}
+		span.End()
+		common.LogDebug(common.WithFields(ctx, common.Field{Key: common.FieldStatementIndex, Value: i}, common.Field{Key: common.FieldDuration, Value: time.Since(started)}), "Executed statement at line: %d", s.line)
+	}
+	return nil
+}
+
+// migrationFailed returns ErrMigrationFailed with details of failed statement provided by DB driver
+// line reported by driver is relative to the statement and is converted to line of migration
+func (bc *baseConnector) migrationFailed(file, schema string, statementIndex int, s statement, err error) *ErrMigrationFailed {
+	details := bc.dialect.GetErrorDetails(err, s.sql)
+	if details.line > 0 {
+		details.line += s.line - 1
+	}
+	return &ErrMigrationFailed{File: file, Schema: schema, StatementIndex: statementIndex, Code: details.code, Line: details.line, StatementPosition: details.position, Cause: err}
+}
+
+// getTenantConcurrency returns number of tenants migrated in parallel, defaults to 1
+func (bc *baseConnector) getTenantConcurrency() int {
+	if bc.config.TenantConcurrency > 1 {
+		return bc.config.TenantConcurrency
+	}
+	return 1
+}
+
+// inTx executes passed function in a new transaction, the transaction is committed when the function succeeds
+// and is rolled back when the function returns an error or when running in dry-run mode
+func (bc *baseConnector) inTx(ctx context.Context, dryRun bool, fn func(tx *sql.Tx) error) error {
+	tx, err := bc.db.Begin()
+	if err != nil {
+		return fmt.Errorf("Could not start transaction: %v", err.Error())
+	}
+
+	if err := fn(tx); err != nil {
+		common.LogInfo(ctx, "Transaction rollback: %v", err)
+		tx.Rollback()
+		return err
+	}
+
+	if dryRun {
+		common.LogInfo(ctx, "Running in dry-run mode, calling rollback")
+		tx.Rollback()
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Could not commit transaction: %v", err.Error())
+	}
+	return nil
+}
+
+// insertVersionInTx inserts new version and returns its ID, empty commit sha is stored as null
+func (bc *baseConnector) insertVersionInTx(tx *sql.Tx, versionName, commitSha string) (int64, error) {
+	var versionID int64
+	sha := sql.NullString{String: commitSha, Valid: commitSha != ""}
+	versionInsertSQL := bc.dialect.GetVersionInsertSQL()
+	versionInsert, err := bc.db.Prepare(versionInsertSQL)
+	if err != nil {
+		return 0, fmt.Errorf("Could not create prepared statement for version: %v", err)
 	}
+	defer versionInsert.Close()
+	stmt := tx.Stmt(versionInsert)
+	if bc.dialect.LastInsertIDSupported() {
+		result, err := stmt.Exec(versionName, sha)
+		if err != nil {
+			return 0, fmt.Errorf("Could not insert version: %v", err)
+		}
+		if versionID, err = result.LastInsertId(); err != nil {
+			return 0, fmt.Errorf("Could not read version ID: %v", err)
+		}
+	} else if err := stmt.QueryRow(versionName, sha).Scan(&versionID); err != nil {
+		return 0, fmt.Errorf("Could not insert version: %v", err)
+	}
+	return versionID, nil
+}
+
+func (bc *baseConnector) revertMigrationsInTx(ctx context.Context, tx *sql.Tx, versionName string, version *types.Version) (*types.MigrationResults, int64, error) {
+
+	results := &types.MigrationResults{
+		StartedAt: graphql.Time{Time: time.Now()},
+	}
+
+	defer func() {
+		results.Duration = int32(time.Now().Sub(results.StartedAt.Time))
+		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+	}()
+
+	schemaPlaceHolder := bc.getSchemaPlaceHolder()
+
+	// reverts are not loaded from source migrations and have no commit sha
+	versionID, err := bc.insertVersionInTx(tx, versionName, "")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.Prepare(insertMigrationSQL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not create prepared statement for migration: %v", err)
+	}
+
+	deleteMigrationSQL := bc.dialect.GetMigrationDeleteSQL()
+	remove, err := bc.db.Prepare(deleteMigrationSQL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Could not create prepared statement for migration delete: %v", err)
+	}
+
+	tenants := map[string]bool{}
+	singleMigrations := map[string]bool{}
+	tenantMigrations := map[string]bool{}
+
+	// DB migrations are ordered by their IDs, down migrations are executed in reverse order
+	for i := len(version.DBMigrations) - 1; i >= 0; i-- {
+		m := version.DBMigrations[i]
+
+		// scripts are applied every time and are not reverted
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript {
+			continue
+		}
+
+		common.LogInfo(migrationContext(ctx, m.Migration, m.Schema), "Reverting migration type: %d", m.MigrationType)
+
+		down := downMigration(m.Migration)
+		contents := bc.dialect.ReplaceSchemaPlaceHolder(down.Contents, schemaPlaceHolder, m.Schema)
+		if err = bc.execStatements(ctx, tx, down.File, m.Schema, contents); err != nil {
+			return nil, 0, err
+		}
+
+		if _, err = tx.Stmt(remove).Exec(m.ID); err != nil {
+			return nil, 0, fmt.Errorf("Failed to remove migration entry: %v", err.Error())
+		}
+
+		if _, err = tx.Stmt(insert).Exec(down.Name, down.SourceDir, down.File, down.MigrationType, m.Schema, down.Contents, down.CheckSum, versionID, down.DownContents); err != nil {
+			return nil, 0, fmt.Errorf("Failed to add migration entry: %v", err.Error())
+		}
+
+		if m.MigrationType == types.MigrationTypeSingleMigration {
+			singleMigrations[m.File] = true
+		}
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			tenants[m.Schema] = true
+			tenantMigrations[m.File] = true
+			results.TenantMigrationsTotal++
+		}
+	}
+
+	results.Tenants = int32(len(tenants))
+	results.SingleMigrations = int32(len(singleMigrations))
+	results.TenantMigrations = int32(len(tenantMigrations))
+
+	return results, versionID, nil
+}
 
-	return results, versionID
+// downMigration returns down migration for passed migration
+// down migration is recorded in the version which reverted the migration
+func downMigration(m types.Migration) types.Migration {
+	name := m.Name
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext) + ".down" + ext
+	file := strings.TrimSuffix(m.File, m.Name) + name
+	hasher := sha256.New()
+	hasher.Write([]byte(m.DownContents))
+	return types.Migration{Name: name, SourceDir: m.SourceDir, File: file, MigrationType: m.MigrationType, Contents: m.DownContents, CheckSum: hex.EncodeToString(hasher.Sum(nil))}
 }
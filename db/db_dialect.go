@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lukaszbudnik/migrator/config"
 )
@@ -13,15 +14,41 @@ type dialect interface {
 	GetMigrationInsertSQL() string
 	GetMigrationSelectSQL() string
 	GetMigrationByIDSQL() string
+	GetMigrationDeleteSQL() string
+	GetMigrationChecksumUpdateSQL() string
 	GetCreateTenantsTableSQL() string
 	GetCreateMigrationsTableSQL() string
 	GetCreateSchemaSQL(string) string
 	GetCreateVersionsTableSQL() []string
+	GetAddDownContentsColumnSQL() []string
+	GetAddCommitShaColumnSQL() []string
+	GetAddTenantsColumnSQL() []string
+	GetVersionTenantsUpdateSQL() string
 	GetVersionInsertSQL() string
 	GetVersionsSelectSQL() string
 	GetVersionsByFileSQL() string
 	GetVersionByIDSQL() string
+	GetCreateJobsTableSQL() string
+	GetJobInsertSQL() string
+	GetJobUpdateSQL() string
+	GetJobSelectSQL() string
+	GetJobsDeleteSQL() string
 	LastInsertIDSupported() bool
+	GetLockSQL() string
+	GetFlywayHistorySelectSQL(string) string
+	GetLiquibaseHistorySelectSQL(string) string
+	GetUnlockSQL() string
+	ReplaceSchemaPlaceHolder(string, string, string) string
+	GetErrorDetails(error, string) errorDetails
+	SplitStatements(string) []statement
+}
+
+// errorDetails contains driver-specific details of failed SQL, zero values mean that driver did not provide them
+// line and position are 1-based and relative to the executed SQL
+type errorDetails struct {
+	code     string
+	line     int
+	position int
 }
 
 // baseDialect struct is used to provide default dialect interface implementation
@@ -29,8 +56,8 @@ type baseDialect struct {
 }
 
 const (
-	selectVersionsSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id order by vid desc, mid asc"
-	selectMigrationsSQL      = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum from %v.%v order by name, source_dir"
+	selectVersionsSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id order by vid desc, mid asc"
+	selectMigrationsSQL      = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v order by name, source_dir"
 	selectTenantsSQL         = "select name from %v.%v"
 	createMigrationsTableSQL = `
 create table if not exists %v.%v (
@@ -51,8 +78,20 @@ create table if not exists %v.%v (
   name varchar(200) not null,
   created timestamp default now()
 )
+`
+	// jobs are stored as JSON, finished is a Unix timestamp used for removing expired jobs, updated is a Unix timestamp of the last heartbeat
+	createJobsTableSQL = `
+create table if not exists %v.%v (
+  id varchar(32) primary key,
+  job text not null,
+  finished bigint,
+  updated bigint
+)
 `
 	createSchemaSQL = "create schema if not exists %v"
+	// history tables are created by Flyway and Liquibase, column names are the same in all DBs
+	selectFlywayHistorySQL    = "select version, description, script, checksum, type, success from %v order by installed_rank"
+	selectLiquibaseHistorySQL = "select id, author, filename, md5sum, exectype from %v order by orderexecuted"
 )
 
 // GetCreateTenantsTableSQL returns migrator's default create tenants table SQL statement.
@@ -67,6 +106,12 @@ func (bd *baseDialect) GetCreateMigrationsTableSQL() string {
 	return fmt.Sprintf(createMigrationsTableSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetCreateJobsTableSQL returns migrator's create jobs table SQL statement.
+// This SQL is used by PostgreSQL.
+func (bd *baseDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableSQL, migratorSchema, migratorJobsTable)
+}
+
 // GetTenantSelectSQL returns migrator's default tenant select SQL statement.
 // This SQL is used by all MySQL, PostgreSQL, and MS SQL.
 func (bd *baseDialect) GetTenantSelectSQL() string {
@@ -91,7 +136,44 @@ func (bd *baseDialect) GetVersionsSelectSQL() string {
 	return fmt.Sprintf(selectVersionsSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable)
 }
 
-// newDialect constructs dialect instance based on the passed Config
+// GetFlywayHistorySelectSQL returns select SQL statement that returns all entries of Flyway history table.
+// This SQL is used by all MySQL, PostgreSQL, MS SQL, and SQLite.
+func (bd *baseDialect) GetFlywayHistorySelectSQL(table string) string {
+	return fmt.Sprintf(selectFlywayHistorySQL, table)
+}
+
+// GetLiquibaseHistorySelectSQL returns select SQL statement that returns all entries of Liquibase history table.
+// This SQL is used by all MySQL, PostgreSQL, MS SQL, and SQLite.
+func (bd *baseDialect) GetLiquibaseHistorySelectSQL(table string) string {
+	return fmt.Sprintf(selectLiquibaseHistorySQL, table)
+}
+
+// ReplaceSchemaPlaceHolder replaces all occurrences of schema placeholder in contents with schema name.
+// This is used by all MySQL, PostgreSQL, and MS SQL.
+func (bd *baseDialect) ReplaceSchemaPlaceHolder(contents, schemaPlaceHolder, schema string) string {
+	return strings.Replace(contents, schemaPlaceHolder, schema, -1)
+}
+
+// SplitStatements splits SQL on semicolons, dialects with additional syntax override it
+func (bd *baseDialect) SplitStatements(sql string) []statement {
+	return splitStatements(sql, splitOptions{})
+}
+
+// GetErrorDetails returns no details, drivers which report error codes and positions override it
+func (bd *baseDialect) GetErrorDetails(err error, sql string) errorDetails {
+	return errorDetails{}
+}
+
+// lineAt returns 1-based line of 1-based character position in sql, returns 0 when position is out of range
+func lineAt(sql string, position int) int {
+	runes := []rune(sql)
+	if position < 1 || position > len(runes) {
+		return 0
+	}
+	return strings.Count(string(runes[:position-1]), "\n") + 1
+}
+
+// newDialect constructs dialect instance based on the passed Config, returns nil for unknown driver
 func newDialect(config *config.Config) dialect {
 
 	var dialect dialect
@@ -103,8 +185,8 @@ func newDialect(config *config.Config) dialect {
 		dialect = &msSQLDialect{}
 	case "postgres":
 		dialect = &postgreSQLDialect{}
-	default:
-		panic(fmt.Sprintf("Failed to create Connector unknown driver: %v", config.Driver))
+	case "sqlite3":
+		dialect = &sqliteDialect{}
 	}
 
 	return dialect
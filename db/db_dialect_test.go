@@ -80,7 +80,17 @@ func TestBaseDialectGetVersionsSelectSQL(t *testing.T) {
 
 	versionsSelectSQL := dialect.GetVersionsSelectSQL()
 
-	expected := "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id order by vid desc, mid asc"
+	expected := "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id order by vid desc, mid asc"
 
 	assert.Equal(t, expected, versionsSelectSQL)
 }
+
+func TestLineAt(t *testing.T) {
+	sql := "select 1;\nselect 2;\n\nselect ł;"
+	assert.Equal(t, 1, lineAt(sql, 1))
+	assert.Equal(t, 1, lineAt(sql, 10))
+	assert.Equal(t, 2, lineAt(sql, 11))
+	assert.Equal(t, 4, lineAt(sql, 29))
+	assert.Equal(t, 0, lineAt(sql, 0))
+	assert.Equal(t, 0, lineAt(sql, 31))
+}
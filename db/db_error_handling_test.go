@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
@@ -22,9 +23,8 @@ func TestInitCannotBeginTransactionError(t *testing.T) {
 
 	mock.ExpectBegin().WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not start DB transaction: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not start DB transaction: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -42,11 +42,11 @@ func TestInitCannotCreateMigratorSchema(t *testing.T) {
 
 	mock.ExpectBegin()
 	// don't have to provide full SQL here - patterns at work
-	mock.ExpectQuery("create schema").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectExec("create schema").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Could not create migrator schema: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not create migrator schema: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -64,12 +64,12 @@ func TestInitCannotCreateMigratorMigrationsTable(t *testing.T) {
 
 	mock.ExpectBegin()
 	// don't have to provide full SQL here - patterns at work
-	mock.ExpectQuery("create schema").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Could not create migrations table: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not create migrations table: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -87,14 +87,94 @@ func TestInitCannotCreateMigratorVersionsTable(t *testing.T) {
 
 	mock.ExpectBegin()
 	// don't have to provide full SQL here - patterns at work
-	mock.ExpectQuery("create schema").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnRows()
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	err = connector.init()
+	assert.Equal(t, "Could not create versions table: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotAddDownContentsColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	// create versions table is a script
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("down_contents").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	err = connector.init()
+	assert.Equal(t, "Could not add down contents column: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotAddCommitShaColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	// create versions table is a script
-	mock.ExpectQuery("begin").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("down_contents").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit_sha").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Could not create versions table: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not add commit sha column: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotAddTenantsColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("down_contents").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit_sha").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("column_name = 'tenants'").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	err = connector.init()
+	assert.Equal(t, "Could not add tenants column: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -112,15 +192,18 @@ func TestInitCannotCreateMigratorTenantsTable(t *testing.T) {
 
 	mock.ExpectBegin()
 	// don't have to provide full SQL here - patterns at work
-	mock.ExpectQuery("create schema").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnRows()
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	// create versions table is a script
-	mock.ExpectQuery("begin").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("down_contents").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit_sha").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("column_name = 'tenants'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Could not create default tenants table: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not create default tenants table: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -138,15 +221,17 @@ func TestInitCannotCommitTransaction(t *testing.T) {
 
 	mock.ExpectBegin()
 	// don't have to provide full SQL here - patterns at work
-	mock.ExpectQuery("create schema").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnRows()
-	mock.ExpectQuery("begin").WillReturnRows()
-	mock.ExpectQuery("create table").WillReturnRows()
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("down_contents").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("commit_sha").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("column_name = 'tenants'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit().WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not commit transaction: trouble maker", func() {
-		connector.init()
-	})
+	err = connector.init()
+	assert.Equal(t, "Could not commit transaction: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -165,9 +250,8 @@ func TestGetTenantsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query tenants: trouble maker", func() {
-		connector.GetTenants()
-	})
+	_, err = connector.GetTenants()
+	assert.Equal(t, "Could not query tenants: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -186,9 +270,8 @@ func TestGetAppliedMigrationsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query DB migrations: trouble maker", func() {
-		connector.GetAppliedMigrations()
-	})
+	_, err = connector.GetAppliedMigrations()
+	assert.Equal(t, "Could not query DB migrations: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -212,9 +295,8 @@ func TestCreateVersionTransactionBeginError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Could not start transaction: trouble maker tx.Begin()", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -240,9 +322,60 @@ func TestCreateVersionInsertVersionPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement for version: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Could not create prepared statement for version: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionInsertVersionError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	tenant1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, []types.Migration{tenant1})
+	assert.Equal(t, "Could not insert version: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionInsertVersionLastInsertIDError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectExec().WithArgs("commit-sha", nil).WillReturnResult(sqlmock.NewErrorResult(errors.New("trouble maker")))
+	mock.ExpectRollback()
+
+	tenant1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, []types.Migration{tenant1})
+	assert.Equal(t, "Could not read version ID: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -263,7 +396,7 @@ func TestCreateVersionInsertMigrationPreparedStatementError(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations").WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
@@ -272,9 +405,8 @@ func TestCreateVersionInsertMigrationPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement for migration: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Could not create prepared statement for migration: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -295,7 +427,7 @@ func TestCreateVersionMigrationSQLError(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnError(errors.New("trouble maker"))
@@ -305,9 +437,85 @@ func TestCreateVersionMigrationSQLError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed with error: trouble maker", tenant1.File), func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, fmt.Sprintf("SQL migration %v failed with error: trouble maker", tenant1.File), err.Error())
+	assert.IsType(t, &ErrMigrationFailed{}, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionMigrationSQLErrorDetails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("insert into").WillReturnError(&pq.Error{Code: "42601", Message: `syntax error at or near "valuez"`, Position: "42"})
+	mock.ExpectRollback()
+
+	tenant1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings\nvaluez (456, '456')"}
+	migrationsToApply := []types.Migration{tenant1}
+
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.IsType(t, &ErrMigrationFailed{}, err)
+	migrationFailed := err.(*ErrMigrationFailed)
+	assert.Equal(t, "tenantname", migrationFailed.Schema)
+	assert.Equal(t, 0, migrationFailed.StatementIndex)
+	assert.Equal(t, "42601", migrationFailed.Code)
+	assert.Equal(t, 42, migrationFailed.StatementPosition)
+	assert.Equal(t, 2, migrationFailed.Line)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionMigrationStatementError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	tenants := sqlmock.NewRows([]string{"name"}).AddRow("tenantname")
+	mock.ExpectQuery("select").WillReturnRows(tenants)
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	// statements are executed one by one
+	mock.ExpectExec("create table tenantname.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into tenantname.settings").WillReturnError(&pq.Error{Code: "42601", Message: `syntax error at or near "valuez"`, Position: "36"})
+	mock.ExpectRollback()
+
+	tenant1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (k int, v text);\n\ninsert into {schema}.settings\nvaluez (456, '456');"}
+	migrationsToApply := []types.Migration{tenant1}
+
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.IsType(t, &ErrMigrationFailed{}, err)
+	migrationFailed := err.(*ErrMigrationFailed)
+	assert.Equal(t, 1, migrationFailed.StatementIndex)
+	assert.Equal(t, "42601", migrationFailed.Code)
+	assert.Equal(t, 36, migrationFailed.StatementPosition)
+	// line of migration file, not of the failed statement
+	assert.Equal(t, 4, migrationFailed.Line)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -333,16 +541,15 @@ func TestCreateVersionInsertMigrationError(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnError(errors.New("trouble maker"))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
-	assert.PanicsWithValue(t, "Failed to add migration entry: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Failed to add migration entry: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -368,17 +575,16 @@ func TestCreateVersionGetVersionError(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
 	mock.ExpectQuery("select").WillReturnError(errors.New("get version trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: get version trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Could not query versions: get version trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -404,18 +610,17 @@ func TestCreateVersionVersionNotFound(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"})
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"})
 	mock.ExpectQuery("select").WillReturnRows(rows)
 
-	assert.PanicsWithValue(t, "Version not found ID: 0", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Version not found ID: 0", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -441,19 +646,18 @@ func TestCreateVersionMigrationsCommitError(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
-	})
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Equal(t, "Could not commit transaction: tx trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -475,9 +679,8 @@ func TestCreateTenantTransactionBeginError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateTenant("commit-sha", types.ActionApply, false, "newtenant", migrationsToApply)
-	})
+	_, _, err = connector.CreateTenant("commit-sha", "", types.ActionApply, false, "newtenant", migrationsToApply)
+	assert.Equal(t, "Could not start transaction: trouble maker tx.Begin()", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -501,9 +704,8 @@ func TestCreateTenantCreateSchemaError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Create schema failed: trouble maker", func() {
-		connector.CreateTenant("commit-sha", types.ActionApply, false, "newtenant", migrationsToApply)
-	})
+	_, _, err = connector.CreateTenant("commit-sha", "", types.ActionApply, false, "newtenant", migrationsToApply)
+	assert.Equal(t, "Create schema failed: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -528,9 +730,8 @@ func TestCreateTenantInsertTenantPreparedStatementError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, "Could not create prepared statement: trouble maker", func() {
-		connector.CreateTenant("commit-sha", types.ActionApply, false, "newtenant", migrationsToApply)
-	})
+	_, _, err = connector.CreateTenant("commit-sha", "", types.ActionApply, false, "newtenant", migrationsToApply)
+	assert.Equal(t, "Could not create prepared statement: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -558,9 +759,8 @@ func TestCreateTenantInsertTenantError(t *testing.T) {
 	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{m1}
 
-	assert.PanicsWithValue(t, "Failed to add tenant entry: trouble maker", func() {
-		connector.CreateTenant("commit-sha", types.ActionApply, false, tenant, migrationsToApply)
-	})
+	_, _, err = connector.CreateTenant("commit-sha", "", types.ActionApply, false, tenant, migrationsToApply)
+	assert.Equal(t, "Failed to add tenant entry: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -588,19 +788,18 @@ func TestCreateTenantCommitError(t *testing.T) {
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateTenant("commit-sha", types.ActionApply, false, tenant, migrationsToApply)
-	})
+	_, _, err = connector.CreateTenant("commit-sha", "", types.ActionApply, false, tenant, migrationsToApply)
+	assert.Equal(t, "Could not commit transaction: tx trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -619,9 +818,8 @@ func TestGetVersionsError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersions()
-	})
+	_, err = connector.GetVersions()
+	assert.Equal(t, "Could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -640,9 +838,8 @@ func TestGetVersionsByFileError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersionsByFile("file")
-	})
+	_, err = connector.GetVersionsByFile("file")
+	assert.Equal(t, "Could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -661,9 +858,8 @@ func TestGetVersionsByIDError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query versions: trouble maker", func() {
-		connector.GetVersionByID(0)
-	})
+	_, err = connector.GetVersionByID(0)
+	assert.Equal(t, "Could not query versions: trouble maker", err.Error())
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -682,9 +878,39 @@ func TestGetDBMigrationByIDError(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectQuery("select").WillReturnError(errors.New("trouble maker"))
 
-	assert.PanicsWithValue(t, "Could not query DB migrations: trouble maker", func() {
-		connector.GetDBMigrationByID(0)
-	})
+	_, err = connector.GetDBMigrationByID(0)
+	assert.Equal(t, "Could not query DB migrations: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRevertVersionDownMigrationError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	m := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (k int)", DownContents: "drop table {schema}.settings"}
+	version := &types.Version{ID: 12, Name: "vname", DBMigrations: []types.DBMigration{{Migration: m, ID: 34, Schema: "abc"}}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("revert", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// migration insert and delete
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("delete from migrator.migrator_migrations")
+	mock.ExpectExec("drop table abc.settings").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	_, _, err = connector.RevertVersion("revert", false, version)
+	assert.Equal(t, "SQL migration tenants/201602220001.down.sql failed with error: trouble maker", err.Error())
+	assert.Equal(t, "abc", err.(*ErrMigrationFailed).Schema)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
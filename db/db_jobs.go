@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// JobStore persists asynchronous jobs in migrator schema so that they can be read by all migrator instances
+type JobStore interface {
+	CreateJob(job *types.Job) error
+	UpdateJob(job *types.Job) error
+	// GetJob returns nil when job does not exist
+	GetJob(ID string) (*types.Job, error)
+	DeleteJobs(finishedBefore time.Time) error
+}
+
+// jobStore keeps a long-lived DB connection pool, migrator schema and jobs table are created on first use
+type jobStore struct {
+	*baseConnector
+	mutex   sync.Mutex
+	created bool
+}
+
+// NewJobStore returns JobStore which keeps a long-lived DB connection pool
+// when DB cannot be connected to all methods of returned JobStore return the error
+func NewJobStore(config *config.Config) JobStore {
+	dialect := newDialect(config)
+	if dialect == nil {
+		return &unavailableConnector{fmt.Errorf("Failed to create Connector unknown driver: %v", config.Driver)}
+	}
+	connector := &baseConnector{context.Background(), config, dialect, nil}
+	if err := connector.connect(); err != nil {
+		return &unavailableConnector{err}
+	}
+	return &jobStore{baseConnector: connector}
+}
+
+// createTable creates migrator schema and jobs table, failed attempts are retried on next call
+func (js *jobStore) createTable() error {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	if js.created {
+		return nil
+	}
+	if _, err := js.db.Exec(js.dialect.GetCreateSchemaSQL(migratorSchema)); err != nil {
+		return fmt.Errorf("Could not create migrator schema: %v", err)
+	}
+	if _, err := js.db.Exec(js.dialect.GetCreateJobsTableSQL()); err != nil {
+		return fmt.Errorf("Could not create jobs table: %v", err)
+	}
+	js.created = true
+	return nil
+}
+
+func (js *jobStore) CreateJob(job *types.Job) error {
+	if err := js.createTable(); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("Could not serialise job: %v", err)
+	}
+	if _, err := js.db.Exec(js.dialect.GetJobInsertSQL(), job.ID, string(contents), job.UpdatedAt.Unix()); err != nil {
+		return fmt.Errorf("Could not create job: %v", err)
+	}
+	return nil
+}
+
+func (js *jobStore) UpdateJob(job *types.Job) error {
+	if err := js.createTable(); err != nil {
+		return err
+	}
+	contents, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("Could not serialise job: %v", err)
+	}
+	var finished sql.NullInt64
+	if job.FinishedAt != nil {
+		finished = sql.NullInt64{Int64: job.FinishedAt.Unix(), Valid: true}
+	}
+	if _, err := js.db.Exec(js.dialect.GetJobUpdateSQL(), string(contents), finished, job.UpdatedAt.Unix(), job.ID); err != nil {
+		return fmt.Errorf("Could not update job: %v", err)
+	}
+	return nil
+}
+
+func (js *jobStore) GetJob(ID string) (*types.Job, error) {
+	if err := js.createTable(); err != nil {
+		return nil, err
+	}
+	var contents string
+	err := js.db.QueryRow(js.dialect.GetJobSelectSQL(), ID).Scan(&contents)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not query job: %v", err)
+	}
+	job := &types.Job{}
+	if err := json.Unmarshal([]byte(contents), job); err != nil {
+		return nil, fmt.Errorf("Could not read job: %v", err)
+	}
+	return job, nil
+}
+
+func (js *jobStore) DeleteJobs(finishedBefore time.Time) error {
+	if err := js.createTable(); err != nil {
+		return err
+	}
+	if _, err := js.db.Exec(js.dialect.GetJobsDeleteSQL(), finishedBefore.Unix()); err != nil {
+		return fmt.Errorf("Could not delete jobs: %v", err)
+	}
+	return nil
+}
+
+func (uc *unavailableConnector) CreateJob(job *types.Job) error {
+	return uc.err
+}
+
+func (uc *unavailableConnector) UpdateJob(job *types.Job) error {
+	return uc.err
+}
+
+func (uc *unavailableConnector) GetJob(ID string) (*types.Job, error) {
+	return nil, uc.err
+}
+
+func (uc *unavailableConnector) DeleteJobs(finishedBefore time.Time) error {
+	return uc.err
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStore(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	store := NewJobStore(config)
+
+	ID := newJobTestID()
+	job := &types.Job{ID: ID, Operation: "createVersion", State: types.JobStateQueued, CreatedAt: graphql.Time{Time: time.Now()}, Replica: "migrator-0", UpdatedAt: graphql.Time{Time: time.Now()}}
+	assert.Nil(t, store.CreateJob(job))
+
+	job.State = types.JobStateSucceeded
+	job.FinishedAt = &graphql.Time{Time: time.Now().Add(-time.Hour)}
+	job.Results = &types.CreateResults{Summary: &types.MigrationResults{SingleMigrations: 2}, Version: &types.Version{ID: 1, Name: "v1"}}
+	assert.Nil(t, store.UpdateJob(job))
+
+	persisted, err := store.GetJob(ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateSucceeded, persisted.State)
+	assert.Equal(t, "migrator-0", persisted.Replica)
+	assert.Equal(t, int32(2), persisted.Results.Summary.SingleMigrations)
+	assert.Equal(t, "v1", persisted.Results.Version.Name)
+	assert.True(t, job.CreatedAt.Equal(persisted.CreatedAt.Time))
+	assert.True(t, job.UpdatedAt.Equal(persisted.UpdatedAt.Time))
+
+	// job finished an hour ago is kept when retention is longer
+	assert.Nil(t, store.DeleteJobs(time.Now().Add(-2*time.Hour)))
+	persisted, err = store.GetJob(ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, persisted)
+
+	assert.Nil(t, store.DeleteJobs(time.Now()))
+	persisted, err = store.GetJob(ID)
+	assert.Nil(t, err)
+	assert.Nil(t, persisted)
+}
+
+func TestJobStoreUnknownDriver(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "abcxyz"
+
+	store := NewJobStore(config)
+	_, err := store.GetJob("abc")
+	assert.Equal(t, "Failed to create Connector unknown driver: abcxyz", err.Error())
+	assert.Equal(t, err, store.CreateJob(&types.Job{}))
+	assert.Equal(t, err, store.UpdateJob(&types.Job{}))
+	assert.Equal(t, err, store.DeleteJobs(time.Now()))
+}
+
+func newJobTestID() string {
+	return time.Now().Format("20060102150405.000000000")
+}
@@ -2,8 +2,9 @@ package db
 
 import (
 	"fmt"
-	// blank import for MSSQL driver
-	_ "github.com/denisenkom/go-mssqldb"
+	"strconv"
+
+	mssql "github.com/denisenkom/go-mssqldb"
 )
 
 type msSQLDialect struct {
@@ -11,12 +12,16 @@ type msSQLDialect struct {
 }
 
 const (
-	insertMigrationMSSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)"
+	insertMigrationMSSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)"
 	insertTenantMSSQLDialectSQL         = "insert into %v.%v (name) values (@p1)"
-	insertVersionMSSQLSQLDialectSQL     = "insert into %v.%v (name) output inserted.id values (@p1)"
-	selectVersionsByFileMSSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
-	selectVersionByIDMSSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
-	selectMigrationByIDMSSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = @p1"
+	insertVersionMSSQLSQLDialectSQL     = "insert into %v.%v (name, commit_sha) output inserted.id values (@p1, @p2)"
+	selectVersionsByFileMSSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
+	selectVersionByIDMSSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
+	selectMigrationByIDMSSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = @p1"
+	deleteMigrationMSSQLDialectSQL      = "delete from %v.%v where id = @p1"
+	updateVersionTenantsMSSQLDialectSQL = "update %v.%v set tenants = @p1 where id = @p2"
+	updateChecksumMSSQLDialectSQL       = "update %v.%v set contents = @p1, checksum = @p2 where filename = @p3"
+	unlockMSSQLDialectSQL               = "exec sp_releaseapplock @Resource = '%v', @LockOwner = 'Session'"
 	createTenantsTableMSSQLDialectSQL   = `
 IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
 BEGIN
@@ -75,6 +80,44 @@ begin
   select @cn = name from sys.default_constraints where parent_object_id = object_id('[%v].%v') and name like '%%ver%%';
   EXEC ('alter table [%v].%v drop constraint ' + @cn);
 end
+`
+	downContentsColumnSetupMSSQLDialectSQL = `
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'down_contents')
+begin
+  alter table [%v].%v add down_contents text;
+end
+`
+	commitShaColumnSetupMSSQLDialectSQL = `
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'commit_sha')
+begin
+  alter table [%v].%v add commit_sha varchar(40);
+end
+`
+	tenantsColumnSetupMSSQLDialectSQL = `
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'tenants')
+begin
+  alter table [%v].%v add tenants nvarchar(max);
+end
+`
+	lockMSSQLDialectSQL = `
+declare @result int;
+exec @result = sp_getapplock @Resource = '%v', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;
+select case when @result >= 0 then 1 else 0 end;
+`
+	insertJobMSSQLDialectSQL       = "insert into %v.%v (id, job, updated) values (@p1, @p2, @p3)"
+	updateJobMSSQLDialectSQL       = "update %v.%v set job = @p1, finished = @p2, updated = @p3 where id = @p4"
+	selectJobMSSQLDialectSQL       = "select job from %v.%v where id = @p1"
+	deleteJobsMSSQLDialectSQL      = "delete from %v.%v where finished < @p1"
+	createJobsTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id varchar(32) primary key,
+    job nvarchar(max) not null,
+    finished bigint,
+    updated bigint
+  );
+END
 `
 )
 
@@ -119,6 +162,26 @@ func (md *msSQLDialect) GetCreateVersionsTableSQL() []string {
 	return []string{fmt.Sprintf(versionsTableSetupMSSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)}
 }
 
+// GetAddDownContentsColumnSQL returns MS SQL-specific SQL which adds down_contents column to migrations table
+func (md *msSQLDialect) GetAddDownContentsColumnSQL() []string {
+	return []string{fmt.Sprintf(downContentsColumnSetupMSSQLDialectSQL, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)}
+}
+
+// GetAddCommitShaColumnSQL returns MS SQL-specific SQL which adds commit_sha column to versions table
+func (md *msSQLDialect) GetAddCommitShaColumnSQL() []string {
+	return []string{fmt.Sprintf(commitShaColumnSetupMSSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable)}
+}
+
+// GetAddTenantsColumnSQL returns MS SQL-specific SQL which adds tenants column to versions table
+func (md *msSQLDialect) GetAddTenantsColumnSQL() []string {
+	return []string{fmt.Sprintf(tenantsColumnSetupMSSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable)}
+}
+
+// GetVersionTenantsUpdateSQL returns MS SQL-specific SQL which updates succeeded and failed tenants of version
+func (md *msSQLDialect) GetVersionTenantsUpdateSQL() string {
+	return fmt.Sprintf(updateVersionTenantsMSSQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
 func (md *msSQLDialect) GetVersionsByFileSQL() string {
 	return fmt.Sprintf(selectVersionsByFileMSSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)
 }
@@ -130,3 +193,66 @@ func (md *msSQLDialect) GetVersionByIDSQL() string {
 func (md *msSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetCreateJobsTableSQL returns MS SQL-specific create jobs table SQL statement
+func (md *msSQLDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableMSSQLDialectSQL, migratorSchema, migratorJobsTable, migratorSchema, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns MS SQL-specific SQL which inserts job
+func (md *msSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MS SQL-specific SQL which updates job and its finished timestamp
+func (md *msSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobSelectSQL returns MS SQL-specific SQL which selects job by ID
+func (md *msSQLDialect) GetJobSelectSQL() string {
+	return fmt.Sprintf(selectJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobsDeleteSQL returns MS SQL-specific SQL which deletes jobs finished before passed timestamp
+func (md *msSQLDialect) GetJobsDeleteSQL() string {
+	return fmt.Sprintf(deleteJobsMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetLockSQL returns MS SQL-specific SQL which tries to acquire migrator application lock
+func (md *msSQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockMSSQLDialectSQL, migratorLockName)
+}
+
+// GetUnlockSQL returns MS SQL-specific SQL which releases migrator application lock
+func (md *msSQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockMSSQLDialectSQL, migratorLockName)
+}
+
+func (md *msSQLDialect) GetMigrationDeleteSQL() string {
+	return fmt.Sprintf(deleteMigrationMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns MS SQL-specific SQL which updates contents and checksum of applied migration
+func (md *msSQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateChecksumMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetErrorDetails returns MS SQL error number and line reported by MS SQL
+func (md *msSQLDialect) GetErrorDetails(err error, sql string) errorDetails {
+	var msSQLErr mssql.Error
+	switch e := err.(type) {
+	case mssql.Error:
+		msSQLErr = e
+	case *mssql.Error:
+		msSQLErr = *e
+	default:
+		return errorDetails{}
+	}
+	return errorDetails{code: strconv.Itoa(int(msSQLErr.Number)), line: int(msSQLErr.LineNo)}
+}
+
+// SplitStatements splits SQL into batches separated by GO lines, semicolons do not split batches
+func (md *msSQLDialect) SplitStatements(sql string) []statement {
+	return splitStatements(sql, splitOptions{batchSeparator: true, bracketIdentifiers: true})
+}
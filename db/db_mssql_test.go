@@ -1,8 +1,10 @@
 package db
 
 import (
+	"errors"
 	"testing"
 
+	mssql "github.com/denisenkom/go-mssqldb"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -36,7 +38,7 @@ func TestMSSQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)", insertMigrationSQL)
 }
 
 func TestMSSQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -136,7 +138,7 @@ func TestMSSQLGetVersionInsertSQL(t *testing.T) {
 
 	versionInsertSQL := dialect.GetVersionInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_versions (name) output inserted.id values (@p1)", versionInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_versions (name, commit_sha) output inserted.id values (@p1, @p2)", versionInsertSQL)
 }
 
 func TestMSSQLGetCreateVersionsTableSQL(t *testing.T) {
@@ -189,7 +191,7 @@ func TestMSSQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = @p1) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = @p1) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestMSSQLGetVersionByIDSQL(t *testing.T) {
@@ -201,7 +203,7 @@ func TestMSSQLGetVersionByIDSQL(t *testing.T) {
 
 	versionByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc", versionByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc", versionByID)
 }
 
 func TestMSSQLGetMigrationByIDSQL(t *testing.T) {
@@ -213,5 +215,68 @@ func TestMSSQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = @p1", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = @p1", migrationByID)
+}
+
+func TestMSSQLGetMigrationDeleteSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	migrationDelete := dialect.GetMigrationDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_migrations where id = @p1", migrationDelete)
+}
+
+func TestMSSQLGetMigrationChecksumUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	checksumUpdate := dialect.GetMigrationChecksumUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = @p1, checksum = @p2 where filename = @p3", checksumUpdate)
+}
+
+func TestMSSQLGetLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Contains(t, dialect.GetLockSQL(), "exec @result = sp_getapplock @Resource = 'migrator', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0;")
+	assert.Equal(t, "exec sp_releaseapplock @Resource = 'migrator', @LockOwner = 'Session'", dialect.GetUnlockSQL())
+}
+
+func TestMSSQLGetErrorDetails(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	details := dialect.GetErrorDetails(mssql.Error{Number: 102, LineNo: 3, Message: "Incorrect syntax near 'tabel'."}, "")
+	assert.Equal(t, errorDetails{code: "102", line: 3}, details)
+
+	details = dialect.GetErrorDetails(&mssql.Error{Number: 2714, LineNo: 1}, "")
+	assert.Equal(t, errorDetails{code: "2714", line: 1}, details)
+
+	assert.Equal(t, errorDetails{}, dialect.GetErrorDetails(errors.New("trouble maker"), ""))
+}
+
+func TestMSSQLGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (id, job, updated) values (@p1, @p2, @p3)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set job = @p1, finished = @p2, updated = @p3 where id = @p4", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select job from migrator.migrator_jobs where id = @p1", dialect.GetJobSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_jobs where finished < @p1", dialect.GetJobsDeleteSQL())
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "create table [migrator].migrator_jobs")
 }
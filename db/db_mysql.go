@@ -2,8 +2,10 @@ package db
 
 import (
 	"fmt"
-	// blank import for MySQL driver
-	_ "github.com/go-sql-driver/mysql"
+	"regexp"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type mySQLDialect struct {
@@ -11,12 +13,17 @@ type mySQLDialect struct {
 }
 
 const (
-	insertMigrationMySQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	insertMigrationMySQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	insertTenantMySQLDialectSQL                = "insert into %v.%v (name) values (?)"
-	insertVersionMySQLDialectSQL               = "insert into %v.%v (name) values (?)"
-	selectVersionsByFileMySQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = ?) order by vid desc, mid asc"
-	selectVersionByIDMySQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
-	selectMigrationByIDMySQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = ?"
+	insertVersionMySQLDialectSQL               = "insert into %v.%v (name, commit_sha) values (?, ?)"
+	selectVersionsByFileMySQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = ?) order by vid desc, mid asc"
+	selectVersionByIDMySQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
+	selectMigrationByIDMySQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = ?"
+	deleteMigrationMySQLDialectSQL             = "delete from %v.%v where id = ?"
+	updateVersionTenantsMySQLDialectSQL        = "update %v.%v set tenants = ? where id = ?"
+	updateChecksumMySQLDialectSQL              = "update %v.%v set contents = ?, checksum = ? where filename = ?"
+	lockMySQLDialectSQL                        = "select coalesce(get_lock('%v', 0), 0)"
+	unlockMySQLDialectSQL                      = "select release_lock('%v')"
 	versionsTableSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_create_versions`
 	versionsTableSetupMySQLCallDialectSQL      = `call migrator_create_versions()`
 	versionsTableSetupMySQLProcedureDialectSQL = `
@@ -41,6 +48,49 @@ if not exists (select * from information_schema.tables where table_schema = '%v'
     add constraint migrator_versions_version_id_fk foreign key (version_id) references %v.%v (id) on delete cascade;
 end if;
 end;
+`
+	downContentsColumnSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_add_down_contents`
+	downContentsColumnSetupMySQLCallDialectSQL      = `call migrator_add_down_contents()`
+	downContentsColumnSetupMySQLProcedureDialectSQL = `
+create procedure migrator_add_down_contents()
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'down_contents') then
+  alter table %v.%v add column down_contents text;
+end if;
+end;
+`
+	commitShaColumnSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_add_commit_sha`
+	commitShaColumnSetupMySQLCallDialectSQL      = `call migrator_add_commit_sha()`
+	commitShaColumnSetupMySQLProcedureDialectSQL = `
+create procedure migrator_add_commit_sha()
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'commit_sha') then
+  alter table %v.%v add column commit_sha varchar(40);
+end if;
+end;
+`
+	tenantsColumnSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_add_tenants`
+	tenantsColumnSetupMySQLCallDialectSQL      = `call migrator_add_tenants()`
+	tenantsColumnSetupMySQLProcedureDialectSQL = `
+create procedure migrator_add_tenants()
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'tenants') then
+  alter table %v.%v add column tenants longtext;
+end if;
+end;
+`
+	insertJobMySQLDialectSQL  = "insert into %v.%v (id, job, updated) values (?, ?, ?)"
+	updateJobMySQLDialectSQL  = "update %v.%v set job = ?, finished = ?, updated = ? where id = ?"
+	selectJobMySQLDialectSQL  = "select job from %v.%v where id = ?"
+	deleteJobsMySQLDialectSQL = "delete from %v.%v where finished < ?"
+	// MySQL text is limited to 64KB, job results contain contents of applied migrations
+	createJobsTableMySQLDialectSQL = `
+create table if not exists %v.%v (
+  id varchar(32) primary key,
+  job longtext not null,
+  finished bigint,
+  updated bigint
+)
 `
 )
 
@@ -76,6 +126,39 @@ func (md *mySQLDialect) GetCreateVersionsTableSQL() []string {
 	}
 }
 
+// GetAddDownContentsColumnSQL returns MySQL-specific SQLs which add down_contents column to migrations table
+// just like GetCreateVersionsTableSQL it has to use a stored procedure
+func (md *mySQLDialect) GetAddDownContentsColumnSQL() []string {
+	return []string{
+		downContentsColumnSetupMySQLDropDialectSQL,
+		fmt.Sprintf(downContentsColumnSetupMySQLProcedureDialectSQL, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable),
+		downContentsColumnSetupMySQLCallDialectSQL,
+	}
+}
+
+// GetAddCommitShaColumnSQL returns MySQL-specific SQLs which add commit_sha column to versions table
+func (md *mySQLDialect) GetAddCommitShaColumnSQL() []string {
+	return []string{
+		commitShaColumnSetupMySQLDropDialectSQL,
+		fmt.Sprintf(commitShaColumnSetupMySQLProcedureDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable),
+		commitShaColumnSetupMySQLCallDialectSQL,
+	}
+}
+
+// GetAddTenantsColumnSQL returns MySQL-specific SQLs which add tenants column to versions table
+func (md *mySQLDialect) GetAddTenantsColumnSQL() []string {
+	return []string{
+		tenantsColumnSetupMySQLDropDialectSQL,
+		fmt.Sprintf(tenantsColumnSetupMySQLProcedureDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable),
+		tenantsColumnSetupMySQLCallDialectSQL,
+	}
+}
+
+// GetVersionTenantsUpdateSQL returns MySQL-specific SQL which updates succeeded and failed tenants of version
+func (md *mySQLDialect) GetVersionTenantsUpdateSQL() string {
+	return fmt.Sprintf(updateVersionTenantsMySQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
 func (md *mySQLDialect) GetVersionsByFileSQL() string {
 	return fmt.Sprintf(selectVersionsByFileMySQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)
 }
@@ -87,3 +170,68 @@ func (md *mySQLDialect) GetVersionByIDSQL() string {
 func (md *mySQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetCreateJobsTableSQL returns MySQL-specific create jobs table SQL statement
+func (md *mySQLDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns MySQL-specific SQL which inserts job
+func (md *mySQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MySQL-specific SQL which updates job and its finished timestamp
+func (md *mySQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobSelectSQL returns MySQL-specific SQL which selects job by ID
+func (md *mySQLDialect) GetJobSelectSQL() string {
+	return fmt.Sprintf(selectJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobsDeleteSQL returns MySQL-specific SQL which deletes jobs finished before passed timestamp
+func (md *mySQLDialect) GetJobsDeleteSQL() string {
+	return fmt.Sprintf(deleteJobsMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetLockSQL returns MySQL-specific SQL which tries to acquire migrator named lock
+func (md *mySQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockMySQLDialectSQL, migratorLockName)
+}
+
+// GetUnlockSQL returns MySQL-specific SQL which releases migrator named lock
+func (md *mySQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockMySQLDialectSQL, migratorLockName)
+}
+
+func (md *mySQLDialect) GetMigrationDeleteSQL() string {
+	return fmt.Sprintf(deleteMigrationMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns MySQL-specific SQL which updates contents and checksum of applied migration
+func (md *mySQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateChecksumMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// MySQL reports line of syntax errors only in error message, for example: ... near 'tabel abc' at line 2
+var mySQLErrorLineRegexp = regexp.MustCompile(`at line (\d+)$`)
+
+// GetErrorDetails returns MySQL error number and line parsed from error message
+func (md *mySQLDialect) GetErrorDetails(err error, sql string) errorDetails {
+	mySQLErr, ok := err.(*mysql.MySQLError)
+	if !ok {
+		return errorDetails{}
+	}
+	details := errorDetails{code: strconv.Itoa(int(mySQLErr.Number))}
+	if match := mySQLErrorLineRegexp.FindStringSubmatch(mySQLErr.Message); match != nil {
+		details.line, _ = strconv.Atoi(match[1])
+	}
+	return details
+}
+
+// SplitStatements splits SQL on semicolons or delimiter set by DELIMITER lines (stored procedures and triggers), supports # comments and backslash escapes
+func (md *mySQLDialect) SplitStatements(sql string) []statement {
+	return splitStatements(sql, splitOptions{backslashEscapes: true, hashComments: true, delimiterCommand: true})
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,7 +37,7 @@ func TestMySQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (?, ?, ?, ?, ?, ?, ?, ?)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (?, ?, ?, ?, ?, ?, ?, ?, ?)", insertMigrationSQL)
 }
 
 func TestMySQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -61,7 +63,7 @@ func TestMySQLGetVersionInsertSQL(t *testing.T) {
 
 	versionInsertSQL := dialect.GetVersionInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_versions (name) values (?)", versionInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_versions (name, commit_sha) values (?, ?)", versionInsertSQL)
 }
 
 func TestMySQLGetCreateVersionsTableSQL(t *testing.T) {
@@ -113,7 +115,7 @@ func TestMySQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = ?) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = ?) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestMySQLGetVersionByIDSQL(t *testing.T) {
@@ -125,7 +127,7 @@ func TestMySQLGetVersionByIDSQL(t *testing.T) {
 
 	versionsByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = ? order by mid asc", versionsByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = ? order by mid asc", versionsByID)
 }
 
 func TestMySQLGetMigrationByIDSQL(t *testing.T) {
@@ -137,5 +139,69 @@ func TestMySQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = ?", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = ?", migrationByID)
+}
+
+func TestMySQLGetMigrationDeleteSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	migrationDelete := dialect.GetMigrationDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_migrations where id = ?", migrationDelete)
+}
+
+func TestMySQLGetMigrationChecksumUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	checksumUpdate := dialect.GetMigrationChecksumUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = ?, checksum = ? where filename = ?", checksumUpdate)
+}
+
+func TestMySQLGetLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select coalesce(get_lock('migrator', 0), 0)", dialect.GetLockSQL())
+	assert.Equal(t, "select release_lock('migrator')", dialect.GetUnlockSQL())
+}
+
+func TestMySQLGetErrorDetails(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	message := "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use near 'tabel def (id int)' at line 2"
+	details := dialect.GetErrorDetails(&mysql.MySQLError{Number: 1064, Message: message}, "")
+	assert.Equal(t, errorDetails{code: "1064", line: 2}, details)
+
+	details = dialect.GetErrorDetails(&mysql.MySQLError{Number: 1050, Message: "Table 'abc' already exists"}, "")
+	assert.Equal(t, errorDetails{code: "1050"}, details)
+
+	assert.Equal(t, errorDetails{}, dialect.GetErrorDetails(errors.New("trouble maker"), ""))
+}
+
+func TestMySQLGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (id, job, updated) values (?, ?, ?)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set job = ?, finished = ?, updated = ? where id = ?", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select job from migrator.migrator_jobs where id = ?", dialect.GetJobSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_jobs where finished < ?", dialect.GetJobsDeleteSQL())
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "job longtext not null")
 }
@@ -2,8 +2,9 @@ package db
 
 import (
 	"fmt"
-	// blank import for PostgreSQL driver
-	_ "github.com/lib/pq"
+	"strconv"
+
+	"github.com/lib/pq"
 )
 
 type postgreSQLDialect struct {
@@ -11,12 +12,20 @@ type postgreSQLDialect struct {
 }
 
 const (
-	insertMigrationPostgreSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)"
+	insertMigrationPostgreSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
 	insertTenantPostgreSQLDialectSQL         = "insert into %v.%v (name) values ($1)"
-	insertVersionPostgreSQLDialectSQL        = "insert into %v.%v (name) values ($1) returning id"
-	selectVersionsByFilePostgreSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
-	selectVersionByIDPostgreSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
-	selectMigrationByIDPostgreSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = $1"
+	insertVersionPostgreSQLDialectSQL        = "insert into %v.%v (name, commit_sha) values ($1, $2) returning id"
+	selectVersionsByFilePostgreSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
+	selectVersionByIDPostgreSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
+	selectMigrationByIDPostgreSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = $1"
+	deleteMigrationPostgreSQLDialectSQL      = "delete from %v.%v where id = $1"
+	updateChecksumPostgreSQLDialectSQL       = "update %v.%v set contents = $1, checksum = $2 where filename = $3"
+	insertJobPostgreSQLDialectSQL            = "insert into %v.%v (id, job, updated) values ($1, $2, $3)"
+	updateJobPostgreSQLDialectSQL            = "update %v.%v set job = $1, finished = $2, updated = $3 where id = $4"
+	selectJobPostgreSQLDialectSQL            = "select job from %v.%v where id = $1"
+	deleteJobsPostgreSQLDialectSQL           = "delete from %v.%v where finished < $1"
+	lockPostgreSQLDialectSQL                 = "select case when pg_try_advisory_lock(%v) then 1 else 0 end"
+	unlockPostgreSQLDialectSQL               = "select pg_advisory_unlock(%v)"
 	versionsTableSetupPostgreSQLDialectSQL   = `
 do $$
 begin
@@ -39,6 +48,31 @@ if not exists (select * from information_schema.tables where table_schema = '%v'
 end if;
 end $$;
 `
+	downContentsColumnSetupPostgreSQLDialectSQL = `
+do $$
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'down_contents') then
+  alter table %v.%v add column down_contents text;
+end if;
+end $$;
+`
+	commitShaColumnSetupPostgreSQLDialectSQL = `
+do $$
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'commit_sha') then
+  alter table %v.%v add column commit_sha varchar(40);
+end if;
+end $$;
+`
+	tenantsColumnSetupPostgreSQLDialectSQL = `
+do $$
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = 'tenants') then
+  alter table %v.%v add column tenants text;
+end if;
+end $$;
+`
+	updateVersionTenantsPostgreSQLDialectSQL = "update %v.%v set tenants = $1 where id = $2"
 )
 
 // LastInsertIDSupported instructs migrator if Result.LastInsertId() is supported by the DB driver
@@ -69,6 +103,26 @@ func (pd *postgreSQLDialect) GetCreateVersionsTableSQL() []string {
 	return []string{fmt.Sprintf(versionsTableSetupPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorVersionsTable)}
 }
 
+// GetAddDownContentsColumnSQL returns PostgreSQL-specific SQL which adds down_contents column to migrations table
+func (pd *postgreSQLDialect) GetAddDownContentsColumnSQL() []string {
+	return []string{fmt.Sprintf(downContentsColumnSetupPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)}
+}
+
+// GetAddCommitShaColumnSQL returns PostgreSQL-specific SQL which adds commit_sha column to versions table
+func (pd *postgreSQLDialect) GetAddCommitShaColumnSQL() []string {
+	return []string{fmt.Sprintf(commitShaColumnSetupPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable)}
+}
+
+// GetAddTenantsColumnSQL returns PostgreSQL-specific SQL which adds tenants column to versions table
+func (pd *postgreSQLDialect) GetAddTenantsColumnSQL() []string {
+	return []string{fmt.Sprintf(tenantsColumnSetupPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorVersionsTable)}
+}
+
+// GetVersionTenantsUpdateSQL returns PostgreSQL-specific SQL which updates succeeded and failed tenants of version
+func (pd *postgreSQLDialect) GetVersionTenantsUpdateSQL() string {
+	return fmt.Sprintf(updateVersionTenantsPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable)
+}
+
 func (pd *postgreSQLDialect) GetVersionsByFileSQL() string {
 	return fmt.Sprintf(selectVersionsByFilePostgreSQLDialectSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable, migratorSchema, migratorMigrationsTable)
 }
@@ -80,3 +134,61 @@ func (pd *postgreSQLDialect) GetVersionByIDSQL() string {
 func (pd *postgreSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetJobInsertSQL returns PostgreSQL-specific SQL which inserts job
+func (pd *postgreSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns PostgreSQL-specific SQL which updates job and its finished timestamp
+func (pd *postgreSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobSelectSQL returns PostgreSQL-specific SQL which selects job by ID
+func (pd *postgreSQLDialect) GetJobSelectSQL() string {
+	return fmt.Sprintf(selectJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobsDeleteSQL returns PostgreSQL-specific SQL which deletes jobs finished before passed timestamp
+func (pd *postgreSQLDialect) GetJobsDeleteSQL() string {
+	return fmt.Sprintf(deleteJobsPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetLockSQL returns PostgreSQL-specific SQL which tries to acquire migrator advisory lock
+func (pd *postgreSQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockPostgreSQLDialectSQL, migratorLockID)
+}
+
+// GetUnlockSQL returns PostgreSQL-specific SQL which releases migrator advisory lock
+func (pd *postgreSQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockPostgreSQLDialectSQL, migratorLockID)
+}
+
+func (pd *postgreSQLDialect) GetMigrationDeleteSQL() string {
+	return fmt.Sprintf(deleteMigrationPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns PostgreSQL-specific SQL which updates contents and checksum of applied migration
+func (pd *postgreSQLDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateChecksumPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// GetErrorDetails returns SQLSTATE code and position reported by PostgreSQL, line is computed from position
+func (pd *postgreSQLDialect) GetErrorDetails(err error, sql string) errorDetails {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return errorDetails{}
+	}
+	details := errorDetails{code: string(pqErr.Code)}
+	if position, err := strconv.Atoi(pqErr.Position); err == nil {
+		details.position = position
+		details.line = lineAt(sql, position)
+	}
+	return details
+}
+
+// SplitStatements splits SQL on semicolons, dollar-quoted strings (function bodies), escape strings and nested comments are not split
+func (pd *postgreSQLDialect) SplitStatements(sql string) []statement {
+	return splitStatements(sql, splitOptions{dollarQuoting: true, escapeStrings: true, nestedComments: true})
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,7 +37,7 @@ func TestPostgreSQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)", insertMigrationSQL)
 }
 
 func TestPostgreSQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -61,7 +63,7 @@ func TestPostgreSQLGetVersionInsertSQL(t *testing.T) {
 
 	versionInsertSQL := dialect.GetVersionInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_versions (name) values ($1) returning id", versionInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_versions (name, commit_sha) values ($1, $2) returning id", versionInsertSQL)
 }
 
 func TestPostgreSQLGetCreateVersionsTableSQL(t *testing.T) {
@@ -109,7 +111,7 @@ func TestPostgreSQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = $1) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = $1) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestPostgreSQLGetVersionByIDSQL(t *testing.T) {
@@ -121,7 +123,7 @@ func TestPostgreSQLGetVersionByIDSQL(t *testing.T) {
 
 	versionsByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = $1 order by mid asc", versionsByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = $1 order by mid asc", versionsByID)
 }
 
 func TestPostgreSQLGetMigrationByIDSQL(t *testing.T) {
@@ -133,5 +135,69 @@ func TestPostgreSQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = $1", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = $1", migrationByID)
+}
+
+func TestPostgreSQLGetMigrationDeleteSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	migrationDelete := dialect.GetMigrationDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_migrations where id = $1", migrationDelete)
+}
+
+func TestPostgreSQLGetMigrationChecksumUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	checksumUpdate := dialect.GetMigrationChecksumUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = $1, checksum = $2 where filename = $3", checksumUpdate)
+}
+
+func TestPostgreSQLGetLockSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select case when pg_try_advisory_lock(6378732) then 1 else 0 end", dialect.GetLockSQL())
+	assert.Equal(t, "select pg_advisory_unlock(6378732)", dialect.GetUnlockSQL())
+}
+
+func TestPostgreSQLGetErrorDetails(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	sql := "create table abc (id int);\ncreate tabel def (id int);"
+	details := dialect.GetErrorDetails(&pq.Error{Code: "42601", Position: "35"}, sql)
+	assert.Equal(t, errorDetails{code: "42601", line: 2, position: 35}, details)
+
+	details = dialect.GetErrorDetails(&pq.Error{Code: "42P07"}, sql)
+	assert.Equal(t, errorDetails{code: "42P07"}, details)
+
+	assert.Equal(t, errorDetails{}, dialect.GetErrorDetails(errors.New("trouble maker"), sql))
+}
+
+func TestPostgreSQLGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (id, job, updated) values ($1, $2, $3)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set job = $1, finished = $2, updated = $3 where id = $4", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select job from migrator.migrator_jobs where id = $1", dialect.GetJobSelectSQL())
+	assert.Equal(t, "delete from migrator.migrator_jobs where finished < $1", dialect.GetJobsDeleteSQL())
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "create table if not exists migrator.migrator_jobs")
 }
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// statement is a single SQL statement (or MS SQL batch) of a migration
+// line is 1-based line of migration at which statement starts
+type statement struct {
+	sql  string
+	line int
+}
+
+// splitOptions enables dialect-specific syntax recognised by splitStatements
+// all dialects support semicolons, single-quoted strings, double-quoted and backquoted identifiers, -- and /* */ comments
+type splitOptions struct {
+	// dollarQuoting enables PostgreSQL $$ and $tag$ quoted strings
+	dollarQuoting bool
+	// escapeStrings enables backslash escapes in PostgreSQL E'...' strings
+	escapeStrings bool
+	// nestedComments enables nested /* /* */ */ comments
+	nestedComments bool
+	// backslashEscapes enables backslash escapes in all single-quoted and double-quoted strings
+	backslashEscapes bool
+	// hashComments enables # comments and requires whitespace after -- comment start
+	hashComments bool
+	// delimiterCommand enables DELIMITER lines which change statement delimiter
+	delimiterCommand bool
+	// batchSeparator splits SQL on GO lines only, semicolons do not end statements
+	batchSeparator bool
+	// bracketIdentifiers enables [] quoted identifiers
+	bracketIdentifiers bool
+	// triggerBodies keeps CREATE TRIGGER ... BEGIN ... END in a single statement
+	triggerBodies bool
+}
+
+const defaultDelimiter = ";"
+
+// splitter keeps state of a single splitStatements call
+type splitter struct {
+	sql        string
+	options    splitOptions
+	delimiter  string
+	statements []statement
+	// current position and line
+	pos  int
+	line int
+	// current statement start offset and line, line is 0 until first non-whitespace character
+	start     int
+	startLine int
+	// hasCode is false when current statement contains only whitespace and comments
+	hasCode bool
+	// words contains first lower-cased words of current statement
+	words []string
+	// trigger body state
+	trigger   bool
+	begun     bool
+	ended     bool
+	caseDepth int
+}
+
+// splitStatements splits SQL into statements, delimiters, GO and DELIMITER lines are not included in statements,
+// statements which contain only whitespace and comments are skipped
+func splitStatements(sql string, options splitOptions) []statement {
+	s := &splitter{sql: sql, options: options, delimiter: defaultDelimiter, line: 1}
+	s.split()
+	return s.statements
+}
+
+func (s *splitter) split() {
+	for s.pos < len(s.sql) {
+		if s.atLineStart() && s.command() {
+			continue
+		}
+
+		c := s.sql[s.pos]
+		if s.startLine == 0 && !isSpace(c) {
+			s.startLine = s.line
+		}
+
+		switch {
+		case c == '\n':
+			s.line++
+			s.pos++
+		case isSpace(c):
+			s.pos++
+		case !s.options.batchSeparator && strings.HasPrefix(s.sql[s.pos:], s.delimiter) && !s.inTriggerBody():
+			s.flush(s.pos)
+			s.pos += len(s.delimiter)
+			s.reset(s.pos)
+		case s.lineCommentStart():
+			s.skipTo(s.lineEnd())
+		case strings.HasPrefix(s.sql[s.pos:], "/*"):
+			s.skipBlockComment()
+		case c == '\'' || c == '"':
+			s.hasCode = true
+			backslash := s.options.backslashEscapes || (c == '\'' && s.options.escapeStrings && s.escapeStringPrefix())
+			s.skipQuoted(c, backslash)
+		case c == '`':
+			s.hasCode = true
+			s.skipQuoted(c, false)
+		case c == '[' && s.options.bracketIdentifiers:
+			s.hasCode = true
+			s.skipQuoted(']', false)
+		case c == '$' && s.options.dollarQuoting && s.dollarQuote():
+			s.hasCode = true
+		case isIdentifierChar(c):
+			s.hasCode = true
+			s.word()
+		default:
+			s.hasCode = true
+			s.pos++
+		}
+	}
+	s.flush(len(s.sql))
+}
+
+// flush adds current statement ending at passed offset
+func (s *splitter) flush(end int) {
+	if s.hasCode {
+		s.statements = append(s.statements, statement{sql: strings.TrimSpace(s.sql[s.start:end]), line: s.startLine})
+	}
+}
+
+// reset starts new statement at passed offset
+func (s *splitter) reset(start int) {
+	s.start = start
+	s.startLine = 0
+	s.hasCode = false
+	s.words = nil
+	s.trigger, s.begun, s.ended, s.caseDepth = false, false, false, 0
+}
+
+func (s *splitter) atLineStart() bool {
+	return s.pos == 0 || s.sql[s.pos-1] == '\n'
+}
+
+// command handles GO and DELIMITER lines, returns false when current line is not a command
+func (s *splitter) command() bool {
+	end := s.lineEnd()
+	line := strings.TrimSpace(s.sql[s.pos:end])
+	if s.options.batchSeparator {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || len(fields) > 2 || !strings.EqualFold(fields[0], "go") {
+			return false
+		}
+		// GO count executes batch count times
+		count := 1
+		if len(fields) == 2 {
+			var err error
+			if count, err = strconv.Atoi(fields[1]); err != nil || count < 1 {
+				return false
+			}
+		}
+		for i := 0; i < count; i++ {
+			s.flush(s.pos)
+		}
+	} else if s.options.delimiterCommand {
+		if len(line) <= len("delimiter ") || !strings.EqualFold(line[:len("delimiter ")], "delimiter ") {
+			return false
+		}
+		s.flush(s.pos)
+		s.delimiter = strings.TrimSpace(line[len("delimiter "):])
+	} else {
+		return false
+	}
+	s.pos = end
+	s.reset(end)
+	return true
+}
+
+// lineEnd returns offset of the end of current line, new line character is not included
+func (s *splitter) lineEnd() int {
+	if i := strings.IndexByte(s.sql[s.pos:], '\n'); i >= 0 {
+		return s.pos + i
+	}
+	return len(s.sql)
+}
+
+func (s *splitter) lineCommentStart() bool {
+	rest := s.sql[s.pos:]
+	if s.options.hashComments {
+		// MySQL requires whitespace or end of line after --
+		return rest[0] == '#' || rest == "--" || (strings.HasPrefix(rest, "--") && isSpace(rest[2]))
+	}
+	return strings.HasPrefix(rest, "--")
+}
+
+// skipTo moves to passed offset counting skipped lines
+func (s *splitter) skipTo(end int) {
+	s.line += strings.Count(s.sql[s.pos:end], "\n")
+	s.pos = end
+}
+
+func (s *splitter) skipBlockComment() {
+	depth := 0
+	i := s.pos
+	for i < len(s.sql) {
+		if strings.HasPrefix(s.sql[i:], "/*") {
+			if depth == 0 || s.options.nestedComments {
+				depth++
+			}
+			i += 2
+		} else if strings.HasPrefix(s.sql[i:], "*/") {
+			depth--
+			i += 2
+			if depth == 0 {
+				break
+			}
+		} else {
+			i++
+		}
+	}
+	s.skipTo(i)
+}
+
+// skipQuoted skips quoted string or identifier, doubled closing quote is an escaped quote
+func (s *splitter) skipQuoted(close byte, backslash bool) {
+	i := s.pos + 1
+	for i < len(s.sql) {
+		c := s.sql[i]
+		if backslash && c == '\\' {
+			i += 2
+			continue
+		}
+		i++
+		if c == close {
+			if i < len(s.sql) && s.sql[i] == close {
+				i++
+				continue
+			}
+			break
+		}
+	}
+	if i > len(s.sql) {
+		i = len(s.sql)
+	}
+	s.skipTo(i)
+}
+
+// escapeStringPrefix returns true when quote at current position is preceded by E prefix
+func (s *splitter) escapeStringPrefix() bool {
+	i := s.pos
+	return i >= 1 && (s.sql[i-1] == 'E' || s.sql[i-1] == 'e') && (i == 1 || !isIdentifierChar(s.sql[i-2]))
+}
+
+// dollarQuote skips $tag$ ... $tag$ string, returns false when current position is not a start of dollar quote
+func (s *splitter) dollarQuote() bool {
+	if s.pos > 0 && isIdentifierChar(s.sql[s.pos-1]) {
+		return false
+	}
+	i := s.pos + 1
+	for i < len(s.sql) && isIdentifierChar(s.sql[i]) && s.sql[i] != '$' {
+		// tags cannot start with a digit, $1 is a parameter
+		if i == s.pos+1 && isDigit(s.sql[i]) {
+			return false
+		}
+		i++
+	}
+	if i >= len(s.sql) || s.sql[i] != '$' {
+		return false
+	}
+	tag := s.sql[s.pos : i+1]
+	end := len(s.sql)
+	if j := strings.Index(s.sql[i+1:], tag); j >= 0 {
+		end = i + 1 + j + len(tag)
+	}
+	s.skipTo(end)
+	return true
+}
+
+// word reads keyword or identifier and tracks trigger bodies
+// word ends at delimiter, custom delimiters like $$ consist of identifier characters: end$$
+func (s *splitter) word() {
+	i := s.pos
+	for i < len(s.sql) && isIdentifierChar(s.sql[i]) && (i == s.pos || !strings.HasPrefix(s.sql[i:], s.delimiter)) {
+		i++
+	}
+	word := strings.ToLower(s.sql[s.pos:i])
+	s.pos = i
+
+	if !s.options.triggerBodies {
+		return
+	}
+	if len(s.words) < 3 {
+		s.words = append(s.words, word)
+		s.trigger = isCreateTrigger(s.words)
+		return
+	}
+	if !s.trigger || s.ended {
+		return
+	}
+	switch word {
+	case "begin":
+		s.begun = true
+	case "case":
+		s.caseDepth++
+	case "end":
+		if s.caseDepth > 0 {
+			s.caseDepth--
+		} else if s.begun {
+			s.ended = true
+		}
+	}
+}
+
+func (s *splitter) inTriggerBody() bool {
+	return s.trigger && !s.ended
+}
+
+// isCreateTrigger checks if first words of statement are: create [temp | temporary] trigger
+func isCreateTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "create" {
+		return false
+	}
+	if words[1] == "trigger" {
+		return true
+	}
+	return len(words) == 3 && (words[1] == "temp" || words[1] == "temporary") && words[2] == "trigger"
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentifierChar returns true for ASCII letters, digits, _ and $ as well as all non-ASCII bytes
+func isIdentifierChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_' || c == '$' || c >= 0x80
+}
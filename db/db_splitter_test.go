@@ -0,0 +1,148 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- create tables
+create table abc (id int, name varchar(100) default 'a;b');
+
+/* comment; with semicolon */
+create table "d;ef" (id int);
+insert into abc values (1, 'it''s; fine');   -- trailing comment;
+-- only comment;
+`
+	statements := splitStatements(sql, splitOptions{})
+	assert.Equal(t, []statement{
+		{sql: "-- create tables\ncreate table abc (id int, name varchar(100) default 'a;b')", line: 1},
+		{sql: "/* comment; with semicolon */\ncreate table \"d;ef\" (id int)", line: 4},
+		{sql: "insert into abc values (1, 'it''s; fine')", line: 6},
+	}, statements)
+
+	assert.Empty(t, splitStatements("", splitOptions{}))
+	assert.Empty(t, splitStatements(" ;\n -- comment\n/* comment */;", splitOptions{}))
+	assert.Equal(t, []statement{{sql: "select 1", line: 1}}, splitStatements("select 1", splitOptions{}))
+	// unterminated strings and comments end with SQL
+	assert.Equal(t, []statement{{sql: "select 'abc;", line: 1}}, splitStatements("select 'abc;", splitOptions{}))
+	assert.Empty(t, splitStatements("/* select 1;", splitOptions{}))
+}
+
+func TestSplitStatementsPostgreSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	sql := `create function abc() returns trigger as $$
+begin
+  new.name := 'a;b';
+  return new;
+end;
+$$ language plpgsql;
+create function def() returns text as $body$ select 'x$$;y' $body$ language sql;
+select E'it\'s; escaped', $1;
+/* outer /* nested; */ still comment; */ select 'a\';
+`
+	statements := dialect.SplitStatements(sql)
+	assert.Len(t, statements, 4)
+	assert.Equal(t, 1, statements[0].line)
+	assert.Contains(t, statements[0].sql, "return new;\nend;\n$$ language plpgsql")
+	assert.Equal(t, statement{sql: "create function def() returns text as $body$ select 'x$$;y' $body$ language sql", line: 7}, statements[1])
+	assert.Equal(t, statement{sql: `select E'it\'s; escaped', $1`, line: 8}, statements[2])
+	assert.Equal(t, statement{sql: `/* outer /* nested; */ still comment; */ select 'a\'`, line: 9}, statements[3])
+}
+
+func TestSplitStatementsMySQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	sql := `# hash comment;
+insert into abc values ('it\'s; escaped', "a;b", ` + "`c;d`" + `);
+select 1 --1;
+DELIMITER //
+create procedure abc()
+begin
+  select 1;
+  select 2;
+end//
+delimiter ;
+select 3;
+`
+	statements := dialect.SplitStatements(sql)
+	assert.Equal(t, []statement{
+		{sql: "# hash comment;\ninsert into abc values ('it\\'s; escaped', \"a;b\", `c;d`)", line: 1},
+		{sql: "select 1 --1", line: 3},
+		{sql: "create procedure abc()\nbegin\n  select 1;\n  select 2;\nend", line: 5},
+		{sql: "select 3", line: 11},
+	}, statements)
+
+	// delimiter consisting of identifier characters directly after keyword or number
+	sql = `DELIMITER $$
+create procedure abc()
+begin
+  select 1;
+END$$
+select 1$$
+DELIMITER ;
+`
+	statements = dialect.SplitStatements(sql)
+	assert.Equal(t, []statement{
+		{sql: "create procedure abc()\nbegin\n  select 1;\nEND", line: 2},
+		{sql: "select 1", line: 6},
+	}, statements)
+}
+
+func TestSplitStatementsMSSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	sql := `create table abc (id int);
+insert into abc values (1);
+GO
+create procedure [it's] as
+begin
+  select 'GO
+GO';
+  select 2;
+end
+  go 2
+/*
+GO
+*/
+select 3
+`
+	statements := dialect.SplitStatements(sql)
+	procedure := "create procedure [it's] as\nbegin\n  select 'GO\nGO';\n  select 2;\nend"
+	assert.Equal(t, []statement{
+		{sql: "create table abc (id int);\ninsert into abc values (1);", line: 1},
+		{sql: procedure, line: 4},
+		{sql: procedure, line: 4},
+		{sql: "/*\nGO\n*/\nselect 3", line: 11},
+	}, statements)
+}
+
+func TestSplitStatementsSQLite(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	sql := `create table abc (id int, name text);
+create temp trigger abc_insert after insert on abc
+begin
+  update abc set name = case when new.name is null then 'x' else new.name end where id = new.id;
+  select 1;
+end;
+create table [d;ef] (id int);
+`
+	statements := dialect.SplitStatements(sql)
+	assert.Len(t, statements, 3)
+	assert.Equal(t, statement{sql: "create table abc (id int, name text)", line: 1}, statements[0])
+	assert.Equal(t, 2, statements[1].line)
+	assert.Contains(t, statements[1].sql, "select 1;\nend")
+	assert.Equal(t, statement{sql: "create table [d;ef] (id int)", line: 7}, statements[2])
+}
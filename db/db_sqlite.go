@@ -0,0 +1,227 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	// blank import for SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDialect emulates schemas using table name prefixes:
+// {schema}.table in migrations becomes schema_table
+// migrator tables are already prefixed with migrator_ and are created without additional prefix
+type sqliteDialect struct {
+	baseDialect
+}
+
+const (
+	insertMigrationSQLiteDialectSQL      = "insert into %v (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	insertTenantSQLiteDialectSQL         = "insert into %v (name) values (?)"
+	insertVersionSQLiteDialectSQL        = "insert into %v (name, commit_sha) values (?, ?)"
+	selectTenantsSQLiteDialectSQL        = "select name from %v"
+	selectMigrationsSQLiteDialectSQL     = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum, down_contents from %v order by name, source_dir"
+	selectVersionsSQLiteDialectSQL       = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v mv left join %v mm on mv.id = mm.version_id order by vid desc, mid asc"
+	selectVersionsByFileSQLiteDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v mv left join %v mm on mv.id = mm.version_id where mv.id in (select version_id from %v where filename = ?) order by vid desc, mid asc"
+	selectVersionByIDSQLiteDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v mv left join %v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
+	selectMigrationByIDSQLiteDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v where id = ?"
+	deleteMigrationSQLiteDialectSQL      = "delete from %v where id = ?"
+	updateVersionTenantsSQLiteDialectSQL = "update %v set tenants = ? where id = ?"
+	updateChecksumSQLiteDialectSQL       = "update %v set contents = ?, checksum = ? where filename = ?"
+	createSchemaSQLiteDialectSQL         = "-- SQLite does not support schemas, schema %v is emulated using table name prefixes"
+	lockSQLiteDialectSQL                 = "select 1"
+	unlockSQLiteDialectSQL               = "select 1"
+	createTenantsTableSQLiteDialectSQL   = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp
+)
+`
+	createVersionsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp,
+  commit_sha varchar(40),
+  tenants text
+)
+`
+	createMigrationsTableSQLiteDialectSQL = `
+create table if not exists %v (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  source_dir varchar(200) not null,
+  filename varchar(200) not null,
+  type int not null,
+  db_schema varchar(200) not null,
+  created timestamp default current_timestamp,
+  contents text,
+  checksum varchar(64),
+  version_id integer not null references %v (id) on delete cascade,
+  down_contents text
+)
+`
+	createMigrationsVersionIDIndexSQLiteDialectSQL = "create index if not exists migrator_versions_version_id_idx on %v (version_id)"
+	createJobsTableSQLiteDialectSQL                = `
+create table if not exists %v (
+  id varchar(32) primary key,
+  job text not null,
+  finished bigint,
+  updated bigint
+)
+`
+	insertJobSQLiteDialectSQL  = "insert into %v (id, job, updated) values (?, ?, ?)"
+	updateJobSQLiteDialectSQL  = "update %v set job = ?, finished = ?, updated = ? where id = ?"
+	selectJobSQLiteDialectSQL  = "select job from %v where id = ?"
+	deleteJobsSQLiteDialectSQL = "delete from %v where finished < ?"
+)
+
+// LastInsertIDSupported instructs migrator if Result.LastInsertId() is supported by the DB driver
+func (sd *sqliteDialect) LastInsertIDSupported() bool {
+	return true
+}
+
+// GetMigrationInsertSQL returns SQLite-specific migration insert SQL statement
+func (sd *sqliteDialect) GetMigrationInsertSQL() string {
+	return fmt.Sprintf(insertMigrationSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetTenantInsertSQL returns SQLite-specific migrator's default tenant insert SQL statement
+func (sd *sqliteDialect) GetTenantInsertSQL() string {
+	return fmt.Sprintf(insertTenantSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetTenantSelectSQL returns SQLite-specific migrator's default tenant select SQL statement
+func (sd *sqliteDialect) GetTenantSelectSQL() string {
+	return fmt.Sprintf(selectTenantsSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetMigrationSelectSQL returns SQLite-specific migrations select SQL statement
+func (sd *sqliteDialect) GetMigrationSelectSQL() string {
+	return fmt.Sprintf(selectMigrationsSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetVersionInsertSQL() string {
+	return fmt.Sprintf(insertVersionSQLiteDialectSQL, migratorVersionsTable)
+}
+
+// GetCreateSchemaSQL returns no-op SQL statement, SQLite does not support schemas
+func (sd *sqliteDialect) GetCreateSchemaSQL(schema string) string {
+	return fmt.Sprintf(createSchemaSQLiteDialectSQL, schema)
+}
+
+// GetCreateTenantsTableSQL returns SQLite-specific create tenants table SQL statement
+func (sd *sqliteDialect) GetCreateTenantsTableSQL() string {
+	return fmt.Sprintf(createTenantsTableSQLiteDialectSQL, migratorTenantsTable)
+}
+
+// GetCreateMigrationsTableSQL returns SQLite-specific create migrations table SQL statement.
+// SQLite support is newer than versions and down migrations so migrations table
+// is created together with version_id and down_contents columns.
+func (sd *sqliteDialect) GetCreateMigrationsTableSQL() string {
+	return fmt.Sprintf(createMigrationsTableSQLiteDialectSQL, migratorMigrationsTable, migratorVersionsTable)
+}
+
+// GetCreateVersionsTableSQL returns SQLite-specific SQLs which create versions table
+// and index on version_id column, there are no legacy migrations tables to upgrade
+func (sd *sqliteDialect) GetCreateVersionsTableSQL() []string {
+	return []string{
+		fmt.Sprintf(createVersionsTableSQLiteDialectSQL, migratorVersionsTable),
+		fmt.Sprintf(createMigrationsVersionIDIndexSQLiteDialectSQL, migratorMigrationsTable),
+	}
+}
+
+// GetAddDownContentsColumnSQL returns no SQLs, down_contents column is created together with migrations table
+func (sd *sqliteDialect) GetAddDownContentsColumnSQL() []string {
+	return []string{}
+}
+
+// GetAddCommitShaColumnSQL returns no SQLs, commit_sha column is created together with versions table
+func (sd *sqliteDialect) GetAddCommitShaColumnSQL() []string {
+	return []string{}
+}
+
+// GetAddTenantsColumnSQL returns no SQLs, tenants column is created together with versions table
+func (sd *sqliteDialect) GetAddTenantsColumnSQL() []string {
+	return []string{}
+}
+
+// GetVersionTenantsUpdateSQL returns SQLite-specific SQL which updates succeeded and failed tenants of version
+func (sd *sqliteDialect) GetVersionTenantsUpdateSQL() string {
+	return fmt.Sprintf(updateVersionTenantsSQLiteDialectSQL, migratorVersionsTable)
+}
+
+// GetVersionsSelectSQL returns SQLite-specific select SQL statement that returns all versions
+func (sd *sqliteDialect) GetVersionsSelectSQL() string {
+	return fmt.Sprintf(selectVersionsSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetVersionsByFileSQL() string {
+	return fmt.Sprintf(selectVersionsByFileSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetVersionByIDSQL() string {
+	return fmt.Sprintf(selectVersionByIDSQLiteDialectSQL, migratorVersionsTable, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetMigrationByIDSQL() string {
+	return fmt.Sprintf(selectMigrationByIDSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+func (sd *sqliteDialect) GetMigrationDeleteSQL() string {
+	return fmt.Sprintf(deleteMigrationSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetMigrationChecksumUpdateSQL returns SQLite-specific SQL which updates contents and checksum of applied migration
+func (sd *sqliteDialect) GetMigrationChecksumUpdateSQL() string {
+	return fmt.Sprintf(updateChecksumSQLiteDialectSQL, migratorMigrationsTable)
+}
+
+// GetCreateJobsTableSQL returns SQLite-specific create jobs table SQL statement
+func (sd *sqliteDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns SQLite-specific SQL which inserts job
+func (sd *sqliteDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns SQLite-specific SQL which updates job and its finished timestamp
+func (sd *sqliteDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobSelectSQL returns SQLite-specific SQL which selects job by ID
+func (sd *sqliteDialect) GetJobSelectSQL() string {
+	return fmt.Sprintf(selectJobSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetJobsDeleteSQL returns SQLite-specific SQL which deletes jobs finished before passed timestamp
+func (sd *sqliteDialect) GetJobsDeleteSQL() string {
+	return fmt.Sprintf(deleteJobsSQLiteDialectSQL, migratorJobsTable)
+}
+
+// GetLockSQL returns SQLite-specific lock SQL, SQLite does not support named locks
+// and concurrent writes are serialized by SQLite itself
+func (sd *sqliteDialect) GetLockSQL() string {
+	return lockSQLiteDialectSQL
+}
+
+// GetUnlockSQL returns SQLite-specific unlock SQL
+func (sd *sqliteDialect) GetUnlockSQL() string {
+	return unlockSQLiteDialectSQL
+}
+
+// ReplaceSchemaPlaceHolder emulates schemas using table name prefixes:
+// {schema}.table is replaced with schema_table, all other occurrences of {schema} are replaced with schema
+func (sd *sqliteDialect) ReplaceSchemaPlaceHolder(contents, schemaPlaceHolder, schema string) string {
+	contents = strings.Replace(contents, schemaPlaceHolder+".", schema+"_", -1)
+	return strings.Replace(contents, schemaPlaceHolder, schema, -1)
+}
+
+// SplitStatements splits SQL on semicolons, CREATE TRIGGER bodies are not split
+func (sd *sqliteDialect) SplitStatements(sql string) []statement {
+	return splitStatements(sql, splitOptions{bracketIdentifiers: true, triggerBodies: true})
+}
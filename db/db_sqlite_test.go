@@ -0,0 +1,340 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBCreateDialectSQLiteDriver(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+	assert.IsType(t, &sqliteDialect{}, dialect)
+}
+
+func TestSQLiteLastInsertIdSupported(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+	lastInsertIDSupported := dialect.LastInsertIDSupported()
+
+	assert.True(t, lastInsertIDSupported)
+}
+
+func TestSQLiteGetMigrationInsertSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	insertMigrationSQL := dialect.GetMigrationInsertSQL()
+
+	assert.Equal(t, "insert into migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id, down_contents) values (?, ?, ?, ?, ?, ?, ?, ?, ?)", insertMigrationSQL)
+}
+
+func TestSQLiteGetTenantInsertAndSelectSQLDefault(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, nil}
+	defer connector.Dispose()
+
+	assert.Equal(t, "insert into migrator_tenants (name) values (?)", connector.getTenantInsertSQL())
+	assert.Equal(t, "select name from migrator_tenants", connector.getTenantSelectSQL())
+}
+
+func TestSQLiteGetVersionInsertSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	versionInsertSQL := dialect.GetVersionInsertSQL()
+
+	assert.Equal(t, "insert into migrator_versions (name, commit_sha) values (?, ?)", versionInsertSQL)
+}
+
+func TestSQLiteGetCreateSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	createSchemaSQL := dialect.GetCreateSchemaSQL("abc")
+
+	assert.Equal(t, "-- SQLite does not support schemas, schema abc is emulated using table name prefixes", createSchemaSQL)
+}
+
+func TestSQLiteGetVersionsByFileSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	versionsByFile := dialect.GetVersionsByFileSQL()
+
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator_versions mv left join migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator_migrations where filename = ?) order by vid desc, mid asc", versionsByFile)
+}
+
+func TestSQLiteGetVersionByIDSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	versionsByID := dialect.GetVersionByIDSQL()
+
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mv.commit_sha as vcommitsha, mv.tenants as vtenants, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator_versions mv left join migrator_migrations mm on mv.id = mm.version_id where mv.id = ? order by mid asc", versionsByID)
+}
+
+func TestSQLiteGetMigrationByIDAndDeleteSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator_migrations where id = ?", dialect.GetMigrationByIDSQL())
+	assert.Equal(t, "delete from migrator_migrations where id = ?", dialect.GetMigrationDeleteSQL())
+	assert.Equal(t, "update migrator_migrations set contents = ?, checksum = ? where filename = ?", dialect.GetMigrationChecksumUpdateSQL())
+}
+
+func TestSQLiteReplaceSchemaPlaceHolder(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	contents := dialect.ReplaceSchemaPlaceHolder("create table {schema}.users (id integer references ref_roles(id)); insert into {schema}.users values (1); -- {schema}", "{schema}", "abc")
+
+	assert.Equal(t, "create table abc_users (id integer references ref_roles(id)); insert into abc_users values (1); -- abc", contents)
+}
+
+// TestSQLiteInProcess runs full migrator flow against in-process SQLite database
+// and does not require any external database
+func TestSQLiteInProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrator-sqlite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &config.Config{}
+	config.Driver = "sqlite3"
+	config.DataSource = fmt.Sprintf("file:%v?_foreign_keys=1", filepath.Join(dir, "migrator.db"))
+
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, err)
+	defer unlock()
+
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Empty(t, tenants)
+
+	tenant := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (k int, v text)", DownContents: "drop table {schema}.settings"}
+	results, version, err := connector.CreateTenant("new tenant", "", types.ActionApply, false, "abc", []types.Migration{tenant})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+	assert.Equal(t, "new tenant", version.Name)
+	tenants, err = connector.GetTenants()
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Tenant{{Name: "abc"}}, tenants)
+
+	public := types.Migration{Name: "002.sql", SourceDir: "public", File: "public/002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.modules (k int, v text)"}
+	tenantInsert := types.Migration{Name: "003.sql", SourceDir: "tenants", File: "tenants/003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (1, '{schema}')", DownContents: "delete from {schema}.settings"}
+	results, version, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, []types.Migration{public, tenantInsert})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+	assert.Len(t, version.DBMigrations, 2)
+	assert.Equal(t, "abc", version.DBMigrations[1].Schema)
+	dbMigrations, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
+	assert.Len(t, dbMigrations, 3)
+	versions, err := connector.GetVersionsByFile("tenants/003.sql")
+	assert.Nil(t, err)
+	assert.Len(t, versions, 1)
+
+	// schemas are emulated with table name prefixes
+	bc := connector.(*baseConnector)
+	var count int
+	assert.Nil(t, bc.db.QueryRow("select count(*) from abc_settings where v = 'abc'").Scan(&count))
+	assert.Equal(t, 1, count)
+	assert.Nil(t, bc.db.QueryRow("select count(*) from public_modules").Scan(&count))
+	assert.Equal(t, 0, count)
+
+	// versions are sorted in descending order, revert the first one
+	versions, err = connector.GetVersions()
+	assert.Nil(t, err)
+	tenantVersion := versions[1]
+	revertResults, revertVersion, err := connector.RevertVersion("revert", false, &tenantVersion)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), revertResults.TenantMigrationsTotal)
+	assert.Equal(t, "tenants/001.down.sql", revertVersion.DBMigrations[0].File)
+	assert.NotNil(t, bc.db.QueryRow("select count(*) from abc_settings").Scan(&count))
+
+	dbMigration, err := connector.GetDBMigrationByID(revertVersion.DBMigrations[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "drop table {schema}.settings", dbMigration.Contents)
+}
+
+func TestSQLiteInProcessTransactionStrategies(t *testing.T) {
+	for _, params := range []struct {
+		strategy    string
+		concurrency int
+	}{{config.TransactionStrategyPerTenant, 0}, {config.TransactionStrategyPerMigration, 0}, {config.TransactionStrategyPerTenant, 4}} {
+		strategy := params.strategy
+		dir, err := ioutil.TempDir("", "migrator-sqlite")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		cfg := &config.Config{}
+		cfg.Driver = "sqlite3"
+		cfg.DataSource = fmt.Sprintf("file:%v?_foreign_keys=1", filepath.Join(dir, "migrator.db"))
+		cfg.TransactionStrategy = strategy
+		cfg.TenantConcurrency = params.concurrency
+
+		connector := New(newTestContext(), cfg)
+		defer connector.Dispose()
+
+		for _, tenant := range []string{"abc", "def", "ghi"} {
+			_, _, err = connector.CreateTenant(tenant, "", types.ActionApply, false, tenant, []types.Migration{})
+			assert.Nil(t, err)
+		}
+
+		// settings table does not exist for tenant def so the second migration fails for tenant def
+		bc := connector.(*baseConnector)
+		_, err = bc.db.Exec("create table abc_settings (k int)")
+		assert.Nil(t, err)
+		_, err = bc.db.Exec("create table ghi_settings (k int)")
+		assert.Nil(t, err)
+
+		public := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.modules (k int)"}
+		create := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.users (k int)"}
+		insert := types.Migration{Name: "003.sql", SourceDir: "tenants", File: "tenants/003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (1)"}
+		migrations := []types.Migration{public, create, insert}
+
+		results, version, err := connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrations)
+		assert.Nil(t, err)
+		// tenants are reported in order regardless of concurrency
+		assert.Equal(t, []string{"abc", "ghi"}, results.SucceededTenants)
+		assert.Len(t, results.FailedTenants, 1)
+		assert.Equal(t, "def", results.FailedTenants[0].Name)
+		assert.Equal(t, "tenants/003.sql", results.FailedTenants[0].File)
+		assert.Contains(t, results.FailedTenants[0].Error, "no such table: def_settings")
+		assert.Equal(t, int32(1), results.SingleMigrations)
+		// succeeded and failed tenants are stored together with version
+		assert.Equal(t, results.SucceededTenants, version.SucceededTenants)
+		assert.Equal(t, results.FailedTenants, version.FailedTenants)
+		assert.Equal(t, types.VersionStatePartial, version.State)
+		versions, err := connector.GetVersionsByFile("tenants/003.sql")
+		assert.Nil(t, err)
+		assert.Equal(t, results.FailedTenants, versions[0].FailedTenants)
+		assert.Equal(t, types.VersionStatePartial, versions[0].State)
+
+		var count int
+		err = bc.db.QueryRow("select count(*) from def_users").Scan(&count)
+		if strategy == config.TransactionStrategyPerTenant {
+			// all migrations of failed tenant are rolled back
+			assert.NotNil(t, err)
+			assert.Len(t, version.DBMigrations, 5)
+		} else {
+			// only failed migration is rolled back
+			assert.Nil(t, err)
+			assert.Len(t, version.DBMigrations, 6)
+		}
+
+		// plan contains only tenants for which migrations were not applied
+		plan, err := connector.PlanMigrations([]types.Migration{create, insert})
+		assert.Nil(t, err)
+		assert.Equal(t, int32(3), plan.Tenants)
+		assert.Equal(t, []types.PlannedSchema{{Schema: "def", SQL: "insert into def_settings values (1)"}}, plan.Migrations[1].Schemas)
+		if strategy == config.TransactionStrategyPerTenant {
+			assert.Equal(t, []types.PlannedSchema{{Schema: "def", SQL: "create table def_users (k int)"}}, plan.Migrations[0].Schemas)
+		} else {
+			assert.Empty(t, plan.Migrations[0].Schemas)
+		}
+
+		// retry, migrations already applied to tenants are skipped
+		_, err = bc.db.Exec("create table def_settings (k int)")
+		assert.Nil(t, err)
+		results, _, err = connector.CreateVersion("retry", "", types.ActionApply, false, []types.Migration{create, insert})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"abc", "def", "ghi"}, results.SucceededTenants)
+		assert.Empty(t, results.FailedTenants)
+		version, err = connector.GetVersionByID(version.ID + 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"abc", "def", "ghi"}, version.SucceededTenants)
+		assert.Empty(t, version.FailedTenants)
+		assert.Equal(t, types.VersionStateSucceeded, version.State)
+		assert.Nil(t, bc.db.QueryRow("select count(*) from def_settings").Scan(&count))
+		assert.Equal(t, 1, count)
+		assert.Nil(t, bc.db.QueryRow("select count(*) from abc_settings").Scan(&count))
+		assert.Equal(t, 1, count)
+
+		// migration failing for all tenants leaves a failed version
+		missing := types.Migration{Name: "004.sql", SourceDir: "tenants", File: "tenants/004.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.missing values (1)"}
+		results, version, err = connector.CreateVersion("missing", "", types.ActionApply, false, []types.Migration{missing})
+		assert.Nil(t, err)
+		assert.Empty(t, results.SucceededTenants)
+		assert.Len(t, results.FailedTenants, 3)
+		assert.Equal(t, types.VersionStateFailed, version.State)
+		assert.Empty(t, version.DBMigrations)
+	}
+}
+
+func TestSQLiteInProcessPerMigrationSingleMigrationFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrator-sqlite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{}
+	cfg.Driver = "sqlite3"
+	cfg.DataSource = fmt.Sprintf("file:%v?_foreign_keys=1", filepath.Join(dir, "migrator.db"))
+	cfg.TransactionStrategy = config.TransactionStrategyPerMigration
+
+	connector := New(newTestContext(), cfg)
+	defer connector.Dispose()
+
+	create := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.modules (k int)"}
+	insert := types.Migration{Name: "002.sql", SourceDir: "public", File: "public/002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "insert into {schema}.missing values (1)"}
+
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, []types.Migration{create, insert})
+	assert.NotNil(t, err)
+
+	// version with the first migration was already committed and is marked as failed
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions, 1)
+	assert.Equal(t, types.VersionStateFailed, versions[0].State)
+	assert.Len(t, versions[0].DBMigrations, 1)
+}
+
+func TestSQLiteGetJobSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlite3"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator_jobs (id, job, updated) values (?, ?, ?)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator_jobs set job = ?, finished = ?, updated = ? where id = ?", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select job from migrator_jobs where id = ?", dialect.GetJobSelectSQL())
+	assert.Equal(t, "delete from migrator_jobs where finished < ?", dialect.GetJobsDeleteSQL())
+	assert.Contains(t, dialect.GetCreateJobsTableSQL(), "create table if not exists migrator_jobs")
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -25,36 +26,43 @@ func newTestContext() context.Context {
 	return ctx
 }
 
-func TestDBCreateConnectorPanicUnknownDriver(t *testing.T) {
+func TestDBCreateConnectorUnknownDriver(t *testing.T) {
 	config := &config.Config{}
 	config.Driver = "abcxyz"
 
-	assert.PanicsWithValue(t, "Failed to create Connector unknown driver: abcxyz", func() {
-		New(newTestContext(), config)
-	})
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	_, err := connector.GetTenants()
+	assert.Equal(t, "Failed to create Connector unknown driver: abcxyz", err.Error())
+	assert.Equal(t, err, NewPinger(config).PingContext(context.TODO()))
 }
 
-func TestConnectorInitPanicConnectionError(t *testing.T) {
+func TestNewPinger(t *testing.T) {
 	config, err := config.FromFile("../test/migrator.yaml")
 	assert.Nil(t, err)
 
-	config.DataSource = strings.Replace(config.DataSource, "127.0.0.1", "1.0.0.1", -1)
+	pinger := NewPinger(config)
+	assert.Nil(t, pinger.PingContext(context.TODO()))
+	assert.Nil(t, pinger.PingContext(context.TODO()))
+}
 
-	didPanic := false
-	var message interface{}
-	func() {
+func TestConnectorInitConnectionError(t *testing.T) {
+	config, err := config.FromFile("../test/migrator.yaml")
+	assert.Nil(t, err)
 
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
+	if config.Driver == "sqlite3" {
+		// SQLite is an in-process database, the only way to fail is to point it to non-existent directory
+		config.DataSource = "file:/non/existent/directory/migrator.db"
+	} else {
+		config.DataSource = strings.Replace(config.DataSource, "127.0.0.1", "1.0.0.1", -1)
+	}
 
-		New(newTestContext(), config)
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
 
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "Failed to connect to database")
+	_, _, err = connector.CreateVersion("commit-sha", "", types.ActionApply, false, []types.Migration{{Name: "001.sql"}})
+	assert.Contains(t, err.Error(), "Failed to connect to database")
 }
 
 func TestGetTenants(t *testing.T) {
@@ -64,7 +72,8 @@ func TestGetTenants(t *testing.T) {
 	connector := New(newTestContext(), config)
 	defer connector.Dispose()
 
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 
 	assert.True(t, len(tenants) >= 3)
 	assert.Contains(t, tenants, types.Tenant{Name: "abc"})
@@ -79,10 +88,12 @@ func TestCreateVersion(t *testing.T) {
 	connector := New(newTestContext(), config)
 	defer connector.Dispose()
 
-	tenants := connector.GetTenants()
+	tenants, err := connector.GetTenants()
+	assert.Nil(t, err)
 	noOfTenants := len(tenants)
 
-	dbMigrationsBefore := connector.GetAppliedMigrations()
+	dbMigrationsBefore, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
 	lenBefore := len(dbMigrationsBefore)
 
 	p1 := time.Now().UnixNano()
@@ -114,11 +125,13 @@ func TestCreateVersion(t *testing.T) {
 
 	migrationsToApply := []types.Migration{public1, public2, public3, tenant1, tenant2, tenant3, public4, public5, tenant4}
 
-	results, version := connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
+	results, version, err := connector.CreateVersion("commit-sha", "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", types.ActionApply, false, migrationsToApply)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, "commit-sha", version.Name)
+	assert.Equal(t, "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3", version.CommitSha)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
 	assert.Equal(t, int32(noOfTenants), results.Tenants)
 	assert.Equal(t, int32(3), results.SingleMigrations)
@@ -130,7 +143,8 @@ func TestCreateVersion(t *testing.T) {
 	assert.Equal(t, int32(noOfTenants*3+3), results.MigrationsGrandTotal)
 	assert.Equal(t, int32(noOfTenants*1+2), results.ScriptsGrandTotal)
 
-	dbMigrationsAfter := connector.GetAppliedMigrations()
+	dbMigrationsAfter, err := connector.GetAppliedMigrations()
+	assert.Nil(t, err)
 	lenAfter := len(dbMigrationsAfter)
 
 	// 3 tenant migrations * no of tenants + 3 public
@@ -148,7 +162,8 @@ func TestCreateVersionEmptyMigrationArray(t *testing.T) {
 
 	migrationsToApply := []types.Migration{}
 
-	results, version := connector.CreateVersion("commit-sha", types.ActionApply, false, migrationsToApply)
+	results, version, err := connector.CreateVersion("commit-sha", "", types.ActionApply, false, migrationsToApply)
+	assert.Nil(t, err)
 	// empty migrations slice - no version created
 	assert.Nil(t, version)
 	assert.Equal(t, int32(0), results.MigrationsGrandTotal)
@@ -174,19 +189,20 @@ func TestCreateVersionDryRunMode(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionApply, true, migrationsToApply)
+	results, version, err := connector.CreateVersion("commit-sha", "", types.ActionApply, true, migrationsToApply)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -216,17 +232,18 @@ func TestCreateVersionSyncMode(t *testing.T) {
 	mock.ExpectBegin()
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit()
 
 	// sync the results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionSync, false, migrationsToApply)
+	results, version, err := connector.CreateVersion("commit-sha", "", types.ActionSync, false, migrationsToApply)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -241,6 +258,7 @@ func TestGetTenantsSQLDefault(t *testing.T) {
 	config, err := config.FromFile("../test/migrator.yaml")
 	assert.Nil(t, err)
 
+	config.Driver = "postgres"
 	dialect := newDialect(config)
 	connector := baseConnector{newTestContext(), config, dialect, nil}
 	defer connector.Dispose()
@@ -308,7 +326,8 @@ func TestCreateTenant(t *testing.T) {
 
 	uniqueTenant := fmt.Sprintf("new_test_tenant_%v", time.Now().UnixNano())
 
-	results, version := connector.CreateTenant("commit-sha", types.ActionApply, false, uniqueTenant, migrationsToApply)
+	results, version, err := connector.CreateTenant("commit-sha", "", types.ActionApply, false, uniqueTenant, migrationsToApply)
+	assert.Nil(t, err)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
@@ -344,19 +363,20 @@ func TestCreateTenantDryRunMode(t *testing.T) {
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(1, 1))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateTenant("commit-sha", types.ActionApply, true, tenant, migrationsToApply)
+	results, version, err := connector.CreateTenant("commit-sha", "", types.ActionApply, true, tenant, migrationsToApply)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -388,17 +408,18 @@ func TestCreateTenantSyncMode(t *testing.T) {
 	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
-	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0, m.DownContents).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit()
 
 	// sync results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateTenant("commit-sha", types.ActionSync, false, tenant, migrationsToApply)
+	results, version, err := connector.CreateTenant("commit-sha", "", types.ActionSync, false, tenant, migrationsToApply)
+	assert.Nil(t, err)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -429,7 +450,8 @@ func TestGetVersions(t *testing.T) {
 	connector := New(newTestContext(), config)
 	defer connector.Dispose()
 
-	versions := connector.GetVersions()
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
 
 	assert.True(t, len(versions) >= 2)
 	// versions are sorted from newest (highest ID) to oldest (lowest ID)
@@ -446,7 +468,8 @@ func TestGetVersionsByFile(t *testing.T) {
 	connector := New(newTestContext(), config)
 	defer connector.Dispose()
 
-	versions := connector.GetVersionsByFile(existingVersion.DBMigrations[0].File)
+	versions, err := connector.GetVersionsByFile(existingVersion.DBMigrations[0].File)
+	assert.Nil(t, err)
 	version := versions[0]
 	assert.Equal(t, existingVersion.ID, version.ID)
 	assert.Equal(t, existingVersion.DBMigrations[0].File, version.DBMigrations[0].File)
@@ -501,3 +524,282 @@ func TestGetDBMigrationByIDNotFound(t *testing.T) {
 	assert.Nil(t, dbMigration)
 	assert.Equal(t, "DB migration not found ID: -1", err.Error())
 }
+
+func TestRevertVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	m1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (k int)", DownContents: "drop table {schema}.settings"}
+	m2 := types.Migration{Name: "201602220002.sql", SourceDir: "tenants", File: "tenants/201602220002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "alter table {schema}.settings add v int", DownContents: "alter table {schema}.settings drop column v"}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select 1"}
+	version := &types.Version{ID: 12, Name: "vname", DBMigrations: []types.DBMigration{{Migration: m1, ID: 34, Schema: "abc"}, {Migration: m2, ID: 35, Schema: "abc"}, {Migration: s1, ID: 36, Schema: "abc"}}}
+
+	down2 := downMigration(m2)
+	down1 := downMigration(m1)
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("revert", nil).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+	// migration insert and delete
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("delete from migrator.migrator_migrations")
+	// scripts are skipped, down migrations are executed in reverse order
+	mock.ExpectExec("alter table abc.settings drop column v").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("delete from").ExpectExec().WithArgs(35).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(down2.Name, down2.SourceDir, down2.File, down2.MigrationType, "abc", down2.Contents, down2.CheckSum, 0, "").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("drop table abc.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	// statements are already prepared on the transaction connection
+	mock.ExpectExec("delete from").WithArgs(34).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("insert into").WithArgs(down1.Name, down1.SourceDir, down1.File, down1.MigrationType, "abc", down1.Contents, down1.CheckSum, 0, "").WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "revert", time.Now(), nil, nil, "456", down2.Name, down2.SourceDir, down2.File, down2.MigrationType, "abc", time.Now(), down2.Contents, down2.CheckSum, nil).AddRow("123", "revert", time.Now(), nil, nil, "457", down1.Name, down1.SourceDir, down1.File, down1.MigrationType, "abc", time.Now(), down1.Contents, down1.CheckSum, nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, revertVersion, err := connector.RevertVersion("revert", false, version)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Tenants)
+	assert.Equal(t, int32(2), results.TenantMigrations)
+	assert.Equal(t, int32(2), results.TenantMigrationsTotal)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+	assert.Equal(t, int32(0), results.ScriptsGrandTotal)
+	assert.Equal(t, "revert", revertVersion.Name)
+	assert.Len(t, revertVersion.DBMigrations, 2)
+	assert.Equal(t, "tenants/201602220002.down.sql", revertVersion.DBMigrations[0].File)
+	assert.Equal(t, "tenants/201602220001.down.sql", revertVersion.DBMigrations[1].File)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairChecksums(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	m1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- fixed comment\ncreate table {schema}.settings (k int)", CheckSum: "sha256"}
+
+	mock.ExpectPrepare("update migrator.migrator_migrations set contents")
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Checksum repair by ci: fixed comment", "abc").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(123))
+	// all schemas are updated by a single statement, statement is already prepared on the transaction connection
+	mock.ExpectExec("update migrator.migrator_migrations").WithArgs(m1.Contents, m1.CheckSum, m1.File).WillReturnResult(sqlmock.NewResult(0, 3))
+	// get version, repair version has no DB migrations
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Checksum repair by ci: fixed comment", time.Now(), "abc", nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	mock.ExpectQuery("select").WithArgs(123).WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	version, err := connector.RepairChecksums("Checksum repair by ci: fixed comment", "abc", []types.Migration{m1})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(123), version.ID)
+	assert.Equal(t, "Checksum repair by ci: fixed comment", version.Name)
+	assert.Empty(t, version.DBMigrations)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairChecksumsError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	m1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, CheckSum: "sha256"}
+
+	mock.ExpectPrepare("update migrator.migrator_migrations")
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(123))
+	mock.ExpectExec("update migrator.migrator_migrations").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	_, err = connector.RepairChecksums("Checksum repair by ci: fixed comment", "", []types.Migration{m1})
+	assert.Equal(t, "Failed to update migration entry: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReadVersionsWithoutMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	// left join returns nulls for versions which migrations were all reverted
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "vcommitsha", "vtenants", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	versions, err := connector.GetVersions()
+	assert.Nil(t, err)
+	assert.Len(t, versions, 1)
+	assert.Equal(t, int32(123), versions[0].ID)
+	assert.NotNil(t, versions[0].DBMigrations)
+	assert.Len(t, versions[0].DBMigrations, 0)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectQuery("pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+	mock.ExpectExec("pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, err)
+	unlock()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockMigrationInProgress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	config.LockWaitTimeout = 1
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	// retry interval longer than wait timeout means there will be only 1 attempt
+	defaultLockRetryInterval := lockRetryInterval
+	lockRetryInterval = 2 * time.Second
+	defer func() { lockRetryInterval = defaultLockRetryInterval }()
+
+	mock.ExpectQuery("get_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, unlock)
+	assert.Equal(t, ErrMigrationInProgress, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectQuery("sp_getapplock").WillReturnError(errors.New("trouble maker"))
+
+	_, err = connector.Lock()
+	assert.Equal(t, "Could not acquire migrator lock: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetHistoryEntriesFlyway(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	// schema creation entry has no version and no checksum
+	rows := sqlmock.NewRows([]string{"version", "description", "script", "checksum", "type", "success"}).
+		AddRow(nil, "<< Flyway Schema Creation >>", `"public"`, nil, "SCHEMA", true).
+		AddRow("1.1", "add users", "V1.1__add_users.sql", -1601282348, "SQL", true).
+		AddRow("1.2", "add roles", "V1.2__add_roles.sql", 123, "SQL", false)
+	mock.ExpectQuery("select version, description, script, checksum, type, success from legacy.flyway_schema_history order by installed_rank").WillReturnRows(rows)
+
+	entries, err := connector.GetHistoryEntries(types.HistoryToolFlyway, "legacy.flyway_schema_history")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.HistoryEntry{
+		{Version: "", Description: "<< Flyway Schema Creation >>", Script: `"public"`, CheckSum: "", Type: "SCHEMA", Success: true},
+		{Version: "1.1", Description: "add users", Script: "V1.1__add_users.sql", CheckSum: "-1601282348", Type: "SQL", Success: true},
+		{Version: "1.2", Description: "add roles", Script: "V1.2__add_roles.sql", CheckSum: "123", Type: "SQL", Success: false},
+	}, entries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetHistoryEntriesLiquibase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	rows := sqlmock.NewRows([]string{"id", "author", "filename", "md5sum", "exectype"}).
+		AddRow("1", "lukasz", "db/ref/001.sql", "8:d41d8cd98f00b204e9800998ecf8427e", "EXECUTED").
+		AddRow("2", "lukasz", "db/ref/002.sql", nil, "FAILED")
+	mock.ExpectQuery("select id, author, filename, md5sum, exectype from DATABASECHANGELOG order by orderexecuted").WillReturnRows(rows)
+
+	entries, err := connector.GetHistoryEntries(types.HistoryToolLiquibase, "DATABASECHANGELOG")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.HistoryEntry{
+		{Version: "1", Description: "lukasz", Script: "db/ref/001.sql", CheckSum: "8:d41d8cd98f00b204e9800998ecf8427e", Type: "EXECUTED", Success: true},
+		{Version: "2", Description: "lukasz", Script: "db/ref/002.sql", CheckSum: "", Type: "FAILED", Success: false},
+	}, entries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetHistoryEntriesError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db}
+
+	mock.ExpectQuery("select").WillReturnError(errors.New("Invalid object name 'flyway_schema_history'"))
+
+	_, err = connector.GetHistoryEntries(types.HistoryToolFlyway, "flyway_schema_history")
+	assert.Equal(t, "Could not query Flyway history table flyway_schema_history: Invalid object name 'flyway_schema_history'", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -7,4 +7,4 @@ if [ -z "$MIGRATOR_YAML" ]; then
   MIGRATOR_YAML=$DEFAULT_YAML_LOCATION
 fi
 
-migrator -configFile "$MIGRATOR_YAML"
+migrator -configFile "$MIGRATOR_YAML" "$@"
@@ -3,6 +3,7 @@ module github.com/lukaszbudnik/migrator
 go 1.12
 
 require (
+	cloud.google.com/go/storage v1.6.0
 	github.com/Azure/azure-storage-blob-go v0.8.0
 	github.com/Azure/go-autorest/autorest/adal v0.8.2 // indirect
 	github.com/DATA-DOG/go-sqlmock v1.4.1
@@ -14,9 +15,12 @@ require (
 	github.com/graph-gophers/graphql-go v0.0.0-20200207002730-8334863f2c8b
 	github.com/leodido/go-urn v1.2.0 // indirect
 	github.com/lib/pq v1.3.0
+	github.com/mattn/go-sqlite3 v1.13.0
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/client_golang v1.5.1
 	github.com/stretchr/testify v1.4.0
-	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
+	google.golang.org/api v0.18.0
 	gopkg.in/go-playground/validator.v9 v9.29.1
+	gopkg.in/square/go-jose.v2 v2.4.1
 	gopkg.in/yaml.v2 v2.2.8
 )
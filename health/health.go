@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// Checker checks health of migrator and its dependencies
+type Checker interface {
+	// Live returns status of migrator process, it does not check any dependencies
+	Live() *types.Health
+	// Ready checks if DB and source migrations are reachable
+	Ready(ctx context.Context) *types.Health
+}
+
+// checker uses db.Pinger and loader.Loader to check dependencies
+// pinger keeps a long-lived connection so that probes do not open new DB connections nor initialise migrator tables
+type checker struct {
+	config    *config.Config
+	pinger    db.Pinger
+	newLoader loader.Factory
+}
+
+// New creates instance of Checker
+func New(config *config.Config, pinger db.Pinger, newLoader loader.Factory) Checker {
+	return &checker{config, pinger, newLoader}
+}
+
+func (c *checker) Live() *types.Health {
+	return &types.Health{Status: types.HealthStatusUp}
+}
+
+func (c *checker) Ready(ctx context.Context) *types.Health {
+	checks := []types.HealthCheck{
+		c.check(ctx, "database", func() error {
+			return c.pinger.PingContext(ctx)
+		}),
+		c.check(ctx, "loader", func() error {
+			return c.newLoader(ctx, c.config).HealthCheck()
+		}),
+	}
+
+	health := &types.Health{Status: types.HealthStatusUp, Checks: checks}
+	for _, check := range checks {
+		if check.Status == types.HealthStatusDown {
+			health.Status = types.HealthStatusDown
+		}
+	}
+	return health
+}
+
+// check measures latency of passed check function, unexpected panics are recovered and reported as failed check
+// health endpoints are not authenticated so errors are only logged and never returned
+func (c *checker) check(ctx context.Context, name string, checkFunc func() error) (check types.HealthCheck) {
+	check = types.HealthCheck{Name: name, Status: types.HealthStatusUp}
+	started := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			check.Status = types.HealthStatusDown
+			common.LogError(ctx, "Health check %v failed: %v", name, r)
+		}
+		check.LatencyMs = float64(time.Since(started)) / float64(time.Millisecond)
+	}()
+
+	if err := checkFunc(); err != nil {
+		check.Status = types.HealthStatusDown
+		common.LogError(ctx, "Health check %v failed: %v", name, err)
+	}
+	return check
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+type mockedPinger struct {
+	pingError error
+	panics    bool
+	pings     int
+}
+
+func (m *mockedPinger) PingContext(context.Context) error {
+	m.pings++
+	// unexpected panics are reported as failed check
+	if m.panics {
+		panic("Failed to connect to database: connection refused")
+	}
+	return m.pingError
+}
+
+type mockedLoader struct {
+	healthCheckError error
+}
+
+func (m *mockedLoader) GetSourceMigrations() ([]types.Migration, error) {
+	return []types.Migration{}, nil
+}
+
+func (m *mockedLoader) HealthCheck() error {
+	return m.healthCheckError
+}
+
+func (m *mockedLoader) GetCommitSha() string {
+	return ""
+}
+
+func newMockedLoader(context.Context, *config.Config) loader.Loader {
+	return &mockedLoader{}
+}
+
+func newMockedErrorLoader(context.Context, *config.Config) loader.Loader {
+	return &mockedLoader{healthCheckError: errors.New("Could not read source dir /migrations/ref")}
+}
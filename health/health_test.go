@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func TestLive(t *testing.T) {
+	checker := New(&config.Config{}, &mockedPinger{panics: true}, newMockedErrorLoader)
+
+	health := checker.Live()
+
+	assert.Equal(t, types.HealthStatusUp, health.Status)
+	assert.Empty(t, health.Checks)
+}
+
+func TestReady(t *testing.T) {
+	pinger := &mockedPinger{}
+	checker := New(&config.Config{}, pinger, newMockedLoader)
+
+	health := checker.Ready(context.TODO())
+
+	assert.Equal(t, types.HealthStatusUp, health.Status)
+	assert.Len(t, health.Checks, 2)
+	assert.Equal(t, "database", health.Checks[0].Name)
+	assert.Equal(t, types.HealthStatusUp, health.Checks[0].Status)
+	assert.True(t, health.Checks[0].LatencyMs >= 0)
+	assert.Equal(t, "loader", health.Checks[1].Name)
+	assert.Equal(t, types.HealthStatusUp, health.Checks[1].Status)
+
+	// the same pinger is reused by all probes
+	checker.Ready(context.TODO())
+	assert.Equal(t, 2, pinger.pings)
+}
+
+func TestReadyPingError(t *testing.T) {
+	checker := New(&config.Config{}, &mockedPinger{pingError: errors.New("connection refused")}, newMockedLoader)
+
+	health := checker.Ready(context.TODO())
+
+	assert.Equal(t, types.HealthStatusDown, health.Status)
+	assert.Equal(t, types.HealthStatusDown, health.Checks[0].Status)
+	assert.Equal(t, types.HealthStatusUp, health.Checks[1].Status)
+}
+
+func TestReadyPingerPanic(t *testing.T) {
+	checker := New(&config.Config{}, &mockedPinger{panics: true}, newMockedErrorLoader)
+
+	health := checker.Ready(context.TODO())
+
+	assert.Equal(t, types.HealthStatusDown, health.Status)
+	assert.Equal(t, types.HealthStatusDown, health.Checks[0].Status)
+	assert.Equal(t, types.HealthStatusDown, health.Checks[1].Status)
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/tracing"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// finished jobs are kept for 24 hours
+const jobRetention = 24 * time.Hour
+
+// progress of running job is persisted at most once per progressInterval
+var progressInterval = time.Second
+
+// unfinished job is persisted every heartbeatInterval, job not persisted for staleJobTimeout was abandoned
+const (
+	heartbeatInterval = 10 * time.Second
+	staleJobTimeout   = time.Minute
+)
+
+// Operation is an operation executed asynchronously using passed Coordinator
+type Operation func(coordinator.Coordinator) (*types.CreateResults, error)
+
+// Manager executes operations asynchronously and keeps track of their state
+type Manager interface {
+	Submit(ctx context.Context, name string, operation Operation) *types.Job
+	GetJob(ID string) (*types.Job, error)
+}
+
+// manager keeps jobs submitted to this migrator instance in memory and persists them in JobStore
+// so that jobs can be read by all migrator instances, jobs are executed one at a time in a separate goroutine
+type manager struct {
+	config          *config.Config
+	newCoordinator  coordinator.Factory
+	store           db.JobStore
+	replica         string
+	mutex           sync.Mutex
+	jobs            map[string]*types.Job
+	progressSavedAt time.Time
+	running         sync.Mutex
+	heartbeat       time.Duration
+}
+
+// New creates instance of Manager, host name identifies migrator instance which executes jobs
+func New(config *config.Config, newCoordinator coordinator.Factory, store db.JobStore) Manager {
+	replica, _ := os.Hostname()
+	return &manager{config: config, newCoordinator: newCoordinator, store: store, replica: replica, jobs: map[string]*types.Job{}, heartbeat: heartbeatInterval}
+}
+
+// Submit queues operation and returns immediately, operation is executed using a new Coordinator instance
+// which outlives the passed context, only request ID and span context are copied from passed context
+func (m *manager) Submit(ctx context.Context, name string, operation Operation) *types.Job {
+	now := graphql.Time{Time: time.Now()}
+	job := &types.Job{ID: newJobID(), Operation: name, State: types.JobStateQueued, CreatedAt: now, Replica: m.replica, UpdatedAt: now}
+
+	jobCtx := context.WithValue(context.Background(), common.RequestIDKey{}, ctx.Value(common.RequestIDKey{}))
+	jobCtx = tracing.ContextWithSpanContext(jobCtx, tracing.SpanContextFromContext(ctx))
+	jobCtx = context.WithValue(jobCtx, db.ProgressKey{}, db.ProgressFunc(func(progress *types.MigrationResults) {
+		m.update(ctx, job.ID, true, func(job *types.Job) {
+			job.Progress = progress
+		})
+	}))
+
+	if err := m.store.DeleteJobs(time.Now().Add(-jobRetention)); err != nil {
+		common.LogError(ctx, "Could not remove expired jobs: %v", err)
+	}
+
+	m.mutex.Lock()
+	m.removeExpiredJobs()
+	m.jobs[job.ID] = job
+	snapshot := m.copy(job)
+	if err := m.store.CreateJob(snapshot); err != nil {
+		common.LogError(ctx, "Could not persist job %v: %v", job.ID, err)
+	}
+	m.mutex.Unlock()
+
+	common.LogInfo(ctx, "Job %v for %v queued", job.ID, name)
+
+	go m.run(jobCtx, job.ID, name, operation)
+
+	return snapshot
+}
+
+// GetJob returns a snapshot of job with passed ID, jobs submitted to other migrator instances are read from JobStore
+// unfinished jobs abandoned by restarted or stopped migrator instances are marked as failed
+func (m *manager) GetJob(ID string) (*types.Job, error) {
+	m.mutex.Lock()
+	job, ok := m.jobs[ID]
+	if ok {
+		job = m.copy(job)
+	}
+	m.mutex.Unlock()
+	if ok {
+		return job, nil
+	}
+
+	job, err := m.store.GetJob(ID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, fmt.Errorf("Job not found ID: %v", ID)
+	}
+
+	if job.FinishedAt != nil {
+		return job, nil
+	}
+
+	var message string
+	switch {
+	case job.Replica == m.replica:
+		// unfinished job of this instance which is not in memory was interrupted by restart
+		message = "Job interrupted by migrator restart"
+	case time.Now().Sub(job.UpdatedAt.Time) > staleJobTimeout:
+		// instance which executed the job was stopped and did not come back under the same host name
+		message = fmt.Sprintf("Job abandoned by migrator instance %v", job.Replica)
+	default:
+		return job, nil
+	}
+	job.State = types.JobStateFailed
+	job.FinishedAt = &graphql.Time{Time: time.Now()}
+	job.Error = &message
+	if err := m.store.UpdateJob(job); err != nil {
+		common.LogError(context.Background(), "Could not persist job %v: %v", ID, err)
+	}
+	return job, nil
+}
+
+func (m *manager) run(ctx context.Context, ID, name string, operation Operation) {
+	// queued jobs are kept alive too
+	stop := make(chan struct{})
+	defer close(stop)
+	go m.keepAlive(ctx, ID, stop)
+
+	m.running.Lock()
+	defer m.running.Unlock()
+
+	ctx, span := tracing.StartSpan(ctx, "job "+name, tracing.Attribute{Key: "job.id", Value: ID})
+	defer span.End()
+
+	m.update(ctx, ID, false, func(job *types.Job) {
+		job.State = types.JobStateRunning
+		job.StartedAt = &graphql.Time{Time: time.Now()}
+	})
+	common.LogInfo(ctx, "Job %v started", ID)
+
+	results, err := m.execute(ctx, operation)
+	if err != nil {
+		span.SetError(err.Error())
+	}
+
+	m.update(ctx, ID, false, func(job *types.Job) {
+		job.FinishedAt = &graphql.Time{Time: time.Now()}
+		if err != nil {
+			message := err.Error()
+			job.State = types.JobStateFailed
+			job.Error = &message
+			return
+		}
+		job.State = types.JobStateSucceeded
+		job.Results = results
+		if results != nil {
+			job.Progress = results.Summary
+		}
+	})
+	common.LogInfo(ctx, "Job %v finished", ID)
+}
+
+// execute runs operation, unexpected panics are recovered and returned as errors
+func (m *manager) execute(ctx context.Context, operation Operation) (results *types.CreateResults, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.LogPanic(ctx, "Panic recovered: %v", r)
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	coordinator := m.newCoordinator(ctx, m.config)
+	defer coordinator.Dispose()
+
+	return operation(coordinator)
+}
+
+// update modifies job in memory and persists it, progress updates are persisted at most once per progressInterval
+func (m *manager) update(ctx context.Context, ID string, progress bool, updateFunc func(*types.Job)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.jobs[ID]
+	if !ok {
+		return
+	}
+	updateFunc(job)
+	job.UpdatedAt = graphql.Time{Time: time.Now()}
+	if progress {
+		if time.Now().Sub(m.progressSavedAt) < progressInterval {
+			return
+		}
+		m.progressSavedAt = time.Now()
+	}
+	if err := m.store.UpdateJob(job); err != nil {
+		common.LogError(ctx, "Could not persist job %v: %v", ID, err)
+	}
+}
+
+// keepAlive persists job every heartbeat interval until stop is closed so that other instances know the job is alive
+func (m *manager) keepAlive(ctx context.Context, ID string, stop chan struct{}) {
+	ticker := time.NewTicker(m.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.update(ctx, ID, false, func(job *types.Job) {})
+		}
+	}
+}
+
+// removeExpiredJobs must be called with mutex held
+func (m *manager) removeExpiredJobs() {
+	for ID, job := range m.jobs {
+		if job.FinishedAt != nil && time.Now().Sub(job.FinishedAt.Time) > jobRetention {
+			delete(m.jobs, ID)
+		}
+	}
+}
+
+// copy must be called with mutex held, job fields are replaced and never modified in place
+func (m *manager) copy(job *types.Job) *types.Job {
+	copy := *job
+	return &copy
+}
+
+func newJobID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
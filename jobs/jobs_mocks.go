@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// jobs only create and dispose Coordinator, operations are mocked in tests
+type mockedCoordinator struct {
+	coordinator.Coordinator
+	ctx      context.Context
+	disposed chan bool
+}
+
+func newMockedCoordinatorFactory(disposed chan bool) coordinator.Factory {
+	return func(ctx context.Context, config *config.Config) coordinator.Coordinator {
+		return &mockedCoordinator{ctx: ctx, disposed: disposed}
+	}
+}
+
+func (m *mockedCoordinator) Dispose() {
+	m.disposed <- true
+}
+
+// mockedJobStore keeps serialised jobs in memory, when returnError is true all methods fail
+type mockedJobStore struct {
+	mutex       sync.Mutex
+	jobs        map[string][]byte
+	returnError bool
+}
+
+func newMockedJobStore() *mockedJobStore {
+	return &mockedJobStore{jobs: map[string][]byte{}}
+}
+
+func (m *mockedJobStore) CreateJob(job *types.Job) error {
+	return m.UpdateJob(job)
+}
+
+func (m *mockedJobStore) UpdateJob(job *types.Job) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.returnError {
+		return errors.New("trouble maker")
+	}
+	m.jobs[job.ID], _ = json.Marshal(job)
+	return nil
+}
+
+func (m *mockedJobStore) GetJob(ID string) (*types.Job, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.returnError {
+		return nil, errors.New("trouble maker")
+	}
+	contents, ok := m.jobs[ID]
+	if !ok {
+		return nil, nil
+	}
+	job := &types.Job{}
+	json.Unmarshal(contents, job)
+	return job, nil
+}
+
+func (m *mockedJobStore) DeleteJobs(finishedBefore time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.returnError {
+		return errors.New("trouble maker")
+	}
+	return nil
+}
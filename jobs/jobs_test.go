@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func newTestContext() context.Context {
+	return context.WithValue(context.TODO(), common.RequestIDKey{}, "123")
+}
+
+func TestSubmitSucceeded(t *testing.T) {
+	disposed := make(chan bool, 1)
+	manager := New(&config.Config{}, newMockedCoordinatorFactory(disposed), newMockedJobStore())
+
+	release := make(chan bool)
+	job := manager.Submit(newTestContext(), "createVersion", func(c coordinator.Coordinator) (*types.CreateResults, error) {
+		ctx := c.(*mockedCoordinator).ctx
+		assert.Equal(t, "123", ctx.Value(common.RequestIDKey{}))
+		ctx.Value(db.ProgressKey{}).(db.ProgressFunc)(&types.MigrationResults{SingleMigrations: 1})
+		<-release
+		return &types.CreateResults{Summary: &types.MigrationResults{SingleMigrations: 2}, Version: &types.Version{ID: 1}}, nil
+	})
+	assert.Equal(t, types.JobStateQueued, job.State)
+	assert.Equal(t, "createVersion", job.Operation)
+
+	running := waitFor(t, manager, job.ID, func(job *types.Job) bool { return job.Progress != nil })
+	assert.Equal(t, types.JobStateRunning, running.State)
+	assert.Equal(t, int32(1), running.Progress.SingleMigrations)
+	assert.NotNil(t, running.StartedAt)
+
+	release <- true
+	<-disposed
+
+	succeeded := waitFor(t, manager, job.ID, func(job *types.Job) bool { return job.State == types.JobStateSucceeded })
+	assert.Equal(t, int32(2), succeeded.Progress.SingleMigrations)
+	assert.Equal(t, int32(1), succeeded.Results.Version.ID)
+	assert.NotNil(t, succeeded.FinishedAt)
+	assert.Nil(t, succeeded.Error)
+}
+
+func TestSubmitFailed(t *testing.T) {
+	disposed := make(chan bool, 2)
+	manager := New(&config.Config{}, newMockedCoordinatorFactory(disposed), newMockedJobStore())
+
+	job1 := manager.Submit(newTestContext(), "createVersion", func(coordinator.Coordinator) (*types.CreateResults, error) {
+		return nil, errors.New("Another migration is in progress, please try again later")
+	})
+	job2 := manager.Submit(newTestContext(), "createTenant", func(coordinator.Coordinator) (*types.CreateResults, error) {
+		// unexpected panics are not always strings
+		panic(errors.New("SQL migration tenants/001.sql failed with error: trouble maker"))
+	})
+
+	failed1 := waitFor(t, manager, job1.ID, func(job *types.Job) bool { return job.State == types.JobStateFailed })
+	assert.Equal(t, "Another migration is in progress, please try again later", *failed1.Error)
+	assert.Nil(t, failed1.Results)
+
+	failed2 := waitFor(t, manager, job2.ID, func(job *types.Job) bool { return job.State == types.JobStateFailed })
+	assert.Equal(t, "SQL migration tenants/001.sql failed with error: trouble maker", *failed2.Error)
+
+	// coordinator is disposed even when operation panics
+	<-disposed
+	<-disposed
+}
+
+func TestGetJobNotFound(t *testing.T) {
+	manager := New(&config.Config{}, newMockedCoordinatorFactory(nil), newMockedJobStore())
+	job, err := manager.GetJob("abc")
+	assert.Nil(t, job)
+	assert.Equal(t, "Job not found ID: abc", err.Error())
+}
+
+func TestGetJobFromStore(t *testing.T) {
+	disposed := make(chan bool, 1)
+	store := newMockedJobStore()
+	first := New(&config.Config{}, newMockedCoordinatorFactory(disposed), store)
+
+	job := first.Submit(newTestContext(), "createVersion", func(c coordinator.Coordinator) (*types.CreateResults, error) {
+		return &types.CreateResults{Summary: &types.MigrationResults{SingleMigrations: 2}, Version: &types.Version{ID: 1}}, nil
+	})
+	<-disposed
+	waitFor(t, first, job.ID, func(job *types.Job) bool { return job.State == types.JobStateSucceeded })
+
+	// other migrator instance reads job from store
+	other := New(&config.Config{}, newMockedCoordinatorFactory(nil), store).(*manager)
+	other.replica = "other"
+	succeeded, err := other.GetJob(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateSucceeded, succeeded.State)
+	assert.Equal(t, job.Replica, succeeded.Replica)
+	assert.Equal(t, int32(1), succeeded.Results.Version.ID)
+	assert.Equal(t, int32(2), succeeded.Progress.SingleMigrations)
+}
+
+func TestGetJobInterruptedByRestart(t *testing.T) {
+	store := newMockedJobStore()
+	m := New(&config.Config{}, newMockedCoordinatorFactory(nil), store).(*manager)
+	store.CreateJob(&types.Job{ID: "running", State: types.JobStateRunning, Replica: m.replica})
+	store.CreateJob(&types.Job{ID: "other", State: types.JobStateRunning, Replica: "other", UpdatedAt: graphql.Time{Time: time.Now()}})
+
+	job, err := m.GetJob("running")
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateFailed, job.State)
+	assert.Equal(t, "Job interrupted by migrator restart", *job.Error)
+	assert.NotNil(t, job.FinishedAt)
+	persisted, _ := store.GetJob("running")
+	assert.Equal(t, types.JobStateFailed, persisted.State)
+
+	// job executed by other migrator instance is still running
+	job, err = m.GetJob("other")
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateRunning, job.State)
+}
+
+func TestGetJobAbandonedByOtherReplica(t *testing.T) {
+	store := newMockedJobStore()
+	m := New(&config.Config{}, newMockedCoordinatorFactory(nil), store).(*manager)
+	updatedAt := graphql.Time{Time: time.Now().Add(-staleJobTimeout - time.Second)}
+	store.CreateJob(&types.Job{ID: "abandoned", State: types.JobStateQueued, Replica: "migrator-abc", UpdatedAt: updatedAt})
+
+	job, err := m.GetJob("abandoned")
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateFailed, job.State)
+	assert.Equal(t, "Job abandoned by migrator instance migrator-abc", *job.Error)
+	assert.NotNil(t, job.FinishedAt)
+	persisted, _ := store.GetJob("abandoned")
+	assert.Equal(t, types.JobStateFailed, persisted.State)
+}
+
+func TestHeartbeat(t *testing.T) {
+	disposed := make(chan bool, 1)
+	store := newMockedJobStore()
+	m := New(&config.Config{}, newMockedCoordinatorFactory(disposed), store).(*manager)
+	m.heartbeat = 10 * time.Millisecond
+
+	release := make(chan bool)
+	job := m.Submit(newTestContext(), "createVersion", func(c coordinator.Coordinator) (*types.CreateResults, error) {
+		<-release
+		return &types.CreateResults{}, nil
+	})
+
+	// running job is persisted periodically even when it does not report progress
+	for i := 0; i < 100; i++ {
+		persisted, _ := store.GetJob(job.ID)
+		if persisted.UpdatedAt.After(job.UpdatedAt.Time) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	persisted, _ := store.GetJob(job.ID)
+	assert.True(t, persisted.UpdatedAt.After(job.UpdatedAt.Time))
+
+	release <- true
+	<-disposed
+	waitFor(t, m, job.ID, func(job *types.Job) bool { return job.State == types.JobStateSucceeded })
+}
+
+func TestJobStoreError(t *testing.T) {
+	disposed := make(chan bool, 1)
+	store := newMockedJobStore()
+	store.returnError = true
+	manager := New(&config.Config{}, newMockedCoordinatorFactory(disposed), store)
+
+	// jobs are executed and kept in memory even when they cannot be persisted
+	job := manager.Submit(newTestContext(), "createVersion", func(c coordinator.Coordinator) (*types.CreateResults, error) {
+		return &types.CreateResults{}, nil
+	})
+	<-disposed
+	waitFor(t, manager, job.ID, func(job *types.Job) bool { return job.State == types.JobStateSucceeded })
+
+	_, err := manager.GetJob("abc")
+	assert.Equal(t, "trouble maker", err.Error())
+}
+
+func TestRemoveExpiredJobs(t *testing.T) {
+	m := New(&config.Config{}, newMockedCoordinatorFactory(nil), newMockedJobStore()).(*manager)
+	m.jobs["old"] = &types.Job{ID: "old", State: types.JobStateSucceeded, FinishedAt: &graphql.Time{Time: time.Now().Add(-jobRetention - time.Minute)}}
+	m.jobs["running"] = &types.Job{ID: "running", State: types.JobStateRunning}
+
+	m.removeExpiredJobs()
+
+	assert.Len(t, m.jobs, 1)
+	assert.NotNil(t, m.jobs["running"])
+}
+
+func waitFor(t *testing.T, manager Manager, ID string, condition func(*types.Job) bool) *types.Job {
+	for i := 0; i < 100; i++ {
+		job, err := manager.GetJob(ID)
+		assert.Nil(t, err)
+		if condition(job) {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.FailNow(t, "Job did not reach expected state")
+	return nil
+}
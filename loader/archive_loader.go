@@ -0,0 +1,365 @@
+package loader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// archiveLoader is struct used for implementing Loader interface for loading migrations from zip or tar.gz archives
+// stored on local disk or available over HTTP(S)
+type archiveLoader struct {
+	baseLoader
+}
+
+// archive holds contents of all files stored in archive keyed by their paths
+type archive map[string][]byte
+
+var (
+	// archiveClient downloads remote archives, timeout includes reading of response body
+	archiveClient = &http.Client{Timeout: 2 * time.Minute}
+	// maxArchiveSize limits size of archive, maxExtractedArchiveSize limits total size of files extracted from archive
+	maxArchiveSize          int64 = 100 << 20
+	maxExtractedArchiveSize int64 = 1 << 30
+)
+
+// cachedArchive holds extracted archive together with its version and SHA-256 digest,
+// version is ETag of remote archive or modification time and size of local archive
+type cachedArchive struct {
+	version string
+	digest  string
+	files   archive
+}
+
+// archiveCache caches extracted archives keyed by base location.
+// Loaders are created for every request so the cache is shared by all loaders.
+// Base location does not change at runtime so the cache holds a single archive.
+type archiveCache struct {
+	mutex    sync.RWMutex
+	archives map[string]cachedArchive
+}
+
+var sourceArchivesCache = newArchiveCache()
+
+func newArchiveCache() *archiveCache {
+	return &archiveCache{archives: map[string]cachedArchive{}}
+}
+
+func (c *archiveCache) get(key string) cachedArchive {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.archives[key]
+}
+
+func (c *archiveCache) put(key string, archive cachedArchive) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.archives[key] = archive
+}
+
+// isArchiveLocation returns true if base location points to a zip or tar.gz archive
+func isArchiveLocation(baseLocation string) bool {
+	name := strings.ToLower(archivePath(baseLocation))
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// archivePath returns path of archive, for URLs query and fragment are removed
+func archivePath(baseLocation string) string {
+	if isRemoteArchive(baseLocation) {
+		if u, err := url.Parse(baseLocation); err == nil {
+			return u.Path
+		}
+	}
+	return baseLocation
+}
+
+func isRemoteArchive(baseLocation string) bool {
+	return strings.HasPrefix(baseLocation, "http://") || strings.HasPrefix(baseLocation, "https://")
+}
+
+// GetSourceMigrations returns all migrations from archive
+func (al *archiveLoader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("archive", time.Now())
+	_, span := al.startSpan("archive")
+	defer span.End()
+
+	archive, err := al.openArchive()
+	if err != nil {
+		return nil, al.loadFailed(span, err)
+	}
+
+	migrations, err := al.readMigrations(func(migrationsMap map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+		return al.readFromDirs(archive, migrationsMap, dirs, migrationType)
+	})
+	if err != nil {
+		return nil, al.loadFailed(span, err)
+	}
+
+	return migrations, nil
+}
+
+// HealthCheck verifies that archive is available, remote archives are checked using HEAD request
+// local archives are opened and all configured source directories must exist
+func (al *archiveLoader) HealthCheck() error {
+	if isRemoteArchive(al.config.BaseLocation) {
+		req, err := http.NewRequest(http.MethodHead, al.config.BaseLocation, nil)
+		if err != nil {
+			return al.downloadFailed(err)
+		}
+		resp, err := archiveClient.Do(req.WithContext(al.ctx))
+		if err != nil {
+			return al.downloadFailed(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Could not download archive %v: %v", al.config.MaskedBaseLocation(), resp.Status)
+		}
+		return nil
+	}
+
+	archive, err := al.openArchive()
+	if err != nil {
+		return err
+	}
+	for _, dirs := range [][]string{al.config.SingleMigrations, al.config.TenantMigrations, al.config.SingleScripts, al.config.TenantScripts} {
+		for _, dir := range dirs {
+			if _, err := archive.listFiles(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// openArchive reads archive, verifies its optional SHA-256 digest and extracts all files into memory,
+// archive is not downloaded again when its version did not change and is not extracted again when its digest did not change
+func (al *archiveLoader) openArchive() (archive, error) {
+	cached := sourceArchivesCache.get(al.config.BaseLocation)
+	data, version, err := al.readArchive(cached.version)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := cached.digest
+	if data != nil {
+		sum := sha256.Sum256(data)
+		digest = hex.EncodeToString(sum[:])
+	}
+
+	if al.config.BaseLocationSHA256 != "" && !strings.EqualFold(digest, al.config.BaseLocationSHA256) {
+		return nil, fmt.Errorf("Archive %v SHA-256 digest mismatch, expected: %v, actual: %v", al.config.MaskedBaseLocation(), al.config.BaseLocationSHA256, digest)
+	}
+
+	if cached.files != nil && digest == cached.digest {
+		if version != cached.version {
+			sourceArchivesCache.put(al.config.BaseLocation, cachedArchive{version: version, digest: digest, files: cached.files})
+		}
+		return cached.files, nil
+	}
+
+	var files archive
+	name := strings.ToLower(archivePath(al.config.BaseLocation))
+	if strings.HasSuffix(name, ".zip") {
+		files, err = extractZip(data)
+	} else {
+		files, err = extractTarGz(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sourceArchivesCache.put(al.config.BaseLocation, cachedArchive{version: version, digest: digest, files: files})
+	return files, nil
+}
+
+// readArchive returns contents and version of archive, nil contents are returned when version is equal to cachedVersion
+func (al *archiveLoader) readArchive(cachedVersion string) ([]byte, string, error) {
+	if !isRemoteArchive(al.config.BaseLocation) {
+		info, err := os.Stat(al.config.BaseLocation)
+		if err != nil {
+			return nil, "", fmt.Errorf("Could not read archive %v: %v", al.config.BaseLocation, err.Error())
+		}
+		version := fmt.Sprintf("%v-%v", info.ModTime().UnixNano(), info.Size())
+		if version == cachedVersion {
+			return nil, version, nil
+		}
+		f, err := os.Open(al.config.BaseLocation)
+		if err != nil {
+			return nil, "", fmt.Errorf("Could not read archive %v: %v", al.config.BaseLocation, err.Error())
+		}
+		defer f.Close()
+		data, err := readLimited(f, maxArchiveSize)
+		if err != nil {
+			return nil, "", fmt.Errorf("Could not read archive %v: %v", al.config.BaseLocation, err.Error())
+		}
+		return data, version, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, al.config.BaseLocation, nil)
+	if err != nil {
+		return nil, "", al.downloadFailed(err)
+	}
+	if cachedVersion != "" {
+		req.Header.Set("If-None-Match", cachedVersion)
+	}
+	resp, err := archiveClient.Do(req.WithContext(al.ctx))
+	if err != nil {
+		return nil, "", al.downloadFailed(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cachedVersion != "" {
+		return nil, cachedVersion, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("Could not download archive %v: %v", al.config.MaskedBaseLocation(), resp.Status)
+	}
+	data, err := readLimited(resp.Body, maxArchiveSize)
+	if err != nil {
+		return nil, "", al.downloadFailed(err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// downloadFailed returns download error which does not contain credentials stored in base location
+func (al *archiveLoader) downloadFailed(err error) error {
+	// url.Error contains URL of request
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	return fmt.Errorf("Could not download archive %v: %v", al.config.MaskedBaseLocation(), err.Error())
+}
+
+// readLimited reads all data from reader, an error is returned when data is larger than limit
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("size exceeds limit of %v bytes", limit)
+	}
+	return data, nil
+}
+
+func extractZip(data []byte) (archive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read zip archive: %v", err.Error())
+	}
+	files := archive{}
+	remaining := maxExtractedArchiveSize
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read file %v: %v", f.Name, err.Error())
+		}
+		contents, err := readLimited(rc, remaining)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read file %v: %v", f.Name, err.Error())
+		}
+		remaining -= int64(len(contents))
+		files[cleanArchivePath(f.Name)] = contents
+	}
+	return files, nil
+}
+
+func extractTarGz(data []byte) (archive, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read tar.gz archive: %v", err.Error())
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	files := archive{}
+	remaining := maxExtractedArchiveSize
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read tar.gz archive: %v", err.Error())
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		contents, err := readLimited(reader, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read file %v: %v", header.Name, err.Error())
+		}
+		remaining -= int64(len(contents))
+		files[cleanArchivePath(header.Name)] = contents
+	}
+	return files, nil
+}
+
+// cleanArchivePath normalises paths like ./migrations/config/001.sql to migrations/config/001.sql
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// listFiles returns sorted paths of files stored directly in dir, subdirectories are skipped just like in disk loader
+func (a archive) listFiles(dir string) ([]string, error) {
+	dir = cleanArchivePath(dir)
+	found := false
+	files := []string{}
+	for name := range a {
+		if !strings.HasPrefix(name, dir+"/") {
+			continue
+		}
+		found = true
+		if path.Dir(name) == dir {
+			files = append(files, name)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("Could not read source dir %v: %v", dir, os.ErrNotExist)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (al *archiveLoader) readFromDirs(archive archive, migrations map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+	for _, dir := range dirs {
+		files, err := archive.listFiles(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			contents := archive[file]
+			hasher := sha256.New()
+			hasher.Write(contents)
+			// source dir and file are relative to archive root so that they do not change between archive versions
+			m := types.Migration{Name: path.Base(file), SourceDir: path.Dir(file), File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+
+			e, ok := migrations[m.Name]
+			if ok {
+				e = append(e, m)
+			} else {
+				e = []types.Migration{m}
+			}
+			migrations[m.Name] = e
+		}
+	}
+	return nil
+}
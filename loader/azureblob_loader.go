@@ -2,15 +2,19 @@ package loader
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -20,56 +24,78 @@ type azureBlobLoader struct {
 }
 
 // GetSourceMigrations returns all migrations from Azure Blob location
-func (abl *azureBlobLoader) GetSourceMigrations() []types.Migration {
+func (abl *azureBlobLoader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("azureblob", time.Now())
+	ctx, span := abl.startSpan("azureblob")
+	defer span.End()
+
+	containerURL, err := abl.getContainerURL()
+	if err != nil {
+		return nil, abl.loadFailed(span, err)
+	}
+
+	migrations, err := abl.doGetSourceMigrations(ctx, containerURL)
+	if err != nil {
+		return nil, abl.loadFailed(span, err)
+	}
+	return migrations, nil
+}
+
+// HealthCheck verifies that all configured source directories can be listed
+func (abl *azureBlobLoader) HealthCheck() error {
+	containerURL, err := abl.getContainerURL()
+	if err != nil {
+		return err
+	}
+	for _, prefixes := range [][]string{abl.config.SingleMigrations, abl.config.TenantMigrations, abl.config.SingleScripts, abl.config.TenantScripts} {
+		for _, prefix := range prefixes {
+			// only the first segment is fetched
+			if _, err := containerURL.ListBlobsFlatSegment(abl.ctx, azblob.Marker{}, azblob.ListBlobsSegmentOptions{Prefix: prefix + "/", MaxResults: 1}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (abl *azureBlobLoader) getContainerURL() (azblob.ContainerURL, error) {
 	accountName, accountKey := os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_ACCESS_KEY")
 
 	if len(accountName) == 0 || len(accountKey) == 0 {
-		panic("Either the AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_ACCESS_KEY environment variable is not set")
+		return azblob.ContainerURL{}, errors.New("Either the AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_ACCESS_KEY environment variable is not set")
 	}
 
 	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return azblob.ContainerURL{}, err
+	}
 
 	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
 
 	u, err := url.Parse(abl.config.BaseLocation)
 	if err != nil {
-		panic(err.Error())
+		return azblob.ContainerURL{}, err
 	}
 
 	// migrator expects that container as a part of the service url
 	// for example: https://lukaszbudniktest.blob.core.windows.net/mycontainer
 	// Azure SDK will correctly parse the account and the container
-	containerURL := azblob.NewContainerURL(*u, p)
-
-	return abl.doGetSourceMigrations(containerURL)
+	return azblob.NewContainerURL(*u, p), nil
 }
 
-func (abl *azureBlobLoader) doGetSourceMigrations(containerURL azblob.ContainerURL) []types.Migration {
-	migrations := []types.Migration{}
-
-	singleMigrationsObjects := abl.getObjectList(containerURL, abl.config.SingleMigrations)
-	tenantMigrationsObjects := abl.getObjectList(containerURL, abl.config.TenantMigrations)
-	singleScriptsObjects := abl.getObjectList(containerURL, abl.config.SingleScripts)
-	tenantScriptsObjects := abl.getObjectList(containerURL, abl.config.TenantScripts)
-
-	migrationsMap := make(map[string][]types.Migration)
-	abl.getObjects(containerURL, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
-	abl.getObjects(containerURL, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
-	abl.sortMigrations(migrationsMap, &migrations)
-
-	migrationsMap = make(map[string][]types.Migration)
-	abl.getObjects(containerURL, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
-	abl.sortMigrations(migrationsMap, &migrations)
-
-	migrationsMap = make(map[string][]types.Migration)
-	abl.getObjects(containerURL, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
-	abl.sortMigrations(migrationsMap, &migrations)
-
-	return migrations
+func (abl *azureBlobLoader) doGetSourceMigrations(ctx context.Context, containerURL azblob.ContainerURL) ([]types.Migration, error) {
+	return abl.readMigrations(func(migrationsMap map[string][]types.Migration, prefixes []string, migrationType types.MigrationType) error {
+		objects, err := abl.getObjectList(containerURL, prefixes)
+		if err != nil {
+			return err
+		}
+		abl.pruneCache(prefixes, objects)
+		return abl.getObjects(ctx, containerURL, migrationsMap, objects, migrationType)
+	})
 }
 
-func (abl *azureBlobLoader) getObjectList(containerURL azblob.ContainerURL, prefixes []string) []string {
-	objects := []string{}
+func (abl *azureBlobLoader) getObjectList(containerURL azblob.ContainerURL, prefixes []string) ([]azblob.BlobItem, error) {
+	objects := []azblob.BlobItem{}
 
 	for _, prefix := range prefixes {
 
@@ -77,43 +103,78 @@ func (abl *azureBlobLoader) getObjectList(containerURL azblob.ContainerURL, pref
 
 			listBlob, err := containerURL.ListBlobsFlatSegment(abl.ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: prefix + "/"})
 			if err != nil {
-				panic(err.Error())
+				return nil, err
 			}
 			marker = listBlob.NextMarker
 
-			for _, blobInfo := range listBlob.Segment.BlobItems {
-				objects = append(objects, blobInfo.Name)
-			}
+			objects = append(objects, listBlob.Segment.BlobItems...)
 		}
 
 	}
 
-	return objects
+	return objects, nil
 }
 
-func (abl *azureBlobLoader) getObjects(containerURL azblob.ContainerURL, migrationsMap map[string][]types.Migration, objects []string, migrationType types.MigrationType) {
+// pruneCache removes cached blobs which were deleted from listed prefixes
+func (abl *azureBlobLoader) pruneCache(prefixes []string, objects []azblob.BlobItem) {
+	prefixKeys := []string{}
+	for _, prefix := range prefixes {
+		prefixKeys = append(prefixKeys, abl.cacheKey(prefix+"/"))
+	}
+	keys := []string{}
 	for _, o := range objects {
-		blobURL := containerURL.NewBlobURL(o)
+		keys = append(keys, abl.cacheKey(o.Name))
+	}
+	sourceObjectsCache.prune(prefixKeys, keys)
+}
 
-		get, err := blobURL.Download(abl.ctx, 0, 0, azblob.BlobAccessConditions{}, false)
-		if err != nil {
-			panic(err.Error())
-		}
+func (abl *azureBlobLoader) cacheKey(name string) string {
+	return fmt.Sprintf("%s/%s", abl.config.BaseLocation, name)
+}
+
+// getObjects downloads blobs concurrently, blobs which ETag and last modified time did not change are read from cache
+func (abl *azureBlobLoader) getObjects(ctx context.Context, containerURL azblob.ContainerURL, migrationsMap map[string][]types.Migration, objects []azblob.BlobItem, migrationType types.MigrationType) error {
+	contents := make([][]byte, len(objects))
+	err := fetchConcurrently(len(objects), abl.config.LoaderConcurrency, func(i int) error {
+		o := objects[i]
+		cacheKey := abl.cacheKey(o.Name)
+		return traceObject(ctx, cacheKey, func(ctx context.Context) (bool, error) {
+			etag, lastModified := string(o.Properties.Etag), o.Properties.LastModified
+			if cached, ok := sourceObjectsCache.get(cacheKey, etag, lastModified); ok {
+				contents[i] = cached
+				return true, nil
+			}
+
+			blobURL := containerURL.NewBlobURL(o.Name)
+			get, err := blobURL.Download(ctx, 0, 0, azblob.BlobAccessConditions{}, false)
+			if err != nil {
+				return false, err
+			}
 
-		downloadedData := &bytes.Buffer{}
-		reader := get.Body(azblob.RetryReaderOptions{})
-		downloadedData.ReadFrom(reader)
-		reader.Close()
+			downloadedData := &bytes.Buffer{}
+			reader := get.Body(azblob.RetryReaderOptions{})
+			defer reader.Close()
+			if _, err := downloadedData.ReadFrom(reader); err != nil {
+				return false, err
+			}
 
-		contents := downloadedData.String()
+			contents[i] = downloadedData.Bytes()
+			sourceObjectsCache.put(cacheKey, etag, lastModified, contents[i])
+			return false, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
 
+	for i, o := range objects {
 		hasher := sha256.New()
-		hasher.Write([]byte(contents))
-		file := fmt.Sprintf("%s/%s", abl.config.BaseLocation, o)
+		hasher.Write(contents[i])
+		file := fmt.Sprintf("%s/%s", abl.config.BaseLocation, o.Name)
 		from := strings.LastIndex(file, "/")
 		sourceDir := file[0:from]
 		name := file[from+1:]
-		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents[i]), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
 
 		e, ok := migrationsMap[m.Name]
 		if ok {
@@ -122,6 +183,6 @@ func (abl *azureBlobLoader) getObjects(containerURL azblob.ContainerURL, migrati
 			e = []types.Migration{m}
 		}
 		migrationsMap[m.Name] = e
-
 	}
+	return nil
 }
@@ -2,10 +2,20 @@ package loader
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,7 +36,8 @@ func TestAzureGetSourceMigrations(t *testing.T) {
 	}
 
 	loader := &azureBlobLoader{baseLoader{context.TODO(), config}}
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -44,3 +55,79 @@ func TestAzureGetSourceMigrations(t *testing.T) {
 	assert.Contains(t, migrations[11].File, "migrations/tenants-scripts/b.sql")
 
 }
+
+// newAzureTestServer serves blob listing and blob downloads of container named container, blobs maps names to contents
+func newAzureTestServer(blobs map[string]string, downloads *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("comp") == "list" {
+			prefix := r.URL.Query().Get("prefix")
+			names := []string{}
+			for name := range blobs {
+				if strings.HasPrefix(name, prefix) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults ContainerName="container"><Blobs>`)
+			for _, name := range names {
+				fmt.Fprintf(w, `<Blob><Name>%v</Name><Properties><Last-Modified>Sun, 01 Mar 2020 12:00:00 GMT</Last-Modified><Etag>"%x"</Etag></Properties></Blob>`, name, sha256.Sum256([]byte(blobs[name])))
+			}
+			fmt.Fprint(w, `</Blobs><NextMarker /></EnumerationResults>`)
+			return
+		}
+		atomic.AddInt32(downloads, 1)
+		contents, ok := blobs[strings.TrimPrefix(r.URL.Path, "/container/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+		fmt.Fprint(w, contents)
+	}))
+}
+
+func TestAzureGetSourceMigrationsCached(t *testing.T) {
+	blobs := map[string]string{
+		"migrations/config/201602160001.sql":  "create table {schema}.config",
+		"migrations/tenants/201602160002.sql": "create table {schema}.settings",
+		"migrations/tenants/201602160003.sql": "alter table {schema}.settings add column v text",
+	}
+	var downloads int32
+	server := newAzureTestServer(blobs, &downloads)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/container")
+	assert.Nil(t, err)
+	containerURL := azblob.NewContainerURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
+
+	config := &config.Config{
+		BaseLocation:     server.URL + "/container",
+		SingleMigrations: []string{"migrations/config"},
+		TenantMigrations: []string{"migrations/tenants"},
+	}
+
+	loader := &azureBlobLoader{baseLoader{context.TODO(), config}}
+	migrations, err := loader.doGetSourceMigrations(context.TODO(), containerURL)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 3)
+	assert.Equal(t, "create table {schema}.settings", migrations[1].Contents)
+	assert.Equal(t, int32(3), downloads)
+
+	// blobs did not change, all are read from cache
+	cached, err := loader.doGetSourceMigrations(context.TODO(), containerURL)
+	assert.Nil(t, err)
+	assert.Equal(t, migrations, cached)
+	assert.Equal(t, int32(3), downloads)
+
+	// deleted blob is pruned from cache, modified blob is downloaded again
+	delete(blobs, "migrations/tenants/201602160003.sql")
+	blobs["migrations/tenants/201602160002.sql"] = "create table {schema}.settings (k text)"
+	migrations, err = loader.doGetSourceMigrations(context.TODO(), containerURL)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "create table {schema}.settings (k text)", migrations[1].Contents)
+	assert.Equal(t, int32(4), downloads)
+	_, ok := sourceObjectsCache.objects[loader.cacheKey("migrations/tenants/201602160003.sql")]
+	assert.False(t, ok)
+}
@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLoaderConcurrency is the default number of objects downloaded concurrently by cloud storage loaders
+const defaultLoaderConcurrency = 10
+
+// cachedObject holds contents of downloaded object together with its version information
+type cachedObject struct {
+	etag         string
+	lastModified time.Time
+	contents     []byte
+}
+
+// objectCache caches contents of objects downloaded from cloud storage.
+// Loaders are created for every request so the cache is shared by all loaders.
+// Entry is valid as long as ETag and last modified time returned by object listing do not change.
+// Entries of objects missing from the latest listing are pruned so the cache holds only current source objects.
+type objectCache struct {
+	mutex   sync.RWMutex
+	objects map[string]cachedObject
+}
+
+var sourceObjectsCache = newObjectCache()
+
+func newObjectCache() *objectCache {
+	return &objectCache{objects: map[string]cachedObject{}}
+}
+
+// get returns cached contents of object if its ETag and last modified time did not change
+func (c *objectCache) get(key, etag string, lastModified time.Time) ([]byte, bool) {
+	if etag == "" && lastModified.IsZero() {
+		return nil, false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	object, ok := c.objects[key]
+	if !ok || object.etag != etag || !object.lastModified.Equal(lastModified) {
+		return nil, false
+	}
+	return object.contents, true
+}
+
+// put caches contents of object, objects without ETag and last modified time are not cached
+func (c *objectCache) put(key, etag string, lastModified time.Time, contents []byte) {
+	if etag == "" && lastModified.IsZero() {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.objects[key] = cachedObject{etag: etag, lastModified: lastModified, contents: contents}
+}
+
+// prune removes cached objects whose keys start with one of listed prefixes but which are not in keys returned by the latest listing
+func (c *objectCache) prune(prefixes, keys []string) {
+	listed := map[string]bool{}
+	for _, key := range keys {
+		listed[key] = true
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.objects {
+		if listed[key] {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.objects, key)
+				break
+			}
+		}
+	}
+}
+
+// fetchConcurrently calls fetch for indexes 0..n-1 using at most concurrency goroutines
+// and returns the first error encountered, remaining indexes are not fetched after an error
+func fetchConcurrently(n, concurrency int, fetch func(i int) error) error {
+	if concurrency <= 0 {
+		concurrency = defaultLoaderConcurrency
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	var failed sync.Once
+	done := make(chan struct{})
+
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fetch(i); err != nil {
+					errs <- err
+					failed.Do(func() { close(done) })
+				}
+			}
+		}()
+	}
+
+loop:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-done:
+			break loop
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
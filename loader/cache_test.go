@@ -0,0 +1,90 @@
+package loader
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectCache(t *testing.T) {
+	cache := newObjectCache()
+	modified := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cache.put("s3://bucket/migrations/config/001.sql", "\"abc\"", modified, []byte("create table abc"))
+
+	contents, ok := cache.get("s3://bucket/migrations/config/001.sql", "\"abc\"", modified)
+	assert.True(t, ok)
+	assert.Equal(t, "create table abc", string(contents))
+
+	// changed ETag or last modified time invalidates entry
+	_, ok = cache.get("s3://bucket/migrations/config/001.sql", "\"def\"", modified)
+	assert.False(t, ok)
+	_, ok = cache.get("s3://bucket/migrations/config/001.sql", "\"abc\"", modified.Add(time.Second))
+	assert.False(t, ok)
+
+	// objects without version information are never cached
+	cache.put("s3://bucket/migrations/config/002.sql", "", time.Time{}, []byte("create table def"))
+	_, ok = cache.get("s3://bucket/migrations/config/002.sql", "", time.Time{})
+	assert.False(t, ok)
+}
+
+func TestObjectCachePrune(t *testing.T) {
+	cache := newObjectCache()
+	modified := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cache.put("s3://bucket/migrations/config/001.sql", "\"abc\"", modified, []byte("create table abc"))
+	cache.put("s3://bucket/migrations/config/002.sql", "\"def\"", modified, []byte("create table def"))
+	cache.put("s3://bucket/migrations/tenants/001.sql", "\"ghi\"", modified, []byte("create table ghi"))
+
+	// 002.sql was deleted, objects stored under other prefixes are not pruned
+	cache.prune([]string{"s3://bucket/migrations/config"}, []string{"s3://bucket/migrations/config/001.sql"})
+
+	_, ok := cache.get("s3://bucket/migrations/config/001.sql", "\"abc\"", modified)
+	assert.True(t, ok)
+	_, ok = cache.get("s3://bucket/migrations/config/002.sql", "\"def\"", modified)
+	assert.False(t, ok)
+	_, ok = cache.get("s3://bucket/migrations/tenants/001.sql", "\"ghi\"", modified)
+	assert.True(t, ok)
+	assert.Len(t, cache.objects, 2)
+}
+
+func TestFetchConcurrently(t *testing.T) {
+	var running, maxRunning int32
+	results := make([]int, 20)
+	err := fetchConcurrently(len(results), 4, func(i int) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		results[i] = i * i
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, maxRunning <= 4)
+	for i, r := range results {
+		assert.Equal(t, i*i, r)
+	}
+}
+
+func TestFetchConcurrentlyError(t *testing.T) {
+	err := fetchConcurrently(100, 0, func(i int) error {
+		if i == 10 {
+			return errors.New("trouble maker")
+		}
+		return nil
+	})
+	assert.Equal(t, "trouble maker", err.Error())
+
+	assert.Nil(t, fetchConcurrently(0, 5, func(i int) error {
+		return errors.New("never called")
+	}))
+}
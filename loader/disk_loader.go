@@ -6,9 +6,11 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"fmt"
 
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -18,33 +20,40 @@ type diskLoader struct {
 }
 
 // GetSourceMigrations returns all migrations from disk
-func (dl *diskLoader) GetSourceMigrations() []types.Migration {
-	migrations := []types.Migration{}
+func (dl *diskLoader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("disk", time.Now())
+	_, span := dl.startSpan("disk")
+	defer span.End()
 
 	absBaseDir, err := filepath.Abs(dl.config.BaseLocation)
 	if err != nil {
-		panic(fmt.Sprintf("Could not convert baseLocation to absolute path: %v", err.Error()))
+		return nil, dl.loadFailed(span, fmt.Errorf("Could not convert baseLocation to absolute path: %v", err.Error()))
 	}
 
-	singleMigrationsDirs := dl.getDirs(absBaseDir, dl.config.SingleMigrations)
-	tenantMigrationsDirs := dl.getDirs(absBaseDir, dl.config.TenantMigrations)
-	singleScriptsDirs := dl.getDirs(absBaseDir, dl.config.SingleScripts)
-	tenantScriptsDirs := dl.getDirs(absBaseDir, dl.config.TenantScripts)
-
-	migrationsMap := make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, singleMigrationsDirs, types.MigrationTypeSingleMigration)
-	dl.readFromDirs(migrationsMap, tenantMigrationsDirs, types.MigrationTypeTenantMigration)
-	dl.sortMigrations(migrationsMap, &migrations)
-
-	migrationsMap = make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, singleScriptsDirs, types.MigrationTypeSingleScript)
-	dl.sortMigrations(migrationsMap, &migrations)
+	migrations, err := dl.readMigrations(func(migrationsMap map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+		return dl.readFromDirs(migrationsMap, dl.getDirs(absBaseDir, dirs), migrationType)
+	})
+	if err != nil {
+		return nil, dl.loadFailed(span, err)
+	}
 
-	migrationsMap = make(map[string][]types.Migration)
-	dl.readFromDirs(migrationsMap, tenantScriptsDirs, types.MigrationTypeTenantScript)
-	dl.sortMigrations(migrationsMap, &migrations)
+	return migrations, nil
+}
 
-	return migrations
+// HealthCheck verifies that all configured source directories exist and can be read
+func (dl *diskLoader) HealthCheck() error {
+	absBaseDir, err := filepath.Abs(dl.config.BaseLocation)
+	if err != nil {
+		return fmt.Errorf("Could not convert baseLocation to absolute path: %v", err.Error())
+	}
+	for _, dirs := range [][]string{dl.config.SingleMigrations, dl.config.TenantMigrations, dl.config.SingleScripts, dl.config.TenantScripts} {
+		for _, sourceDir := range dl.getDirs(absBaseDir, dirs) {
+			if _, err := ioutil.ReadDir(sourceDir); err != nil {
+				return fmt.Errorf("Could not read source dir %v: %v", sourceDir, err.Error())
+			}
+		}
+	}
+	return nil
 }
 
 func (dl *diskLoader) getDirs(baseDir string, migrationsDirs []string) []string {
@@ -55,18 +64,18 @@ func (dl *diskLoader) getDirs(baseDir string, migrationsDirs []string) []string
 	return filteredDirs
 }
 
-func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sourceDirs []string, migrationType types.MigrationType) {
+func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sourceDirs []string, migrationType types.MigrationType) error {
 	for _, sourceDir := range sourceDirs {
 		files, err := ioutil.ReadDir(sourceDir)
 		if err != nil {
-			panic(fmt.Sprintf("Could not read source dir %v: %v", sourceDir, err.Error()))
+			return fmt.Errorf("Could not read source dir %v: %v", sourceDir, err.Error())
 		}
 		for _, file := range files {
 			if !file.IsDir() {
 				fullPath := filepath.Join(sourceDir, file.Name())
 				contents, err := ioutil.ReadFile(fullPath)
 				if err != nil {
-					panic(fmt.Sprintf("Could not read file %v: %v", fullPath, err.Error()))
+					return fmt.Errorf("Could not read file %v: %v", fullPath, err.Error())
 				}
 				hasher := sha256.New()
 				hasher.Write([]byte(contents))
@@ -83,4 +92,5 @@ func (dl *diskLoader) readFromDirs(migrations map[string][]types.Migration, sour
 			}
 		}
 	}
+	return nil
 }
@@ -15,21 +15,9 @@ func TestDiskReadDiskMigrationsNonExistingBaseLocationError(t *testing.T) {
 
 	loader := New(context.TODO(), &config)
 
-	didPanic := false
-	var message interface{}
-	func() {
-
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
-
-		loader.GetSourceMigrations()
-
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "xyzabc/migrations/config: no such file or directory")
+	_, err := loader.GetSourceMigrations()
+	assert.IsType(t, &ErrLoadFailed{}, err)
+	assert.Contains(t, err.Error(), "xyzabc/migrations/config: no such file or directory")
 }
 
 func TestDiskReadDiskMigrationsNonExistingMigrationsDirError(t *testing.T) {
@@ -39,21 +27,9 @@ func TestDiskReadDiskMigrationsNonExistingMigrationsDirError(t *testing.T) {
 
 	loader := New(context.TODO(), &config)
 
-	didPanic := false
-	var message interface{}
-	func() {
-
-		defer func() {
-			if message = recover(); message != nil {
-				didPanic = true
-			}
-		}()
-
-		loader.GetSourceMigrations()
-
-	}()
-	assert.True(t, didPanic)
-	assert.Contains(t, message, "test/migrations/abcdef: no such file or directory")
+	_, err := loader.GetSourceMigrations()
+	assert.IsType(t, &ErrLoadFailed{}, err)
+	assert.Contains(t, err.Error(), "test/migrations/abcdef: no such file or directory")
 }
 
 func TestDiskGetDiskMigrations(t *testing.T) {
@@ -65,7 +41,8 @@ func TestDiskGetDiskMigrations(t *testing.T) {
 	config.TenantScripts = []string{"migrations/tenants-scripts"}
 
 	loader := New(context.TODO(), &config)
-	migrations := loader.GetSourceMigrations()
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -76,6 +53,8 @@ func TestDiskGetDiskMigrations(t *testing.T) {
 	assert.Contains(t, migrations[4].File, "test/migrations/tenants/201602160003.sql")
 	assert.Contains(t, migrations[5].File, "test/migrations/ref/201602160004.sql")
 	assert.Contains(t, migrations[6].File, "test/migrations/tenants/201602160004.sql")
+	// down migrations are not returned as separate migrations but are paired with their migrations
+	assert.Equal(t, "alter table {schema}.users drop column id_role;\n", migrations[6].DownContents)
 	assert.Contains(t, migrations[7].File, "test/migrations/tenants/201602160005.sql")
 	// SingleScripts are second to last
 	assert.Contains(t, migrations[8].File, "test/migrations/config-scripts/200012181227.sql")
@@ -84,3 +63,18 @@ func TestDiskGetDiskMigrations(t *testing.T) {
 	assert.Contains(t, migrations[10].File, "test/migrations/tenants-scripts/a.sql")
 	assert.Contains(t, migrations[11].File, "test/migrations/tenants-scripts/b.sql")
 }
+
+func TestDiskHealthCheck(t *testing.T) {
+	var config config.Config
+	config.BaseLocation = "../test"
+	config.SingleMigrations = []string{"migrations/config", "migrations/ref"}
+	config.TenantMigrations = []string{"migrations/tenants"}
+
+	loader := New(context.TODO(), &config)
+	assert.Nil(t, loader.HealthCheck())
+
+	config.TenantScripts = []string{"migrations/abcdef"}
+	err := loader.HealthCheck()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "test/migrations/abcdef: no such file or directory")
+}
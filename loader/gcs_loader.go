@@ -0,0 +1,184 @@
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const gcsLocationPrefix = "gs://"
+
+// gcsClient abstracts Google Cloud Storage operations used by gcsLoader
+type gcsClient interface {
+	// ListObjects returns names of objects stored directly under prefix, limit 0 means no limit
+	ListObjects(ctx context.Context, bucket, prefix string, limit int) ([]string, error)
+	// GetObject returns contents of object
+	GetObject(ctx context.Context, bucket, name string) ([]byte, error)
+}
+
+// gcsStorageClient implements gcsClient interface using official Google Cloud Storage client
+type gcsStorageClient struct {
+	client *storage.Client
+}
+
+func (c *gcsStorageClient) ListObjects(ctx context.Context, bucket, prefix string, limit int) ([]string, error) {
+	names := []string{}
+	// delimiter makes sure objects from nested "directories" are not returned, they are returned as prefixes
+	it := c.client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"})
+	for limit == 0 || len(names) < limit {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if attrs.Name == "" {
+			continue
+		}
+		names = append(names, attrs.Name)
+	}
+	return names, nil
+}
+
+func (c *gcsStorageClient) GetObject(ctx context.Context, bucket, name string) ([]byte, error) {
+	reader, err := c.client.Bucket(bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// gcsLoader is struct used for implementing Loader interface for loading migrations from Google Cloud Storage
+type gcsLoader struct {
+	baseLoader
+}
+
+// GetSourceMigrations returns all migrations from Google Cloud Storage location
+func (gcsl *gcsLoader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("gcs", time.Now())
+	ctx, span := gcsl.startSpan("gcs")
+	defer span.End()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, gcsl.loadFailed(span, err)
+	}
+	defer client.Close()
+	migrations, err := gcsl.doGetSourceMigrations(ctx, &gcsStorageClient{client})
+	if err != nil {
+		return nil, gcsl.loadFailed(span, err)
+	}
+	return migrations, nil
+}
+
+// HealthCheck verifies that all configured source directories can be listed
+func (gcsl *gcsLoader) HealthCheck() error {
+	client, err := storage.NewClient(gcsl.ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return gcsl.doHealthCheck(&gcsStorageClient{client})
+}
+
+func (gcsl *gcsLoader) doHealthCheck(client gcsClient) error {
+	bucket, _ := gcsl.getBucketAndPrefix()
+	for _, dirs := range [][]string{gcsl.config.SingleMigrations, gcsl.config.TenantMigrations, gcsl.config.SingleScripts, gcsl.config.TenantScripts} {
+		for _, dir := range dirs {
+			// only the first object is fetched
+			if _, err := client.ListObjects(gcsl.ctx, bucket, gcsl.getObjectPrefix(dir), 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getBucketAndPrefix parses gs://bucket/prefix base location, prefix is optional
+func (gcsl *gcsLoader) getBucketAndPrefix() (string, string) {
+	location := strings.TrimPrefix(gcsl.config.BaseLocation, gcsLocationPrefix)
+	parts := strings.SplitN(location, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.Trim(parts[1], "/")
+}
+
+// getObjectPrefix returns object prefix of source dir, it always ends with a slash so that
+// for example migrations/config does not match objects from migrations/config-scripts
+func (gcsl *gcsLoader) getObjectPrefix(dir string) string {
+	_, prefix := gcsl.getBucketAndPrefix()
+	return strings.TrimPrefix(path.Join(prefix, dir)+"/", "/")
+}
+
+func (gcsl *gcsLoader) doGetSourceMigrations(ctx context.Context, client gcsClient) ([]types.Migration, error) {
+	return gcsl.readMigrations(func(migrationsMap map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+		objects, err := gcsl.getObjectList(client, dirs)
+		if err != nil {
+			return err
+		}
+		return gcsl.getObjects(ctx, client, migrationsMap, objects, migrationType)
+	})
+}
+
+func (gcsl *gcsLoader) getObjectList(client gcsClient, dirs []string) ([]string, error) {
+	objects := []string{}
+
+	bucket, _ := gcsl.getBucketAndPrefix()
+
+	for _, dir := range dirs {
+		names, err := client.ListObjects(gcsl.ctx, bucket, gcsl.getObjectPrefix(dir), 0)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, names...)
+	}
+
+	return objects, nil
+}
+
+func (gcsl *gcsLoader) getObjects(ctx context.Context, client gcsClient, migrationsMap map[string][]types.Migration, objects []string, migrationType types.MigrationType) error {
+	bucket, _ := gcsl.getBucketAndPrefix()
+
+	for _, o := range objects {
+		var contents []byte
+		err := traceObject(ctx, fmt.Sprintf("%s%s/%s", gcsLocationPrefix, bucket, o), func(ctx context.Context) (bool, error) {
+			var err error
+			contents, err = client.GetObject(ctx, bucket, o)
+			return false, err
+		})
+		if err != nil {
+			return err
+		}
+
+		hasher := sha256.New()
+		hasher.Write(contents)
+		file := fmt.Sprintf("%s%s/%s", gcsLocationPrefix, bucket, o)
+		from := strings.LastIndex(file, "/")
+		sourceDir := file[0:from]
+		name := file[from+1:]
+		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+
+		e, ok := migrationsMap[m.Name]
+		if ok {
+			e = append(e, m)
+		} else {
+			e = []types.Migration{m}
+		}
+		migrationsMap[m.Name] = e
+	}
+	return nil
+}
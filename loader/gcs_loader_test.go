@@ -0,0 +1,165 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockGCSClient struct {
+	prefixes []string
+}
+
+func (m *mockGCSClient) ListObjects(ctx context.Context, bucket, prefix string, limit int) ([]string, error) {
+	m.prefixes = append(m.prefixes, prefix)
+
+	var names []string
+	switch prefix {
+	case "app/migrations/config/":
+		names = []string{"201602160001.sql", "201602160002.sql"}
+	case "app/migrations/tenants/":
+		names = []string{"201602160002.sql", "202001100004.sql", "202001100004.down.sql"}
+	case "app/migrations/tenants-scripts/":
+		names = []string{"cleanup.sql", "recreate-triggers.sql"}
+	default:
+		return nil, fmt.Errorf("storage: bucket %v prefix %v not found", bucket, prefix)
+	}
+
+	objects := []string{}
+	for _, name := range names {
+		objects = append(objects, prefix+name)
+	}
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+	}
+	return objects, nil
+}
+
+func (m *mockGCSClient) GetObject(ctx context.Context, bucket, name string) ([]byte, error) {
+	return []byte(name), nil
+}
+
+func newGCSTestConfig(baseLocation string) *config.Config {
+	return &config.Config{
+		BaseLocation:     baseLocation,
+		SingleMigrations: []string{"migrations/config"},
+		TenantMigrations: []string{"migrations/tenants"},
+		TenantScripts:    []string{"migrations/tenants-scripts"},
+	}
+}
+
+func TestNewGCSLoader(t *testing.T) {
+	loader := New(context.TODO(), newGCSTestConfig("gs://lukaszbudniktest-bucket/app"))
+	assert.IsType(t, &gcsLoader{}, loader)
+}
+
+func TestGCSGetSourceMigrations(t *testing.T) {
+	mock := &mockGCSClient{}
+	loader := &gcsLoader{baseLoader{context.TODO(), newGCSTestConfig("gs://lukaszbudniktest-bucket/app/")}}
+
+	migrations, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
+
+	assert.Len(t, migrations, 6)
+
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/config/201602160001.sql", migrations[0].File)
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/config", migrations[0].SourceDir)
+	assert.Equal(t, "201602160001.sql", migrations[0].Name)
+	assert.Equal(t, types.MigrationTypeSingleMigration, migrations[0].MigrationType)
+	assert.Equal(t, "app/migrations/config/201602160001.sql", migrations[0].Contents)
+
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/config/201602160002.sql", migrations[1].File)
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/tenants/201602160002.sql", migrations[2].File)
+	assert.Equal(t, types.MigrationTypeTenantMigration, migrations[2].MigrationType)
+
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/tenants/202001100004.sql", migrations[3].File)
+	assert.Equal(t, "app/migrations/tenants/202001100004.down.sql", migrations[3].DownContents)
+
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/tenants-scripts/cleanup.sql", migrations[4].File)
+	assert.Equal(t, types.MigrationTypeTenantScript, migrations[4].MigrationType)
+	assert.Equal(t, "gs://lukaszbudniktest-bucket/app/migrations/tenants-scripts/recreate-triggers.sql", migrations[5].File)
+}
+
+func TestGCSHealthCheck(t *testing.T) {
+	mock := &mockGCSClient{}
+	loader := &gcsLoader{baseLoader{context.TODO(), newGCSTestConfig("gs://lukaszbudniktest-bucket/app")}}
+
+	assert.Nil(t, loader.doHealthCheck(mock))
+	assert.Equal(t, []string{"app/migrations/config/", "app/migrations/tenants/", "app/migrations/tenants-scripts/"}, mock.prefixes)
+
+	loader.config.SingleScripts = []string{"migrations/non-existing"}
+	assert.Equal(t, "storage: bucket lukaszbudniktest-bucket prefix app/migrations/non-existing/ not found", loader.doHealthCheck(mock).Error())
+}
+
+func TestGCSGetSourceMigrationsError(t *testing.T) {
+	mock := &mockGCSClient{}
+	loader := &gcsLoader{baseLoader{context.TODO(), newGCSTestConfig("gs://lukaszbudniktest-bucket")}}
+
+	_, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Equal(t, "storage: bucket lukaszbudniktest-bucket prefix migrations/config/ not found", err.Error())
+}
+
+// fake GCS server implements JSON API objects list and media download endpoints
+func newFakeGCSServer(objects map[string]string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o") {
+			prefix := r.URL.Query().Get("prefix")
+			items := []map[string]string{}
+			prefixes := []string{}
+			for name := range objects {
+				if !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				if i := strings.Index(name[len(prefix):], "/"); i >= 0 {
+					prefixes = append(prefixes, name[:len(prefix)+i+1])
+					continue
+				}
+				items = append(items, map[string]string{"bucket": "bucket", "name": name})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"kind": "storage#objects", "items": items, "prefixes": prefixes})
+			return
+		}
+		contents, ok := objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(contents))
+	}))
+}
+
+func TestGCSStorageClient(t *testing.T) {
+	server := newFakeGCSServer(map[string]string{
+		"migrations/config/201602160001.sql":        "create table config",
+		"migrations/config/nested/201602160002.sql": "select 1",
+		"migrations/config-scripts/cleanup.sql":     "delete from config",
+	})
+	defer server.Close()
+
+	ctx := context.TODO()
+	storageClient, err := storage.NewClient(ctx, option.WithEndpoint(server.URL+"/storage/v1/"), option.WithHTTPClient(server.Client()))
+	assert.Nil(t, err)
+	client := &gcsStorageClient{storageClient}
+
+	names, err := client.ListObjects(ctx, "bucket", "migrations/config/", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"migrations/config/201602160001.sql"}, names)
+
+	contents, err := client.GetObject(ctx, "bucket", "migrations/config/201602160001.sql")
+	assert.Nil(t, err)
+	assert.Equal(t, "create table config", string(contents))
+
+	_, err = client.GetObject(ctx, "bucket", "migrations/config/non-existing.sql")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
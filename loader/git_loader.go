@@ -0,0 +1,251 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const (
+	gitLocationPrefix = "git+file://"
+	gitDefaultRef     = "HEAD"
+)
+
+// gitLoader is struct used for implementing Loader interface for loading migrations from a local git repository
+// using git command line client, it does not need a working tree and works with bare repositories too
+type gitLoader struct {
+	baseLoader
+	commitSha string
+	// blobs of source dirs and their contents read at commitSha
+	dirBlobs map[string][]gitBlob
+	contents map[string][]byte
+}
+
+// isGitLocation returns true if base location points to a git repository
+// either explicitly using git+file:// prefix or implicitly by pointing to a local bare repository
+func isGitLocation(baseLocation string) bool {
+	if strings.HasPrefix(baseLocation, gitLocationPrefix) {
+		return true
+	}
+	repo, _, _ := parseGitLocation(baseLocation)
+	return isBareRepository(repo)
+}
+
+// isBareRepository checks if dir has the layout of a bare git repository
+func isBareRepository(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGitLocation splits base location into repository path, repository location (used as a prefix of source dirs) and ref,
+// ref is optional and is passed as URL fragment, for example git+file:///path/repo.git#v1.0.0
+func parseGitLocation(baseLocation string) (repo, location, ref string) {
+	location = baseLocation
+	ref = gitDefaultRef
+	if i := strings.LastIndex(location, "#"); i >= 0 {
+		if i < len(location)-1 {
+			ref = location[i+1:]
+		}
+		location = location[:i]
+	}
+	location = strings.TrimSuffix(location, "/")
+	repo = strings.TrimPrefix(location, gitLocationPrefix)
+	return repo, location, ref
+}
+
+// GetSourceMigrations returns all migrations from git repository at configured ref
+func (gl *gitLoader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("git", time.Now())
+	_, span := gl.startSpan("git")
+	defer span.End()
+
+	commitSha, err := gl.resolveCommitSha()
+	if err != nil {
+		return nil, gl.loadFailed(span, err)
+	}
+	gl.commitSha = commitSha
+
+	if err := gl.readBlobs(); err != nil {
+		return nil, gl.loadFailed(span, err)
+	}
+
+	migrations, err := gl.readMigrations(gl.readFromDirs)
+	if err != nil {
+		return nil, gl.loadFailed(span, err)
+	}
+
+	return migrations, nil
+}
+
+// GetCommitSha returns commit SHA resolved when loading source migrations
+func (gl *gitLoader) GetCommitSha() string {
+	return gl.commitSha
+}
+
+// HealthCheck verifies that ref can be resolved and all configured source directories exist at resolved commit
+func (gl *gitLoader) HealthCheck() error {
+	commitSha, err := gl.resolveCommitSha()
+	if err != nil {
+		return err
+	}
+	for _, dirs := range [][]string{gl.config.SingleMigrations, gl.config.TenantMigrations, gl.config.SingleScripts, gl.config.TenantScripts} {
+		for _, dir := range dirs {
+			if _, err := gl.listBlobs(commitSha, dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gitBlob is a file stored in git tree
+type gitBlob struct {
+	name string
+	oid  string
+}
+
+func (gl *gitLoader) resolveCommitSha() (string, error) {
+	_, _, ref := parseGitLocation(gl.config.BaseLocation)
+	// refs cannot start with - and would be parsed as options
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("Invalid git ref %v", ref)
+	}
+	out, err := gl.git(nil, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("Could not resolve git ref %v: %v", ref, err.Error())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// listBlobs returns files stored directly in dir at given commit, subdirectories are skipped just like in disk loader
+func (gl *gitLoader) listBlobs(commitSha, dir string) ([]gitBlob, error) {
+	dir = strings.Trim(dir, "/")
+	out, err := gl.git(nil, "ls-tree", "-z", fmt.Sprintf("%v:%v", commitSha, dir))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read source dir %v: %v", dir, err.Error())
+	}
+	blobs := []gitBlob{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// entry format: <mode> SP <type> SP <object> TAB <name>
+		tab := strings.Index(entry, "\t")
+		if tab < 0 {
+			continue
+		}
+		fields := strings.Fields(entry[:tab])
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		blobs = append(blobs, gitBlob{name: entry[tab+1:], oid: fields[2]})
+	}
+	return blobs, nil
+}
+
+// readBlobs lists all source dirs at commitSha and reads contents of all their blobs using a single git cat-file --batch process
+func (gl *gitLoader) readBlobs() error {
+	gl.dirBlobs = map[string][]gitBlob{}
+	var oids bytes.Buffer
+	for _, dirs := range [][]string{gl.config.SingleMigrations, gl.config.TenantMigrations, gl.config.SingleScripts, gl.config.TenantScripts} {
+		for _, dir := range dirs {
+			blobs, err := gl.listBlobs(gl.commitSha, dir)
+			if err != nil {
+				return err
+			}
+			gl.dirBlobs[dir] = blobs
+			for _, blob := range blobs {
+				fmt.Fprintln(&oids, blob.oid)
+			}
+		}
+	}
+
+	out, err := gl.git(&oids, "cat-file", "--batch")
+	if err != nil {
+		return fmt.Errorf("Could not read files: %v", err.Error())
+	}
+	gl.contents, err = parseCatFileBatch(out)
+	return err
+}
+
+// parseCatFileBatch parses git cat-file --batch output, every object is returned as:
+// <oid> SP <type> SP <size> LF <contents> LF
+func parseCatFileBatch(out []byte) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	reader := bufio.NewReader(bytes.NewReader(out))
+	for {
+		header, err := reader.ReadString('\n')
+		if err == io.EOF && header == "" {
+			return contents, nil
+		}
+		fields := strings.Fields(header)
+		if err != nil || len(fields) != 3 {
+			return nil, fmt.Errorf("Could not read file %v: unexpected git cat-file output", strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("Could not read file %v: invalid size %v", fields[0], fields[2])
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("Could not read file %v: %v", fields[0], err.Error())
+		}
+		contents[fields[0]] = data[:size]
+	}
+}
+
+func (gl *gitLoader) readFromDirs(migrations map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error {
+	_, location, _ := parseGitLocation(gl.config.BaseLocation)
+	for _, dir := range dirs {
+		// source dir and file do not contain ref so that migrations are not considered new after every commit
+		sourceDir := fmt.Sprintf("%v/%v", location, strings.Trim(dir, "/"))
+		for _, blob := range gl.dirBlobs[dir] {
+			contents, ok := gl.contents[blob.oid]
+			if !ok {
+				return fmt.Errorf("Could not read file %v/%v", sourceDir, blob.name)
+			}
+			hasher := sha256.New()
+			hasher.Write(contents)
+			m := types.Migration{Name: blob.name, SourceDir: sourceDir, File: fmt.Sprintf("%v/%v", sourceDir, blob.name), MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+
+			e, ok := migrations[m.Name]
+			if ok {
+				e = append(e, m)
+			} else {
+				e = []types.Migration{m}
+			}
+			migrations[m.Name] = e
+		}
+	}
+	return nil
+}
+
+// git runs git command against the repository and returns its standard output, stdin is optional
+func (gl *gitLoader) git(stdin io.Reader, args ...string) ([]byte, error) {
+	repo, _, _ := parseGitLocation(gl.config.BaseLocation)
+	cmd := exec.CommandContext(gl.ctx, "git", append([]string{"-C", repo}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %v", err.Error(), msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
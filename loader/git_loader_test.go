@@ -0,0 +1,173 @@
+package loader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=migrator", "-c", "user.email=migrator@example.com"}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeFile(t *testing.T, dir, name, contents string) {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+}
+
+// setupGitRepository creates a repository with two commits, first commit is tagged v1
+func setupGitRepository(t *testing.T) (string, string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "migrator-git")
+	assert.Nil(t, err)
+
+	runGit(t, dir, "init", "-q")
+	writeFile(t, dir, "migrations/config/201602160001.sql", "create table {schema}.config")
+	writeFile(t, dir, "migrations/tenants/201602160002.sql", "create table {schema}.settings")
+	writeFile(t, dir, "migrations/tenants/201602160002.down.sql", "drop table {schema}.settings")
+	writeFile(t, dir, "migrations/tenants/nested/ignored.sql", "select 1")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "tag", "v1")
+	v1 := runGit(t, dir, "rev-parse", "HEAD")
+
+	writeFile(t, dir, "migrations/tenants/201602160003.sql", "alter table {schema}.settings add column v text")
+	writeFile(t, dir, "migrations/tenants-scripts/cleanup.sql", "delete from {schema}.settings")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "second")
+	head := runGit(t, dir, "rev-parse", "HEAD")
+
+	return dir, v1, head
+}
+
+func newGitTestConfig(baseLocation string) *config.Config {
+	return &config.Config{
+		BaseLocation:     baseLocation,
+		SingleMigrations: []string{"migrations/config"},
+		TenantMigrations: []string{"migrations/tenants"},
+		TenantScripts:    []string{"migrations/tenants-scripts"},
+	}
+}
+
+func TestGitGetSourceMigrations(t *testing.T) {
+	dir, _, head := setupGitRepository(t)
+	defer os.RemoveAll(dir)
+
+	baseLocation := "git+file://" + dir
+	loader := New(context.TODO(), newGitTestConfig(baseLocation))
+	assert.IsType(t, &gitLoader{}, loader)
+
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Equal(t, head, loader.GetCommitSha())
+	assert.Len(t, migrations, 4)
+
+	assert.Equal(t, baseLocation+"/migrations/config/201602160001.sql", migrations[0].File)
+	assert.Equal(t, baseLocation+"/migrations/config", migrations[0].SourceDir)
+	assert.Equal(t, types.MigrationTypeSingleMigration, migrations[0].MigrationType)
+	assert.Equal(t, "create table {schema}.config", migrations[0].Contents)
+	assert.Equal(t, "4f9ac997964f466a0d20818c2e87945fe6d388dfa06b2f7821793ea766037bfb", migrations[0].CheckSum)
+
+	assert.Equal(t, baseLocation+"/migrations/tenants/201602160002.sql", migrations[1].File)
+	assert.Equal(t, types.MigrationTypeTenantMigration, migrations[1].MigrationType)
+	assert.Equal(t, "drop table {schema}.settings", migrations[1].DownContents)
+
+	assert.Equal(t, baseLocation+"/migrations/tenants/201602160003.sql", migrations[2].File)
+	assert.Equal(t, baseLocation+"/migrations/tenants-scripts/cleanup.sql", migrations[3].File)
+	assert.Equal(t, types.MigrationTypeTenantScript, migrations[3].MigrationType)
+}
+
+func TestGitGetSourceMigrationsAtRef(t *testing.T) {
+	dir, v1, _ := setupGitRepository(t)
+	defer os.RemoveAll(dir)
+
+	cfg := newGitTestConfig("git+file://" + dir + "#v1")
+	cfg.TenantScripts = []string{}
+	loader := New(context.TODO(), cfg)
+
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Equal(t, v1, loader.GetCommitSha())
+	assert.Len(t, migrations, 2)
+	// file names do not contain ref
+	assert.Equal(t, "git+file://"+dir+"/migrations/tenants/201602160002.sql", migrations[1].File)
+}
+
+func TestGitBareRepository(t *testing.T) {
+	dir, _, head := setupGitRepository(t)
+	defer os.RemoveAll(dir)
+
+	bare := dir + ".git"
+	runGit(t, dir, "clone", "-q", "--bare", dir, bare)
+	defer os.RemoveAll(bare)
+
+	loader := New(context.TODO(), newGitTestConfig(bare))
+	assert.IsType(t, &gitLoader{}, loader)
+
+	migrations, err := loader.GetSourceMigrations()
+	assert.Nil(t, err)
+
+	assert.Equal(t, head, loader.GetCommitSha())
+	assert.Len(t, migrations, 4)
+	assert.Equal(t, bare+"/migrations/config/201602160001.sql", migrations[0].File)
+	assert.Nil(t, loader.HealthCheck())
+}
+
+func TestGitErrors(t *testing.T) {
+	dir, _, _ := setupGitRepository(t)
+	defer os.RemoveAll(dir)
+
+	loader := New(context.TODO(), newGitTestConfig("git+file://"+dir+"#non-existing"))
+	err := loader.HealthCheck()
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Could not resolve git ref non-existing"))
+	_, err = loader.GetSourceMigrations()
+	assert.IsType(t, &ErrLoadFailed{}, err)
+
+	cfg := newGitTestConfig("git+file://" + dir)
+	cfg.SingleScripts = []string{"migrations/non-existing"}
+	loader = New(context.TODO(), cfg)
+	err = loader.HealthCheck()
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Could not read source dir migrations/non-existing"))
+}
+
+func TestGitInvalidRef(t *testing.T) {
+	dir, _, _ := setupGitRepository(t)
+	defer os.RemoveAll(dir)
+
+	loader := New(context.TODO(), newGitTestConfig("git+file://"+dir+"#--output=/tmp/x"))
+	err := loader.HealthCheck()
+	assert.Equal(t, "Invalid git ref --output=/tmp/x", err.Error())
+}
+
+func TestParseCatFileBatch(t *testing.T) {
+	out := "1111 blob 8\nselect 1\n2222 blob 0\n\n3333 blob 9\nselect\n2;\n"
+	contents, err := parseCatFileBatch([]byte(out))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"1111": []byte("select 1"), "2222": []byte(""), "3333": []byte("select\n2;")}, contents)
+
+	_, err = parseCatFileBatch([]byte("4444 missing\n"))
+	assert.Equal(t, "Could not read file 4444 missing: unexpected git cat-file output", err.Error())
+
+	_, err = parseCatFileBatch([]byte("5555 blob 100\nselect 1\n"))
+	assert.Equal(t, "Could not read file 5555: unexpected EOF", err.Error())
+}
@@ -2,45 +2,167 @@ package loader
 
 import (
 	"context"
+	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 
+	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/tracing"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
 // Loader interface abstracts all loading operations performed by migrator
 type Loader interface {
-	GetSourceMigrations() []types.Migration
+	// GetSourceMigrations returns sorted source migrations, errors are returned as ErrLoadFailed
+	GetSourceMigrations() ([]types.Migration, error)
+	// HealthCheck verifies that all configured source directories can be listed
+	HealthCheck() error
+	// GetCommitSha returns commit SHA of loaded source migrations, empty when source is not a git repository
+	GetCommitSha() string
 }
 
 // Factory is a factory method for creating Loader instance
 type Factory func(context.Context, *config.Config) Loader
 
-// New returns new instance of Loader, currently DiskLoader is available
+// New returns new instance of Loader based on the base location: AWS S3, Google Cloud Storage, zip or tar.gz archive, Azure Blob Storage, git repository or disk
 func New(ctx context.Context, config *config.Config) Loader {
 	if strings.HasPrefix(config.BaseLocation, "s3://") {
 		return &s3Loader{baseLoader{ctx, config}}
 	}
+	if strings.HasPrefix(config.BaseLocation, gcsLocationPrefix) {
+		return &gcsLoader{baseLoader{ctx, config}}
+	}
+	if isArchiveLocation(config.BaseLocation) {
+		return &archiveLoader{baseLoader{ctx, config}}
+	}
 	if matched, _ := regexp.Match(`^https://.*\.blob\.core\.windows\.net/.*`, []byte(config.BaseLocation)); matched {
 		return &azureBlobLoader{baseLoader{ctx, config}}
 	}
+	if isGitLocation(config.BaseLocation) {
+		return &gitLoader{baseLoader: baseLoader{ctx, config}}
+	}
 	return &diskLoader{baseLoader{ctx, config}}
 }
 
+// downMigrationSuffix marks down (rollback) migrations
+// for example 001_add_users.down.sql is a down migration for 001_add_users.sql
+const downMigrationSuffix = ".down"
+
+// ErrLoadFailed is returned when source migrations could not be loaded or are invalid
+type ErrLoadFailed struct {
+	BaseLocation string
+	Cause        error
+}
+
+func (e *ErrLoadFailed) Error() string {
+	return e.Cause.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ErrLoadFailed) Unwrap() error {
+	return e.Cause
+}
+
 // baseLoader is the base struct for implementing Loader interface
 type baseLoader struct {
 	ctx    context.Context
 	config *config.Config
 }
 
-func (bl *baseLoader) sortMigrations(migrationsMap map[string][]types.Migration, migrations *[]types.Migration) {
-	keys := make([]string, 0, len(migrationsMap))
-	for key := range migrationsMap {
-		keys = append(keys, key)
+// startSpan starts span for GetSourceMigrations, spans of downloaded objects are its children
+func (bl *baseLoader) startSpan(loader string) (context.Context, *tracing.Span) {
+	return tracing.StartSpan(bl.ctx, "loader.GetSourceMigrations", tracing.Attribute{Key: "loader", Value: loader}, tracing.Attribute{Key: "baseLocation", Value: bl.config.MaskedBaseLocation()})
+}
+
+// traceObject calls fetch within a span created for a single object, fetch returns true when object was read from cache
+func traceObject(ctx context.Context, object string, fetch func(context.Context) (bool, error)) error {
+	ctx, span := tracing.StartSpan(ctx, "loader.GetObject", tracing.Attribute{Key: "object", Value: object})
+	defer span.End()
+	cached, err := fetch(ctx)
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	span.SetAttributes(tracing.Attribute{Key: "cached", Value: cached})
+	return err
+}
+
+// loadFailed marks span as failed and wraps err in ErrLoadFailed
+func (bl *baseLoader) loadFailed(span *tracing.Span, err error) error {
+	span.SetError(err.Error())
+	return &ErrLoadFailed{BaseLocation: bl.config.MaskedBaseLocation(), Cause: err}
+}
+
+// GetCommitSha returns empty string, only git loader knows the commit SHA of source migrations
+func (bl *baseLoader) GetCommitSha() string {
+	return ""
+}
+
+// readFunc reads migrations of a given type from source dirs and adds them to migrationsMap
+type readFunc func(migrationsMap map[string][]types.Migration, dirs []string, migrationType types.MigrationType) error
+
+// readMigrations reads and sorts migrations of all types, single and tenant migrations are sorted together
+// and are followed by single scripts and then by tenant scripts
+func (bl *baseLoader) readMigrations(read readFunc) ([]types.Migration, error) {
+	type sourceDirs struct {
+		migrationType types.MigrationType
+		dirs          []string
+	}
+	groups := [][]sourceDirs{
+		{{types.MigrationTypeSingleMigration, bl.config.SingleMigrations}, {types.MigrationTypeTenantMigration, bl.config.TenantMigrations}},
+		{{types.MigrationTypeSingleScript, bl.config.SingleScripts}},
+		{{types.MigrationTypeTenantScript, bl.config.TenantScripts}},
+	}
+
+	migrations := []types.Migration{}
+	for _, group := range groups {
+		migrationsMap := make(map[string][]types.Migration)
+		for _, source := range group {
+			if err := read(migrationsMap, source.dirs, source.migrationType); err != nil {
+				return nil, err
+			}
+		}
+		if err := bl.sortMigrations(migrationsMap, &migrations); err != nil {
+			return nil, err
+		}
+	}
+	return migrations, nil
+}
+
+// pairDownMigrations removes down migrations from migrationsMap
+// and stores their contents in the matching migrations from the same source dir
+func (bl *baseLoader) pairDownMigrations(migrationsMap map[string][]types.Migration) {
+	for name, downMigrations := range migrationsMap {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if !strings.HasSuffix(base, downMigrationSuffix) {
+			continue
+		}
+		upName := strings.TrimSuffix(base, downMigrationSuffix) + ext
+		upMigrations := migrationsMap[upName]
+		for _, down := range downMigrations {
+			found := false
+			for i := range upMigrations {
+				if upMigrations[i].SourceDir == down.SourceDir {
+					upMigrations[i].DownContents = down.Contents
+					found = true
+				}
+			}
+			if !found {
+				common.LogWarn(common.WithFields(bl.ctx, common.Field{Key: common.FieldFile, Value: down.File}), "Down migration does not have a matching migration %v, ignoring", upName)
+			}
+		}
+		delete(migrationsMap, name)
+	}
+}
+
+func (bl *baseLoader) sortMigrations(migrationsMap map[string][]types.Migration, migrations *[]types.Migration) error {
+	bl.pairDownMigrations(migrationsMap)
+
+	keys, err := bl.sortMigrationNames(migrationsMap)
+	if err != nil {
+		return err
 	}
-	sort.Strings(keys)
 
 	for _, key := range keys {
 		ms := migrationsMap[key]
@@ -48,4 +170,5 @@ func (bl *baseLoader) sortMigrations(migrationsMap map[string][]types.Migration,
 			*migrations = append(*migrations, m)
 		}
 	}
+	return nil
 }
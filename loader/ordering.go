@@ -0,0 +1,180 @@
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// version is a list of numeric components without leading zeros, trailing zero components are ignored when comparing
+type version []string
+
+func (v version) String() string {
+	return strings.Join(v, ".")
+}
+
+// compare returns -1, 0, or 1 if v is lower, equal, or greater than other
+func (v version) compare(other version) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		a, b := "0", "0"
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(other) {
+			b = other[i]
+		}
+		// components do not have leading zeros so longer number is greater
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func trimLeadingZeros(number string) string {
+	trimmed := strings.TrimLeft(number, "0")
+	if trimmed == "" {
+		return "0"
+	}
+	return trimmed
+}
+
+// orderingStrategy extracts version from migration name
+type orderingStrategy struct {
+	description string
+	pattern     *regexp.Regexp
+	parse       func(match []string) (version, bool)
+}
+
+var semverSeparator = regexp.MustCompile(`[._]`)
+
+// semverMigration matches Flyway style migration names, for example V1.2.3__add_users.sql
+var semverMigration = regexp.MustCompile(`^V(\d+(?:[._]\d+)*)__.+$`)
+
+func parseSemver(s string) version {
+	v := version{}
+	for _, component := range semverSeparator.Split(s, -1) {
+		v = append(v, trimLeadingZeros(component))
+	}
+	return v
+}
+
+// NormaliseSemver normalises Flyway version so that versions equal in semver ordering are equal strings,
+// for example 1_02, 1.2, and 1.2.0 are all normalised to 1.2
+func NormaliseSemver(s string) string {
+	v := parseSemver(s)
+	// trailing zero components are ignored when comparing
+	for len(v) > 1 && v[len(v)-1] == "0" {
+		v = v[:len(v)-1]
+	}
+	return v.String()
+}
+
+// SemverMigrationVersion returns normalised version of Flyway style migration name, false is returned when name does not match
+func SemverMigrationVersion(name string) (string, bool) {
+	match := semverMigration.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return NormaliseSemver(match[1]), true
+}
+
+var orderingStrategies = map[string]orderingStrategy{
+	config.MigrationOrderingNumeric: {
+		description: "numeric prefix, for example 10_add_users.sql",
+		pattern:     regexp.MustCompile(`^(\d+)(?:[^\d].*)?$`),
+		parse: func(match []string) (version, bool) {
+			return version{trimLeadingZeros(match[1])}, true
+		},
+	},
+	config.MigrationOrderingTimestamp: {
+		description: "timestamp prefix yyyyMMddHHmm or yyyyMMddHHmmss, for example 202003011200_add_users.sql",
+		pattern:     regexp.MustCompile(`^(\d{12}|\d{14})(?:[^\d].*)?$`),
+		parse: func(match []string) (version, bool) {
+			timestamp := match[1]
+			if len(timestamp) == 12 {
+				timestamp += "00"
+			}
+			if _, err := time.Parse("20060102150405", timestamp); err != nil {
+				return nil, false
+			}
+			return version{timestamp}, true
+		},
+	},
+	config.MigrationOrderingSemver: {
+		description: "Flyway style V<version>__<description>, for example V1.2.3__add_users.sql",
+		pattern:     semverMigration,
+		parse: func(match []string) (version, bool) {
+			return parseSemver(match[1]), true
+		},
+	},
+}
+
+// sortMigrationNames sorts names of migrations (keys of migrationsMap) using configured ordering strategy.
+// Lexical ordering is the default and does not validate names.
+// Other strategies return an error when a name does not match the pattern or when the same version is used more than once.
+// Scripts are not versioned and are always sorted lexically.
+func (bl *baseLoader) sortMigrationNames(migrationsMap map[string][]types.Migration) ([]string, error) {
+	keys := make([]string, 0, len(migrationsMap))
+	for key := range migrationsMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	strategy, ok := orderingStrategies[bl.config.MigrationOrdering]
+	if !ok || len(keys) == 0 || isScripts(migrationsMap[keys[0]]) {
+		return keys, nil
+	}
+
+	versions := map[string]version{}
+	for _, key := range keys {
+		match := strategy.pattern.FindStringSubmatch(key)
+		var v version
+		if match != nil {
+			v, ok = strategy.parse(match)
+		}
+		if match == nil || !ok {
+			return nil, fmt.Errorf("Migration %v does not match %v ordering: %v", migrationsMap[key][0].File, bl.config.MigrationOrdering, strategy.description)
+		}
+		// the same file name in multiple directories
+		if len(migrationsMap[key]) > 1 {
+			return nil, fmt.Errorf("Duplicate migration version %v: %v and %v", v, migrationsMap[key][0].File, migrationsMap[key][1].File)
+		}
+		versions[key] = v
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return versions[keys[i]].compare(versions[keys[j]]) < 0
+	})
+
+	// different file names with the same version, for example 1_a.sql and 01_b.sql
+	for i := 1; i < len(keys); i++ {
+		if versions[keys[i-1]].compare(versions[keys[i]]) == 0 {
+			return nil, fmt.Errorf("Duplicate migration version %v: %v and %v", versions[keys[i]], migrationsMap[keys[i-1]][0].File, migrationsMap[keys[i]][0].File)
+		}
+	}
+
+	return keys, nil
+}
+
+func isScripts(migrations []types.Migration) bool {
+	if len(migrations) == 0 {
+		return false
+	}
+	migrationType := migrations[0].MigrationType
+	return migrationType == types.MigrationTypeSingleScript || migrationType == types.MigrationTypeTenantScript
+}
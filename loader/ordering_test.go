@@ -0,0 +1,118 @@
+package loader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOrderingTestMap(migrationType types.MigrationType, files ...string) map[string][]types.Migration {
+	migrationsMap := map[string][]types.Migration{}
+	for _, file := range files {
+		m := types.Migration{Name: file[len("migrations/ref/"):], SourceDir: file[:len("migrations/ref")], File: file, MigrationType: migrationType}
+		migrationsMap[m.Name] = append(migrationsMap[m.Name], m)
+	}
+	return migrationsMap
+}
+
+func sortTestMigrations(ordering string, migrationsMap map[string][]types.Migration) ([]string, error) {
+	loader := &baseLoader{context.TODO(), &config.Config{MigrationOrdering: ordering}}
+	migrations := []types.Migration{}
+	if err := loader.sortMigrations(migrationsMap, &migrations); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, m := range migrations {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+func TestSortMigrationsLexical(t *testing.T) {
+	migrationsMap := newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/9_y.sql", "migrations/ref/10_x.sql", "migrations/cfg/10_x.sql", "migrations/ref/init.sql")
+
+	names, err := sortTestMigrations("", migrationsMap)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10_x.sql", "10_x.sql", "9_y.sql", "init.sql"}, names)
+}
+
+func TestSortMigrationsNumeric(t *testing.T) {
+	migrationsMap := newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/9_y.sql", "migrations/ref/10_x.sql", "migrations/ten/002.sql", "migrations/ref/100-z.sql")
+
+	names, err := sortTestMigrations(config.MigrationOrderingNumeric, migrationsMap)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"002.sql", "9_y.sql", "10_x.sql", "100-z.sql"}, names)
+}
+
+func TestSortMigrationsTimestamp(t *testing.T) {
+	migrationsMap := newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/20200301120000_b.sql", "migrations/ref/202003011159_a.sql", "migrations/ten/202003011201.sql")
+
+	names, err := sortTestMigrations(config.MigrationOrderingTimestamp, migrationsMap)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"202003011159_a.sql", "20200301120000_b.sql", "202003011201.sql"}, names)
+}
+
+func TestSortMigrationsSemver(t *testing.T) {
+	migrationsMap := newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/V1.10__c.sql", "migrations/ref/V1.2__b.sql", "migrations/ten/V1__a.sql", "migrations/ref/V2_0_1__d.sql")
+
+	names, err := sortTestMigrations(config.MigrationOrderingSemver, migrationsMap)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"V1__a.sql", "V1.2__b.sql", "V1.10__c.sql", "V2_0_1__d.sql"}, names)
+}
+
+func TestSortMigrationsScriptsAreLexical(t *testing.T) {
+	migrationsMap := newOrderingTestMap(types.MigrationTypeTenantScript, "migrations/ref/recreate-triggers.sql", "migrations/ref/cleanup.sql")
+
+	names, err := sortTestMigrations(config.MigrationOrderingSemver, migrationsMap)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cleanup.sql", "recreate-triggers.sql"}, names)
+}
+
+func TestSortMigrationsInvalidName(t *testing.T) {
+	_, err := sortTestMigrations(config.MigrationOrderingNumeric, newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/1_a.sql", "migrations/ref/init.sql"))
+	assert.Equal(t, "Migration migrations/ref/init.sql does not match numeric ordering: numeric prefix, for example 10_add_users.sql", err.Error())
+	// month 13
+	_, err = sortTestMigrations(config.MigrationOrderingTimestamp, newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/202013011200.sql"))
+	assert.NotNil(t, err)
+	_, err = sortTestMigrations(config.MigrationOrderingSemver, newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/V1_init.sql"))
+	assert.NotNil(t, err)
+}
+
+func TestSortMigrationsDuplicateVersion(t *testing.T) {
+	// the same file name in single and tenant migrations
+	migrationsMap := newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/1_a.sql")
+	migrationsMap["1_a.sql"] = append(migrationsMap["1_a.sql"], types.Migration{Name: "1_a.sql", SourceDir: "migrations/ten", File: "migrations/ten/1_a.sql", MigrationType: types.MigrationTypeTenantMigration})
+	_, err := sortTestMigrations(config.MigrationOrderingNumeric, migrationsMap)
+	assert.Equal(t, "Duplicate migration version 1: migrations/ref/1_a.sql and migrations/ten/1_a.sql", err.Error())
+
+	_, err = sortTestMigrations(config.MigrationOrderingNumeric, newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/1_a.sql", "migrations/ref/01_b.sql", "migrations/ref/2_c.sql"))
+	assert.Equal(t, "Duplicate migration version 1: migrations/ref/01_b.sql and migrations/ref/1_a.sql", err.Error())
+
+	_, err = sortTestMigrations(config.MigrationOrderingSemver, newOrderingTestMap(types.MigrationTypeSingleMigration, "migrations/ref/V1.1__a.sql", "migrations/ref/V1.1.0__b.sql"))
+	assert.Equal(t, "Duplicate migration version 1.1: migrations/ref/V1.1.0__b.sql and migrations/ref/V1.1__a.sql", err.Error())
+}
+
+func TestNormaliseSemver(t *testing.T) {
+	assert.Equal(t, "1.2", NormaliseSemver("1.2"))
+	assert.Equal(t, "1.2", NormaliseSemver("1_02"))
+	assert.Equal(t, "1.2", NormaliseSemver("1.2.0"))
+	assert.Equal(t, "0", NormaliseSemver("0.0"))
+	assert.Equal(t, "20200301", NormaliseSemver("20200301"))
+
+	// versions normalised to the same string are equal in semver ordering
+	assert.Equal(t, 0, parseSemver("1_02").compare(parseSemver("1.2.0")))
+	assert.NotEqual(t, 0, parseSemver("1.2").compare(parseSemver("1.20")))
+	assert.NotEqual(t, NormaliseSemver("1.2"), NormaliseSemver("1.20"))
+}
+
+func TestSemverMigrationVersion(t *testing.T) {
+	version, ok := SemverMigrationVersion("V1_02_0__add_users.sql")
+	assert.True(t, ok)
+	assert.Equal(t, "1.2", version)
+
+	_, ok = SemverMigrationVersion("R__views.sql")
+	assert.False(t, ok)
+}
@@ -2,15 +2,18 @@ package loader
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -20,41 +23,67 @@ type s3Loader struct {
 }
 
 // GetSourceMigrations returns all migrations from AWS S3 location
-func (s3l *s3Loader) GetSourceMigrations() []types.Migration {
+func (s3l *s3Loader) GetSourceMigrations() ([]types.Migration, error) {
+	defer metrics.ObserveLoaderFetch("s3", time.Now())
+	ctx, span := s3l.startSpan("s3")
+	defer span.End()
+
 	sess, err := session.NewSession()
 	if err != nil {
-		panic(err.Error())
+		return nil, s3l.loadFailed(span, err)
 	}
 	client := s3.New(sess)
-	return s3l.doGetSourceMigrations(client)
+	migrations, err := s3l.doGetSourceMigrations(ctx, client)
+	if err != nil {
+		return nil, s3l.loadFailed(span, err)
+	}
+	return migrations, nil
 }
 
-func (s3l *s3Loader) doGetSourceMigrations(client s3iface.S3API) []types.Migration {
-	migrations := []types.Migration{}
-
-	singleMigrationsObjects := s3l.getObjectList(client, s3l.config.SingleMigrations)
-	tenantMigrationsObjects := s3l.getObjectList(client, s3l.config.TenantMigrations)
-	singleScriptsObjects := s3l.getObjectList(client, s3l.config.SingleScripts)
-	tenantScriptsObjects := s3l.getObjectList(client, s3l.config.TenantScripts)
-
-	migrationsMap := make(map[string][]types.Migration)
-	s3l.getObjects(client, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
-	s3l.getObjects(client, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
-	s3l.sortMigrations(migrationsMap, &migrations)
-
-	migrationsMap = make(map[string][]types.Migration)
-	s3l.getObjects(client, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
-	s3l.sortMigrations(migrationsMap, &migrations)
+// HealthCheck verifies that all configured source directories can be listed
+func (s3l *s3Loader) HealthCheck() error {
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	client := s3.New(sess)
+	return s3l.doHealthCheck(client)
+}
 
-	migrationsMap = make(map[string][]types.Migration)
-	s3l.getObjects(client, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
-	s3l.sortMigrations(migrationsMap, &migrations)
+func (s3l *s3Loader) doHealthCheck(client s3iface.S3API) error {
+	bucket := strings.Replace(s3l.config.BaseLocation, "s3://", "", 1)
+	for _, prefixes := range [][]string{s3l.config.SingleMigrations, s3l.config.TenantMigrations, s3l.config.SingleScripts, s3l.config.TenantScripts} {
+		for _, prefix := range prefixes {
+			input := &s3.ListObjectsV2Input{
+				Bucket:  aws.String(bucket),
+				Prefix:  aws.String(prefix),
+				MaxKeys: aws.Int64(1),
+			}
+			// only the first page is fetched
+			err := client.ListObjectsV2Pages(input, func(*s3.ListObjectsV2Output, bool) bool {
+				return false
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	return migrations
+func (s3l *s3Loader) doGetSourceMigrations(ctx context.Context, client s3iface.S3API) ([]types.Migration, error) {
+	return s3l.readMigrations(func(migrationsMap map[string][]types.Migration, prefixes []string, migrationType types.MigrationType) error {
+		objects, err := s3l.getObjectList(client, prefixes)
+		if err != nil {
+			return err
+		}
+		s3l.pruneCache(prefixes, objects)
+		return s3l.getObjects(ctx, client, migrationsMap, objects, migrationType)
+	})
 }
 
-func (s3l *s3Loader) getObjectList(client s3iface.S3API, prefixes []string) []*string {
-	objects := []*string{}
+func (s3l *s3Loader) getObjectList(client s3iface.S3API, prefixes []string) ([]*s3.Object, error) {
+	objects := []*s3.Object{}
 
 	bucket := strings.Replace(s3l.config.BaseLocation, "s3://", "", 1)
 
@@ -69,42 +98,77 @@ func (s3l *s3Loader) getObjectList(client s3iface.S3API, prefixes []string) []*s
 		err := client.ListObjectsV2Pages(input,
 			func(page *s3.ListObjectsV2Output, lastPage bool) bool {
 
-				for _, o := range page.Contents {
-					objects = append(objects, o.Key)
-				}
+				objects = append(objects, page.Contents...)
 
 				return !lastPage
 			})
 
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
 	}
 
-	return objects
+	return objects, nil
+}
+
+// pruneCache removes cached objects which were deleted from listed prefixes
+func (s3l *s3Loader) pruneCache(prefixes []string, objects []*s3.Object) {
+	prefixKeys := []string{}
+	for _, prefix := range prefixes {
+		// trailing slash so that pruning migrations/tenants does not prune migrations/tenants-scripts
+		prefixKeys = append(prefixKeys, s3l.cacheKey(prefix+"/"))
+	}
+	keys := []string{}
+	for _, o := range objects {
+		keys = append(keys, s3l.cacheKey(aws.StringValue(o.Key)))
+	}
+	sourceObjectsCache.prune(prefixKeys, keys)
+}
+
+func (s3l *s3Loader) cacheKey(key string) string {
+	return fmt.Sprintf("%s/%s", s3l.config.BaseLocation, key)
 }
 
-func (s3l *s3Loader) getObjects(client s3iface.S3API, migrationsMap map[string][]types.Migration, objects []*string, migrationType types.MigrationType) {
+// getObjects downloads objects concurrently, objects which ETag and last modified time did not change are read from cache
+func (s3l *s3Loader) getObjects(ctx context.Context, client s3iface.S3API, migrationsMap map[string][]types.Migration, objects []*s3.Object, migrationType types.MigrationType) error {
 	bucket := strings.Replace(s3l.config.BaseLocation, "s3://", "", 1)
 
-	objectInput := &s3.GetObjectInput{Bucket: aws.String(bucket)}
-	for _, o := range objects {
-		objectInput.Key = o
-		objectOutput, err := client.GetObject(objectInput)
-		if err != nil {
-			panic(err.Error())
-		}
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(objectOutput.Body)
-		contents := buf.String()
+	contents := make([][]byte, len(objects))
+	err := fetchConcurrently(len(objects), s3l.config.LoaderConcurrency, func(i int) error {
+		o := objects[i]
+		cacheKey := s3l.cacheKey(aws.StringValue(o.Key))
+		return traceObject(ctx, cacheKey, func(ctx context.Context) (bool, error) {
+			etag, lastModified := aws.StringValue(o.ETag), aws.TimeValue(o.LastModified)
+			if cached, ok := sourceObjectsCache.get(cacheKey, etag, lastModified); ok {
+				contents[i] = cached
+				return true, nil
+			}
+			objectOutput, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: o.Key})
+			if err != nil {
+				return false, err
+			}
+			defer objectOutput.Body.Close()
+			buf := new(bytes.Buffer)
+			if _, err := buf.ReadFrom(objectOutput.Body); err != nil {
+				return false, err
+			}
+			contents[i] = buf.Bytes()
+			sourceObjectsCache.put(cacheKey, etag, lastModified, contents[i])
+			return false, nil
+		})
+	})
+	if err != nil {
+		return err
+	}
 
+	for i, o := range objects {
 		hasher := sha256.New()
-		hasher.Write([]byte(contents))
-		file := fmt.Sprintf("%s/%s", s3l.config.BaseLocation, *o)
+		hasher.Write(contents[i])
+		file := fmt.Sprintf("%s/%s", s3l.config.BaseLocation, aws.StringValue(o.Key))
 		from := strings.LastIndex(file, "/")
 		sourceDir := file[0:from]
 		name := file[from+1:]
-		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
+		m := types.Migration{Name: name, SourceDir: sourceDir, File: file, MigrationType: migrationType, Contents: string(contents[i]), CheckSum: hex.EncodeToString(hasher.Sum(nil))}
 
 		e, ok := migrationsMap[m.Name]
 		if ok {
@@ -113,6 +177,6 @@ func (s3l *s3Loader) getObjects(client s3iface.S3API, migrationsMap map[string][
 			e = []types.Migration{m}
 		}
 		migrationsMap[m.Name] = e
-
 	}
+	return nil
 }
@@ -5,9 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/lukaszbudnik/migrator/config"
@@ -16,6 +19,7 @@ import (
 
 type mockS3Client struct {
 	s3iface.S3API
+	getObjectCalls int32
 }
 
 func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, callback func(*s3.ListObjectsV2Output, bool) bool) error {
@@ -35,7 +39,8 @@ func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, callback
 		file1 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "201602160002.sql"))}
 		file2 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "202001100004.sql"))}
 		file3 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "202001100007.sql"))}
-		contents = []*s3.Object{file1, file2, file3}
+		file4 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "202001100004.down.sql"))}
+		contents = []*s3.Object{file1, file2, file3, file4}
 	case "migrations/config-scripts":
 		file1 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "recreate-triggers.sql"))}
 		file2 := &s3.Object{Key: aws.String(fmt.Sprintf("%v/%v", *input.Prefix, "cleanup.sql"))}
@@ -47,6 +52,11 @@ func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, callback
 		contents = []*s3.Object{file1, file2, file3}
 	}
 
+	for _, o := range contents {
+		o.ETag = aws.String(fmt.Sprintf("\"%x\"", *o.Key))
+		o.LastModified = aws.Time(time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC))
+	}
+
 	callback(&s3.ListObjectsV2Output{
 		Contents: contents,
 		KeyCount: aws.Int64(int64(len(contents))),
@@ -54,7 +64,8 @@ func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, callback
 	return nil
 }
 
-func (m *mockS3Client) GetObject(input *s3.GetObjectInput) (output *s3.GetObjectOutput, err error) {
+func (m *mockS3Client) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (output *s3.GetObjectOutput, err error) {
+	atomic.AddInt32(&m.getObjectCalls, 1)
 	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader([]byte(*input.Key)))}, nil
 }
 
@@ -70,7 +81,8 @@ func TestS3GetSourceMigrations(t *testing.T) {
 	}
 
 	loader := &s3Loader{baseLoader{context.TODO(), config}}
-	migrations := loader.doGetSourceMigrations(mock)
+	migrations, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
 
 	assert.Len(t, migrations, 12)
 
@@ -79,6 +91,7 @@ func TestS3GetSourceMigrations(t *testing.T) {
 	assert.Contains(t, migrations[2].File, "migrations/tenants/201602160002.sql")
 	assert.Contains(t, migrations[3].File, "migrations/ref/202001100003.sql")
 	assert.Contains(t, migrations[4].File, "migrations/tenants/202001100004.sql")
+	assert.Equal(t, "migrations/tenants/202001100004.down.sql", migrations[4].DownContents)
 	assert.Contains(t, migrations[5].File, "migrations/ref/202001100005.sql")
 	assert.Contains(t, migrations[6].File, "migrations/tenants/202001100007.sql")
 	assert.Contains(t, migrations[7].File, "migrations/config-scripts/cleanup.sql")
@@ -88,3 +101,61 @@ func TestS3GetSourceMigrations(t *testing.T) {
 	assert.Contains(t, migrations[11].File, "migrations/tenants-scripts/run-reports.sql")
 
 }
+
+func TestS3GetSourceMigrationsCached(t *testing.T) {
+	mock := &mockS3Client{}
+
+	config := &config.Config{
+		BaseLocation:      "s3://your-bucket-migrator-cached",
+		SingleMigrations:  []string{"migrations/config", "migrations/ref"},
+		TenantMigrations:  []string{"migrations/tenants"},
+		LoaderConcurrency: 3,
+	}
+
+	loader := &s3Loader{baseLoader{context.TODO(), config}}
+	migrations, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 7)
+	assert.Equal(t, int32(8), mock.getObjectCalls)
+
+	// objects did not change, all are read from cache
+	cached, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
+	assert.Equal(t, migrations, cached)
+	assert.Equal(t, int32(8), mock.getObjectCalls)
+}
+
+func TestS3GetSourceMigrationsCachedSiblingPrefixes(t *testing.T) {
+	mock := &mockS3Client{}
+
+	config := &config.Config{
+		BaseLocation:     "s3://your-bucket-migrator-cached-siblings",
+		TenantMigrations: []string{"migrations/tenants"},
+		TenantScripts:    []string{"migrations/tenants-scripts"},
+	}
+
+	loader := &s3Loader{baseLoader{context.TODO(), config}}
+	migrations, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 6)
+	assert.Equal(t, int32(7), mock.getObjectCalls)
+
+	// pruning migrations/tenants does not prune cached migrations/tenants-scripts objects
+	cached, err := loader.doGetSourceMigrations(context.TODO(), mock)
+	assert.Nil(t, err)
+	assert.Equal(t, migrations, cached)
+	assert.Equal(t, int32(7), mock.getObjectCalls)
+}
+
+func TestS3HealthCheck(t *testing.T) {
+	mock := &mockS3Client{}
+
+	config := &config.Config{
+		BaseLocation:     "s3://your-bucket-migrator",
+		SingleMigrations: []string{"migrations/config", "migrations/ref"},
+		TenantMigrations: []string{"migrations/tenants"},
+	}
+
+	loader := &s3Loader{baseLoader{context.TODO(), config}}
+	assert.Nil(t, loader.doHealthCheck(mock))
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+const namespace = "migrator"
+
+var (
+	versionsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "versions_created_total",
+		Help:      "Number of created DB versions by action.",
+	}, []string{"action"})
+
+	migrationsApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "migrations_applied_total",
+		Help:      "Number of applied migrations and scripts by migration type, tenant migrations and scripts are counted once per tenant.",
+	}, []string{"type"})
+
+	tenants = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenants",
+		Help:      "Number of tenants.",
+	})
+
+	modifiedMigrations = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "modified_migrations",
+		Help:      "Number of applied migrations which checksums do not match source migrations as of the last verification.",
+	})
+
+	checkSumFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checksum_failures_total",
+		Help:      "Number of checksum verifications which found modified migrations.",
+	})
+
+	migrationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "migration_duration_seconds",
+		Help:      "Duration of a single migration execution in a single schema by migration type and file.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type", "file"})
+
+	graphQLDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_operation_duration_seconds",
+		Help:      "Duration of GraphQL operations by operation name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP API requests by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	loaderFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "loader_fetch_duration_seconds",
+		Help:      "Duration of loading source migrations by backend.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend"})
+)
+
+func init() {
+	prometheus.MustRegister(versionsCreated, migrationsApplied, tenants, modifiedMigrations, checkSumFailures, migrationDuration, graphQLDuration, httpRequestDuration, loaderFetchDuration)
+}
+
+// Handler returns HTTP handler exposing all metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// VersionCreated records a new DB version together with all migrations and scripts applied in it
+func VersionCreated(action string, results *types.MigrationResults) {
+	versionsCreated.WithLabelValues(action).Inc()
+	if results == nil {
+		return
+	}
+	migrationsApplied.WithLabelValues(migrationTypeLabel(types.MigrationTypeSingleMigration)).Add(float64(results.SingleMigrations))
+	migrationsApplied.WithLabelValues(migrationTypeLabel(types.MigrationTypeTenantMigration)).Add(float64(results.TenantMigrationsTotal))
+	migrationsApplied.WithLabelValues(migrationTypeLabel(types.MigrationTypeSingleScript)).Add(float64(results.SingleScripts))
+	migrationsApplied.WithLabelValues(migrationTypeLabel(types.MigrationTypeTenantScript)).Add(float64(results.TenantScriptsTotal))
+}
+
+// SetTenants records current number of tenants
+func SetTenants(count int) {
+	tenants.Set(float64(count))
+}
+
+// SetModifiedMigrations records number of applied migrations which checksums do not match source migrations
+// verifications which found modified migrations are counted as checksum failures
+func SetModifiedMigrations(count int) {
+	modifiedMigrations.Set(float64(count))
+	if count > 0 {
+		checkSumFailures.Inc()
+	}
+}
+
+// ObserveMigration records duration of a migration file started at passed time
+func ObserveMigration(migrationType types.MigrationType, file string, started time.Time) {
+	migrationDuration.WithLabelValues(migrationTypeLabel(migrationType), file).Observe(time.Since(started).Seconds())
+}
+
+// ObserveGraphQLOperation records duration of a GraphQL operation started at passed time
+func ObserveGraphQLOperation(operation string, started time.Time) {
+	graphQLDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+}
+
+// ObserveHTTPRequest records duration of a HTTP request started at passed time
+func ObserveHTTPRequest(method, route string, code int, started time.Time) {
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(code)).Observe(time.Since(started).Seconds())
+}
+
+// ObserveLoaderFetch records duration of loading source migrations started at passed time
+func ObserveLoaderFetch(backend string, started time.Time) {
+	loaderFetchDuration.WithLabelValues(backend).Observe(time.Since(started).Seconds())
+}
+
+func migrationTypeLabel(migrationType types.MigrationType) string {
+	switch migrationType {
+	case types.MigrationTypeSingleMigration:
+		return "single_migration"
+	case types.MigrationTypeTenantMigration:
+		return "tenant_migration"
+	case types.MigrationTypeSingleScript:
+		return "single_script"
+	default:
+		return "tenant_script"
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func TestVersionCreated(t *testing.T) {
+	results := &types.MigrationResults{SingleMigrations: 1, TenantMigrationsTotal: 6, SingleScripts: 2, TenantScriptsTotal: 3}
+
+	VersionCreated("Apply", results)
+	VersionCreated("Apply", nil)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(versionsCreated.WithLabelValues("Apply")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(migrationsApplied.WithLabelValues("single_migration")))
+	assert.Equal(t, float64(6), testutil.ToFloat64(migrationsApplied.WithLabelValues("tenant_migration")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(migrationsApplied.WithLabelValues("single_script")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(migrationsApplied.WithLabelValues("tenant_script")))
+}
+
+func TestSetTenantsAndModifiedMigrations(t *testing.T) {
+	SetTenants(3)
+	SetModifiedMigrations(2)
+	assert.Equal(t, float64(2), testutil.ToFloat64(modifiedMigrations))
+	// repeated verifications do not accumulate
+	SetModifiedMigrations(0)
+	SetModifiedMigrations(1)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(tenants))
+	assert.Equal(t, float64(1), testutil.ToFloat64(modifiedMigrations))
+	// only verifications which found modified migrations are counted
+	assert.Equal(t, float64(2), testutil.ToFloat64(checkSumFailures))
+}
+
+func TestHandler(t *testing.T) {
+	started := time.Now()
+	ObserveMigration(types.MigrationTypeTenantMigration, "tenants/001.sql", started)
+	ObserveGraphQLOperation("CreateVersion", started)
+	ObserveHTTPRequest("GET", "/v2/config", 200, started)
+	ObserveLoaderFetch("disk", started)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := ioutil.ReadAll(w.Body)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, string(body), `migrator_migration_duration_seconds_count{file="tenants/001.sql",type="tenant_migration"} 1`)
+	assert.Contains(t, string(body), `migrator_graphql_operation_duration_seconds_count{operation="CreateVersion"} 1`)
+	assert.Contains(t, string(body), `migrator_http_request_duration_seconds_count{code="200",method="GET",route="/v2/config"} 1`)
+	assert.Contains(t, string(body), `migrator_loader_fetch_duration_seconds_count{backend="disk"} 1`)
+}
@@ -7,13 +7,18 @@ import (
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lukaszbudnik/migrator/auth"
+	"github.com/lukaszbudnik/migrator/cli"
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/health"
+	"github.com/lukaszbudnik/migrator/jobs"
 	"github.com/lukaszbudnik/migrator/loader"
 	"github.com/lukaszbudnik/migrator/notifications"
 	"github.com/lukaszbudnik/migrator/server"
+	"github.com/lukaszbudnik/migrator/tracing"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -53,16 +58,43 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := common.ConfigureLogger(cfg.LogFormat, cfg.LogLevel); err != nil {
+		common.Log("ERROR", "Error configuring logger: %v", err)
+		os.Exit(1)
+	}
+
+	if err := tracing.Configure(cfg.Tracing); err != nil {
+		common.Log("ERROR", "Error configuring tracing: %v", err)
+		os.Exit(1)
+	}
+
 	var createCoordinator = func(ctx context.Context, config *config.Config) coordinator.Coordinator {
 		coordinator := coordinator.New(ctx, config, db.New, loader.New, notifications.New)
 		return coordinator
 	}
 
+	// when command is passed migrator runs it and exits without starting HTTP server
+	// buffered spans are exported before exiting
+	if flag.NArg() > 0 {
+		exitCode := cli.Run(flag.Args(), cfg, createCoordinator, os.Stdout, os.Stderr)
+		tracing.Shutdown()
+		os.Exit(exitCode)
+	}
+
+	if _, err := auth.New(cfg); err != nil {
+		common.Log("ERROR", "Error reading auth configuration: %v", err)
+		os.Exit(1)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	versionInfo := &types.VersionInfo{Release: GitBranch, CommitSha: GitCommitSha, CommitDate: GitCommitDate, APIVersions: []string{"v1", "v2"}}
-	g := server.SetupRouter(versionInfo, cfg, createCoordinator)
+	checker := health.New(cfg, db.NewPinger(cfg), loader.New)
+	// asynchronous jobs outlive requests and are persisted in migrator schema
+	jobs := jobs.New(cfg, createCoordinator, db.NewJobStore(cfg))
+	g := server.SetupRouter(versionInfo, cfg, createCoordinator, checker, jobs)
 	if err := g.Run(":" + server.GetPort(cfg)); err != nil {
 		common.Log("ERROR", "Error starting migrator: %v", err)
 	}
+	tracing.Shutdown()
 
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,10 +14,16 @@ import (
 	"github.com/graph-gophers/graphql-go"
 	"gopkg.in/go-playground/validator.v9"
 
+	"github.com/lukaszbudnik/migrator/auth"
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/data"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/health"
+	"github.com/lukaszbudnik/migrator/jobs"
+	"github.com/lukaszbudnik/migrator/metrics"
+	"github.com/lukaszbudnik/migrator/tracing"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -69,6 +76,33 @@ func requestIDHandler() gin.HandlerFunc {
 	}
 }
 
+// tracingHandler starts server span for every request, span continues trace passed in traceparent header
+// trace ID is added to log fields so that logs can be correlated with traces
+func tracingHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracing.StartServerSpan(c.Request.Context(), c.Request.Method+" "+route, c.Request.Header.Get(tracing.TraceparentHeader),
+			tracing.Attribute{Key: "http.method", Value: c.Request.Method},
+			tracing.Attribute{Key: "http.route", Value: route},
+			tracing.Attribute{Key: "http.target", Value: c.Request.URL.RequestURI()},
+			tracing.Attribute{Key: common.FieldRequestID, Value: c.Request.Context().Value(common.RequestIDKey{})})
+		if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+			ctx = common.WithFields(ctx, common.Field{Key: common.FieldTraceID, Value: sc.TraceIDString()})
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		status := c.Writer.Status()
+		span.SetAttributes(tracing.Attribute{Key: "http.status_code", Value: status})
+		if status >= http.StatusInternalServerError {
+			span.SetError(http.StatusText(status))
+		}
+		span.End()
+	}
+}
+
 func recovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
@@ -77,17 +111,89 @@ func recovery() gin.HandlerFunc {
 				if gin.IsDebugging() {
 					debug.PrintStack()
 				}
-				c.AbortWithStatusJSON(http.StatusInternalServerError, &errorResponse{err.(string), nil})
+				c.AbortWithStatusJSON(http.StatusInternalServerError, &errorResponse{fmt.Sprintf("%v", err), nil})
 			}
 		}()
 		c.Next()
 	}
 }
 
+// errorStatusCode maps coordinator errors to HTTP status codes
+func errorStatusCode(err error) int {
+	if err == db.ErrMigrationInProgress {
+		return http.StatusConflict
+	}
+	switch err.(type) {
+	case *coordinator.VerificationError, *coordinator.ErrChecksumMismatch:
+		return http.StatusFailedDependency
+	case *db.ErrMigrationFailed:
+		return http.StatusUnprocessableEntity
+	case *db.ErrNotFound:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// abortWithError logs coordinator error and aborts request with status code and details matching the error
+func abortWithError(c *gin.Context, message string, err error) {
+	common.LogError(c.Request.Context(), "%v: %v", message, err.Error())
+	var details interface{}
+	switch e := err.(type) {
+	case *coordinator.ErrChecksumMismatch:
+		details = e.Migrations
+	case *db.ErrMigrationFailed:
+		details = map[string]interface{}{"file": e.File, "schema": e.Schema, "statementIndex": e.StatementIndex, "dbErrorCode": e.Code, "line": e.Line, "statementPosition": e.StatementPosition}
+	}
+	c.AbortWithStatusJSON(errorStatusCode(err), errorResponse{err.Error(), details})
+}
+
+// authHandler authenticates request and checks if authenticated user has required role
+// when auth is not configured authenticator is nil and all requests are allowed
+func authHandler(authenticator auth.Authenticator, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticator == nil {
+			c.Next()
+			return
+		}
+		identity, err := authenticator.Authenticate(c.Request)
+		if err != nil {
+			common.LogError(c.Request.Context(), "Authentication failed: %v", err.Error())
+			c.Header("WWW-Authenticate", authenticator.Challenge())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse{err.Error(), nil})
+			return
+		}
+		ctx := context.WithValue(c.Request.Context(), auth.RoleKey{}, identity.Role)
+		ctx = context.WithValue(ctx, auth.UserKey{}, identity.Name)
+		c.Request = c.Request.WithContext(ctx)
+		if err := auth.Authorize(ctx, role); err != nil {
+			common.LogError(ctx, "User %v with role %v is not allowed to access %v, required role: %v", identity.Name, identity.Role, c.Request.URL.Path, role)
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{err.Error(), nil})
+			return
+		}
+		c.Next()
+	}
+}
+
 func requestLoggerHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		common.LogInfo(c.Request.Context(), "clientIP=%v method=%v request=%v", c.ClientIP(), c.Request.Method, c.Request.URL.RequestURI())
+		ctx := common.WithFields(c.Request.Context(), common.Field{Key: "clientIP", Value: c.ClientIP()}, common.Field{Key: "method", Value: c.Request.Method}, common.Field{Key: "request", Value: c.Request.URL.RequestURI()})
+		common.LogInfo(ctx, "Request started")
+		started := time.Now()
+		c.Next()
+		common.LogInfo(common.WithFields(ctx, common.Field{Key: "status", Value: c.Writer.Status()}, common.Field{Key: common.FieldDuration, Value: time.Since(started)}), "Request completed")
+	}
+}
+
+// metricsHandler records duration of HTTP requests, requests not matching any route are recorded as unmatched
+func metricsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
 		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), started)
 	}
 }
 
@@ -97,14 +203,34 @@ func makeHandler(config *config.Config, newCoordinator func(context.Context, *co
 	}
 }
 
+// configHandler returns config with sensitive values masked, raw config is returned only to admins when authentication is configured
 func configHandler(c *gin.Context, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator) {
-	c.YAML(200, config)
+	if raw, _ := strconv.ParseBool(c.Query("raw")); raw {
+		if _, ok := c.Request.Context().Value(auth.RoleKey{}).(string); !ok {
+			common.LogError(c.Request.Context(), "Raw config requested but authentication is not configured")
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{"Raw config is available only when authentication is configured", nil})
+			return
+		}
+		if err := auth.Authorize(c.Request.Context(), auth.RoleAdmin); err != nil {
+			common.LogError(c.Request.Context(), "Raw config requested without admin role")
+			c.AbortWithStatusJSON(http.StatusForbidden, errorResponse{err.Error(), nil})
+			return
+		}
+		common.LogInfo(c.Request.Context(), "Returning raw config")
+		c.YAML(http.StatusOK, config)
+		return
+	}
+	c.YAML(http.StatusOK, config.Masked())
 }
 
 func migrationsSourceHandler(c *gin.Context, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator) {
 	coordinator := newCoordinator(c.Request.Context(), config)
 	defer coordinator.Dispose()
-	migrations := coordinator.GetSourceMigrations(nil)
+	migrations, err := coordinator.GetSourceMigrations(nil)
+	if err != nil {
+		abortWithError(c, "Error reading source migrations", err)
+		return
+	}
 	common.LogInfo(c.Request.Context(), "Returning source migrations: %v", len(migrations))
 	c.JSON(http.StatusOK, migrations)
 }
@@ -112,7 +238,11 @@ func migrationsSourceHandler(c *gin.Context, config *config.Config, newCoordinat
 func migrationsAppliedHandler(c *gin.Context, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator) {
 	coordinator := newCoordinator(c.Request.Context(), config)
 	defer coordinator.Dispose()
-	dbMigrations := coordinator.GetAppliedMigrations()
+	dbMigrations, err := coordinator.GetAppliedMigrations()
+	if err != nil {
+		abortWithError(c, "Error reading applied migrations", err)
+		return
+	}
 	common.LogInfo(c.Request.Context(), "Returning applied migrations: %v", len(dbMigrations))
 	c.JSON(http.StatusOK, dbMigrations)
 }
@@ -129,13 +259,16 @@ func migrationsPostHandler(c *gin.Context, config *config.Config, newCoordinator
 	coordinator := newCoordinator(c.Request.Context(), config)
 	defer coordinator.Dispose()
 
-	if ok, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums(); !ok {
-		common.LogError(c.Request.Context(), "Checksum verification failed for migrations: %v", len(offendingMigrations))
-		c.AbortWithStatusJSON(http.StatusFailedDependency, errorResponse{"Checksum verification failed. Please review offending migrations.", offendingMigrations})
+	if err := coordinator.VerifySourceMigrationsCheckSums(); err != nil {
+		abortWithError(c, "Error verifying checksums", err)
 		return
 	}
 
-	results, appliedMigrations := coordinator.ApplyMigrations(request.Mode)
+	results, appliedMigrations, err := coordinator.ApplyMigrations(request.Mode)
+	if err != nil {
+		abortWithError(c, "Error applying migrations", err)
+		return
+	}
 
 	common.LogInfo(c.Request.Context(), "Returning applied migrations: %v", len(appliedMigrations))
 
@@ -160,7 +293,11 @@ func tenantsGetHandler(c *gin.Context, config *config.Config, newCoordinator fun
 	defer coordinator.Dispose()
 	// starting v2019.1.0 GetTenants returns a slice of Tenant struct
 	// /v1 API returns a slice of strings and we must maintain backward compatibility
-	tenants := coordinator.GetTenants()
+	tenants, err := coordinator.GetTenants()
+	if err != nil {
+		abortWithError(c, "Error reading tenants", err)
+		return
+	}
 	tenantNames := []string{}
 	for _, t := range tenants {
 		tenantNames = append(tenantNames, t.Name)
@@ -181,13 +318,16 @@ func tenantsPostHandler(c *gin.Context, config *config.Config, newCoordinator fu
 	coordinator := newCoordinator(c.Request.Context(), config)
 	defer coordinator.Dispose()
 
-	if ok, offendingMigrations := coordinator.VerifySourceMigrationsCheckSums(); !ok {
-		common.LogError(c.Request.Context(), "Checksum verification failed for migrations: %v", len(offendingMigrations))
-		c.AbortWithStatusJSON(http.StatusFailedDependency, errorResponse{"Checksum verification failed. Please review offending migrations.", offendingMigrations})
+	if err := coordinator.VerifySourceMigrationsCheckSums(); err != nil {
+		abortWithError(c, "Error verifying checksums", err)
 		return
 	}
 
-	results, appliedMigrations := coordinator.AddTenantAndApplyMigrations(request.Mode, request.Name)
+	results, appliedMigrations, err := coordinator.AddTenantAndApplyMigrations(request.Mode, request.Name)
+	if err != nil {
+		abortWithError(c, "Error adding tenant", err)
+		return
+	}
 
 	common.LogInfo(c.Request.Context(), "Tenant %v added, migrations applied: %v", request.Name, len(appliedMigrations))
 
@@ -211,33 +351,51 @@ func schemaHandler(c *gin.Context, config *config.Config, newCoordinator func(co
 	c.String(http.StatusOK, strings.TrimSpace(data.SchemaDefinition))
 }
 
-// GraphQL endpoint
-func serviceHandler(c *gin.Context, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator) {
-	var params struct {
-		Query         string                 `json:"query"`
-		OperationName string                 `json:"operationName"`
-		Variables     map[string]interface{} `json:"variables"`
-	}
-	if err := c.ShouldBindJSON(&params); err != nil {
-		common.LogError(c.Request.Context(), "Bad request: %v", err.Error())
-		c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{"Invalid request, please see documentation for valid JSON payload", nil})
-		return
-	}
+// GraphQL endpoint, jobs Manager is shared by all requests
+func serviceHandler(jobs jobs.Manager) func(*gin.Context, *config.Config, func(context.Context, *config.Config) coordinator.Coordinator) {
+	return func(c *gin.Context, config *config.Config, newCoordinator func(context.Context, *config.Config) coordinator.Coordinator) {
+		var params struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := c.ShouldBindJSON(&params); err != nil {
+			common.LogError(c.Request.Context(), "Bad request: %v", err.Error())
+			c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse{"Invalid request, please see documentation for valid JSON payload", nil})
+			return
+		}
 
-	coordinator := newCoordinator(c.Request.Context(), config)
-	defer coordinator.Dispose()
-	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
-	schema := graphql.MustParseSchema(data.SchemaDefinition, &data.RootResolver{Coordinator: coordinator}, opts...)
+		coordinator := newCoordinator(c.Request.Context(), config)
+		defer coordinator.Dispose()
+		opts := []graphql.SchemaOpt{graphql.UseFieldResolvers(), graphql.Tracer(data.Tracer{})}
+		schema := graphql.MustParseSchema(data.SchemaDefinition, &data.RootResolver{Coordinator: coordinator, Jobs: jobs}, opts...)
 
-	response := schema.Exec(c.Request.Context(), params.Query, params.OperationName, params.Variables)
-	c.JSON(http.StatusOK, response)
+		started := time.Now()
+		ctx := data.WithOperation(c.Request.Context())
+		response := schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+		metrics.ObserveGraphQLOperation(data.OperationLabel(ctx), started)
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// healthHandler returns 503 Service Unavailable when any of the checks is down
+func healthHandler(checkFunc func(*gin.Context) *types.Health) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := checkFunc(c)
+		status := http.StatusOK
+		if health.Status != types.HealthStatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, health)
+	}
 }
 
 // SetupRouter setups router
-func SetupRouter(versionInfo *types.VersionInfo, config *config.Config, newCoordinator func(ctx context.Context, config *config.Config) coordinator.Coordinator) *gin.Engine {
+func SetupRouter(versionInfo *types.VersionInfo, config *config.Config, newCoordinator func(ctx context.Context, config *config.Config) coordinator.Coordinator, checker health.Checker, jobs jobs.Manager) *gin.Engine {
 	r := gin.New()
 	r.HandleMethodNotAllowed = true
-	r.Use(recovery(), requestIDHandler(), requestLoggerHandler())
+	// tracing handler is registered before recovery so that panics are recorded in server spans
+	r.Use(requestIDHandler(), tracingHandler(), recovery(), requestLoggerHandler(), metricsHandler())
 
 	// there is something seriously wrong with validator and its gin integration
 	binding.Validator = new(defaultValidator)
@@ -254,21 +412,39 @@ func SetupRouter(versionInfo *types.VersionInfo, config *config.Config, newCoord
 		c.JSON(http.StatusOK, versionInfo)
 	})
 
+	// health endpoints are used by orchestrators' probes and are not protected
+	r.GET(config.PathPrefix+"/health/live", healthHandler(func(c *gin.Context) *types.Health {
+		return checker.Live()
+	}))
+	r.GET(config.PathPrefix+"/health/ready", healthHandler(func(c *gin.Context) *types.Health {
+		return checker.Ready(c.Request.Context())
+	}))
+
+	authenticator, err := auth.New(config)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create authenticator: %v", err.Error()))
+	}
+	reader := authHandler(authenticator, auth.RoleReader)
+	operator := authHandler(authenticator, auth.RoleOperator)
+
+	r.GET(config.PathPrefix+"/metrics", reader, gin.WrapH(metrics.Handler()))
+
 	v1 := r.Group(config.PathPrefix + "/v1")
 
-	v1.GET("/config", makeHandler(config, newCoordinator, configHandler))
+	v1.GET("/config", operator, makeHandler(config, newCoordinator, configHandler))
 
-	v1.GET("/tenants", makeHandler(config, newCoordinator, tenantsGetHandler))
-	v1.POST("/tenants", makeHandler(config, newCoordinator, tenantsPostHandler))
+	v1.GET("/tenants", reader, makeHandler(config, newCoordinator, tenantsGetHandler))
+	v1.POST("/tenants", operator, makeHandler(config, newCoordinator, tenantsPostHandler))
 
-	v1.GET("/migrations/source", makeHandler(config, newCoordinator, migrationsSourceHandler))
-	v1.GET("/migrations/applied", makeHandler(config, newCoordinator, migrationsAppliedHandler))
-	v1.POST("/migrations", makeHandler(config, newCoordinator, migrationsPostHandler))
+	v1.GET("/migrations/source", reader, makeHandler(config, newCoordinator, migrationsSourceHandler))
+	v1.GET("/migrations/applied", reader, makeHandler(config, newCoordinator, migrationsAppliedHandler))
+	v1.POST("/migrations", operator, makeHandler(config, newCoordinator, migrationsPostHandler))
 
+	// GraphQL mutations require operator role, see data.RootResolver
 	v2 := r.Group(config.PathPrefix + "/v2")
-	v2.GET("/config", makeHandler(config, newCoordinator, configHandler))
-	v2.GET("/schema", makeHandler(config, newCoordinator, schemaHandler))
-	v2.POST("/service", makeHandler(config, newCoordinator, serviceHandler))
+	v2.GET("/config", operator, makeHandler(config, newCoordinator, configHandler))
+	v2.GET("/schema", reader, makeHandler(config, newCoordinator, schemaHandler))
+	v2.POST("/service", reader, makeHandler(config, newCoordinator, serviceHandler(jobs)))
 
 	return r
 }
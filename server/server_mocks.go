@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -10,12 +11,17 @@ import (
 
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
 type mockedCoordinator struct {
-	errorThreshold int
-	counter        int
+	errorThreshold    int
+	counter           int
+	locked            bool
+	verificationError bool
+	migrationFailed   bool
+	panicking         bool
 }
 
 func newMockedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
@@ -28,25 +34,59 @@ func newMockedErrorCoordinator(errorThreshold int) func(context.Context, *config
 	}
 }
 
+func newMockedLockedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{errorThreshold: -1, locked: true}
+}
+
+func newMockedVerificationErrorCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{errorThreshold: -1, verificationError: true}
+}
+
+func newMockedMigrationFailedCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{errorThreshold: -1, migrationFailed: true}
+}
+
+func newMockedPanicCoordinator(ctx context.Context, config *config.Config) coordinator.Coordinator {
+	return &mockedCoordinator{errorThreshold: -1, panicking: true}
+}
+
 func (m *mockedCoordinator) Dispose() {
 }
 
-func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) *types.CreateResults {
-	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}
+func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}, nil
+}
+
+// part of interface but not used in server tests - tested in data package
+func (m *mockedCoordinator) RevertVersion(int32, bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}, nil
+}
+
+// part of interface but not used in server tests - tested in data package
+func (m *mockedCoordinator) RepairChecksums([]string, string, string) (*types.RepairResults, error) {
+	return &types.RepairResults{Version: &types.Version{}, Repaired: []types.Migration{}}, nil
 }
 
-func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) *types.CreateResults {
-	return &types.CreateResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}
+func (m *mockedCoordinator) ImportHistory(types.HistoryTool, string, string, bool) (*types.ImportResults, error) {
+	return &types.ImportResults{Summary: &types.MigrationResults{}, Version: &types.Version{}}, nil
 }
 
-func (m *mockedCoordinator) GetSourceMigrations(_ *coordinator.SourceMigrationFilters) []types.Migration {
+func (m *mockedCoordinator) Plan() (*types.Plan, error) {
+	return &types.Plan{Migrations: []types.PlannedMigration{}}, nil
+}
+
+func (m *mockedCoordinator) GetSourceMigrations(_ *coordinator.SourceMigrationFilters) ([]types.Migration, error) {
 	if m.errorThreshold == m.counter {
-		panic(fmt.Sprintf("Mocked Error Disk Loader: threshold %v reached", m.errorThreshold))
+		return nil, fmt.Errorf("Mocked Error Disk Loader: threshold %v reached", m.errorThreshold)
 	}
 	m.counter++
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
 	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "source", File: "source/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
-	return []types.Migration{m1, m2}
+	return []types.Migration{m1, m2}, nil
 }
 
 func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migration, error) {
@@ -57,11 +97,11 @@ func (m *mockedCoordinator) GetSourceMigrationByFile(file string) (*types.Migrat
 	return &m1, nil
 }
 
-func (m *mockedCoordinator) GetAppliedMigrations() []types.MigrationDB {
+func (m *mockedCoordinator) GetAppliedMigrations() ([]types.MigrationDB, error) {
 	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "sha256"}
 	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
 	ms := []types.MigrationDB{{Migration: m1, Schema: "source", AppliedAt: graphql.Time{Time: d1}, Created: graphql.Time{Time: d1}}}
-	return ms
+	return ms, nil
 }
 
 // part of interface but not used in server tests - tested in data package
@@ -69,21 +109,25 @@ func (m *mockedCoordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, er
 	return nil, nil
 }
 
-func (m *mockedCoordinator) GetTenants() []types.Tenant {
+func (m *mockedCoordinator) GetTenants() ([]types.Tenant, error) {
+	if m.panicking {
+		// unexpected panics are not always strings
+		panic(fmt.Errorf("Mocked Error Coordinator: unexpected panic"))
+	}
 	a := types.Tenant{Name: "a"}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
-	return []types.Tenant{a, b, c}
+	return []types.Tenant{a, b, c}, nil
 }
 
 // part of interface but not used in server tests - tested in data package
-func (m *mockedCoordinator) GetVersions() []types.Version {
-	return []types.Version{}
+func (m *mockedCoordinator) GetVersions() ([]types.Version, error) {
+	return []types.Version{}, nil
 }
 
 // part of interface but not used in server tests - tested in data package
-func (m *mockedCoordinator) GetVersionsByFile(file string) []types.Version {
-	return []types.Version{}
+func (m *mockedCoordinator) GetVersionsByFile(file string) ([]types.Version, error) {
+	return []types.Version{}, nil
 }
 
 // part of interface but not used in server tests - tested in data package
@@ -91,19 +135,72 @@ func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
 	return nil, nil
 }
 
-func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
+func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() error {
 	if m.errorThreshold == m.counter {
 		m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "123"}
-		return false, []types.Migration{m1}
+		return &coordinator.ErrChecksumMismatch{Migrations: []types.Migration{m1}}
 	}
 	m.counter++
-	return true, nil
+	return nil
+}
+
+// part of interface but not used in server tests - tested in data package
+func (m *mockedCoordinator) VerifySourceMigrations() (*types.Verification, error) {
+	return &types.Verification{Verified: true, ModifiedMigrations: []types.Migration{}, OutOfOrderMigrations: []types.Migration{}, MissingMigrations: []types.Migration{}}, nil
 }
 
-func (m *mockedCoordinator) ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration) {
-	return &types.MigrationResults{}, m.GetSourceMigrations(nil)
+func (m *mockedCoordinator) ApplyMigrations(types.MigrationsModeType) (*types.MigrationResults, []types.Migration, error) {
+	if m.locked {
+		return nil, nil, db.ErrMigrationInProgress
+	}
+	if m.verificationError {
+		missing := types.Migration{Name: "201501010000.sql", SourceDir: "source", File: "source/201501010000.sql", MigrationType: types.MigrationTypeSingleMigration}
+		return nil, nil, &coordinator.VerificationError{OutOfOrderMigrations: []types.Migration{}, MissingMigrations: []types.Migration{missing}}
+	}
+	if m.migrationFailed {
+		return nil, nil, &db.ErrMigrationFailed{File: "source/201602220001.sql", Schema: "source", Code: "1064", Line: 3, Cause: errors.New("syntax error")}
+	}
+	sourceMigrations, _ := m.GetSourceMigrations(nil)
+	return &types.MigrationResults{}, sourceMigrations, nil
+}
+
+func (m *mockedCoordinator) AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration, error) {
+	if m.locked {
+		return nil, nil, db.ErrMigrationInProgress
+	}
+	sourceMigrations, _ := m.GetSourceMigrations(nil)
+	return &types.MigrationResults{}, sourceMigrations[1:], nil
+}
+
+type mockedChecker struct {
+	status types.HealthStatus
+}
+
+func (m *mockedChecker) Live() *types.Health {
+	return &types.Health{Status: types.HealthStatusUp}
+}
+
+func (m *mockedChecker) Ready(context.Context) *types.Health {
+	check := types.HealthCheck{Name: "database", Status: m.status, LatencyMs: 1.5}
+	return &types.Health{Status: m.status, Checks: []types.HealthCheck{check}}
+}
+
+// mockedJobStore does not persist jobs, jobs are read from memory of jobs.Manager
+type mockedJobStore struct {
+}
+
+func (m *mockedJobStore) CreateJob(job *types.Job) error {
+	return nil
+}
+
+func (m *mockedJobStore) UpdateJob(job *types.Job) error {
+	return nil
+}
+
+func (m *mockedJobStore) GetJob(ID string) (*types.Job, error) {
+	return nil, nil
 }
 
-func (m *mockedCoordinator) AddTenantAndApplyMigrations(types.MigrationsModeType, string) (*types.MigrationResults, []types.Migration) {
-	return &types.MigrationResults{}, m.GetSourceMigrations(nil)[1:]
+func (m *mockedJobStore) DeleteJobs(finishedBefore time.Time) error {
+	return nil
 }
@@ -3,16 +3,23 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lukaszbudnik/migrator/auth"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/data"
+	"github.com/lukaszbudnik/migrator/db"
+	"github.com/lukaszbudnik/migrator/jobs"
 	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,7 +42,7 @@ func newTestRequestV2(method, url string, body io.Reader) (*http.Request, error)
 func testSetupRouter(config *config.Config, newCoordinator func(ctx context.Context, config *config.Config) coordinator.Coordinator) *gin.Engine {
 	versionInfo := &types.VersionInfo{Release: "GitBranch", CommitSha: "GitCommitSha", CommitDate: "2020-01-08T09:56:41+01:00", APIVersions: []string{"v1"}}
 	gin.SetMode(gin.ReleaseMode)
-	return SetupRouter(versionInfo, config, newCoordinator)
+	return SetupRouter(versionInfo, config, newCoordinator, &mockedChecker{types.HealthStatusUp}, jobs.New(config, newCoordinator, &mockedJobStore{}))
 }
 
 func TestGetDefaultPort(t *testing.T) {
@@ -106,6 +113,20 @@ func TestConfigRoute(t *testing.T) {
 	assert.Equal(t, config.String(), strings.TrimSpace(w.Body.String()))
 }
 
+func TestConfigRouteRawWithoutAuth(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV2("GET", "/config?raw=true", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, `{"error":"Raw config is available only when authentication is configured"}`, strings.TrimSpace(w.Body.String()))
+}
+
 // section /migrations/source
 
 func TestDiskMigrationsRoute(t *testing.T) {
@@ -407,3 +428,254 @@ func TestGraphQLQueryError(t *testing.T) {
 	assert.Equal(t, "application/json; charset=utf-8", w.HeaderMap["Content-Type"][0])
 	assert.Equal(t, `{"error":"Invalid request, please see documentation for valid JSON payload"}`, strings.TrimSpace(w.Body.String()))
 }
+
+func TestGraphQLCreateVersionAsync(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedCoordinator)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV2("POST", "/service", strings.NewReader(`
+    {
+      "query": "mutation CreateVersion($input: VersionInput!) { createVersion(input: $input) { job { id } } }",
+      "operationName": "CreateVersion",
+      "variables": { "input": { "versionName": "commit-sha", "async": true } }
+    }
+  `))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Data struct {
+			CreateVersion struct {
+				Job struct {
+					ID string
+				}
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	jobID := response.Data.CreateVersion.Job.ID
+	assert.NotEmpty(t, jobID)
+
+	// jobs are shared by all requests
+	query := fmt.Sprintf(`{"query": "query Job($id: String!) { job(id: $id) { state } }", "operationName": "Job", "variables": { "id": "%v" }}`, jobID)
+	for i := 0; i < 100 && !strings.Contains(w.Body.String(), "Succeeded"); i++ {
+		time.Sleep(10 * time.Millisecond)
+		w = httptest.NewRecorder()
+		req, _ = newTestRequestV2("POST", "/service", strings.NewReader(query))
+		router.ServeHTTP(w, req)
+	}
+
+	assert.Equal(t, `{"data":{"job":{"state":"Succeeded"}}}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestMigrationsPostRouteMigrationInProgress(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedLockedCoordinator)
+
+	json := []byte(`{"mode": "apply", "response": "full"}`)
+	req, _ := newTestRequestV1(http.MethodPost, "/migrations", bytes.NewBuffer(json))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.HeaderMap["Content-Type"][0])
+	assert.Equal(t, `{"error":"Another migration is in progress, please try again later"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestMigrationsPostRouteVerificationError(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedVerificationErrorCoordinator)
+
+	json := []byte(`{"mode": "apply", "response": "full"}`)
+	req, _ := newTestRequestV1(http.MethodPost, "/migrations", bytes.NewBuffer(json))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFailedDependency, w.Code)
+	assert.Equal(t, `{"error":"Verification failed, out-of-order migrations: [], migrations missing from source: [source/201501010000.sql]"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestMigrationsPostRouteMigrationFailed(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedMigrationFailedCoordinator)
+
+	json := []byte(`{"mode": "apply", "response": "full"}`)
+	req, _ := newTestRequestV1(http.MethodPost, "/migrations", bytes.NewBuffer(json))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, `{"error":"SQL migration source/201602220001.sql failed with error: syntax error","details":{"dbErrorCode":"1064","file":"source/201602220001.sql","line":3,"schema":"source","statementIndex":0,"statementPosition":0}}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestRoutePanicRecovered(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedPanicCoordinator)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV1("GET", "/tenants", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `{"error":"Mocked Error Coordinator: unexpected panic"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestErrorStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusConflict, errorStatusCode(db.ErrMigrationInProgress))
+	assert.Equal(t, http.StatusFailedDependency, errorStatusCode(&coordinator.ErrChecksumMismatch{}))
+	assert.Equal(t, http.StatusFailedDependency, errorStatusCode(&coordinator.VerificationError{}))
+	assert.Equal(t, http.StatusUnprocessableEntity, errorStatusCode(&db.ErrMigrationFailed{}))
+	assert.Equal(t, http.StatusNotFound, errorStatusCode(&db.ErrNotFound{}))
+	assert.Equal(t, http.StatusInternalServerError, errorStatusCode(errors.New("trouble maker")))
+}
+
+func TestTenantsPostRouteMigrationInProgress(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedLockedCoordinator)
+
+	json := []byte(`{"name": "new_tenant", "response": "full", "mode":"dry-run"}`)
+	req, _ := newTestRequestV1(http.MethodPost, "/tenants", bytes.NewBuffer(json))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `{"error":"Another migration is in progress, please try again later"}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestAuth(t *testing.T) {
+	cfg, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+	cfg.Auth = &config.Auth{Tokens: []config.Token{{Name: "reader", Token: "reader-token", Role: auth.RoleReader}, {Name: "operator", Token: "operator-token", Role: auth.RoleOperator}, {Name: "admin", Token: "admin-token", Role: auth.RoleAdmin}}}
+
+	router := testSetupRouter(cfg, newMockedCoordinator)
+
+	request := func(method, url, token string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, body)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// version info is public
+	assert.Equal(t, http.StatusOK, request("GET", "/", "", nil).Code)
+
+	w := request("GET", "/v1/tenants", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="migrator"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/tenants", "abc", nil).Code)
+
+	assert.Equal(t, http.StatusOK, request("GET", "/v1/tenants", "reader-token", nil).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/v2/schema", "reader-token", nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/v1/config", "reader-token", nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/v2/config", "reader-token", nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/v1/migrations", "reader-token", strings.NewReader(`{"mode": "apply", "response": "full"}`)).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/v2/config", "operator-token", nil).Code)
+
+	// raw config is available only to admins
+	assert.Equal(t, http.StatusForbidden, request("GET", "/v2/config?raw=true", "operator-token", nil).Code)
+	w = request("GET", "/v2/config?raw=true", "admin-token", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "token: operator-token")
+	w = request("GET", "/v2/config", "admin-token", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "operator-token")
+
+	// queries are allowed for readers, mutations require operator role
+	query := `{"query": "query { tenants { name } }"}`
+	w = request("POST", "/v2/service", "reader-token", strings.NewReader(query))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "errors")
+
+	mutation := `{"query": "mutation { createVersion(input: {versionName: \"commit-sha\"}) { version { id } } }"}`
+	w = request("POST", "/v2/service", "reader-token", strings.NewReader(mutation))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"message":"Forbidden"`)
+
+	w = request("POST", "/v2/service", "operator-token", strings.NewReader(mutation))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "errors")
+}
+
+func TestMetricsRoute(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedCoordinator)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV2("POST", "/service", strings.NewReader(`{"query": "query Random123 { tenants { name } }"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// invalid queries are recorded as other
+	w = httptest.NewRecorder()
+	req, _ = newTestRequestV2("POST", "/service", strings.NewReader(`{"query": "query Random456 { abc }", "operationName": "Random456"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	// root fields are used as labels, client-provided operation names are ignored
+	assert.Contains(t, w.Body.String(), `migrator_graphql_operation_duration_seconds_count{operation="tenants"}`)
+	assert.Contains(t, w.Body.String(), `migrator_graphql_operation_duration_seconds_count{operation="other"}`)
+	assert.NotContains(t, w.Body.String(), "Random")
+	assert.Contains(t, w.Body.String(), `migrator_http_request_duration_seconds_count{code="200",method="POST",route="/v2/service"}`)
+}
+
+func TestHealthRoutes(t *testing.T) {
+	cfg, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+	// health endpoints are not protected
+	cfg.Auth = &config.Auth{Tokens: []config.Token{{Name: "reader", Token: "reader-token", Role: auth.RoleReader}}}
+
+	router := testSetupRouter(cfg, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/health/live", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"status":"UP"}`, strings.TrimSpace(w.Body.String()))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/health/ready", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"status":"UP","checks":[{"name":"database","status":"UP","latencyMs":1.5}]}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestHealthReadyDown(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	versionInfo := &types.VersionInfo{Release: "GitBranch", CommitSha: "GitCommitSha", CommitDate: "2020-01-08T09:56:41+01:00", APIVersions: []string{"v1"}}
+	router := SetupRouter(versionInfo, config, nil, &mockedChecker{types.HealthStatusDown}, jobs.New(config, nil, &mockedJobStore{}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/health/ready", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"status":"DOWN","checks":[{"name":"database","status":"DOWN","latencyMs":1.5}]}`, strings.TrimSpace(w.Body.String()))
+}
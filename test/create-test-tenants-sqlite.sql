@@ -0,0 +1,9 @@
+create table migrator_tenants (
+  id integer primary key autoincrement,
+  name varchar(200) not null,
+  created timestamp default current_timestamp
+);
+
+insert into migrator_tenants (name) values ('abc');
+insert into migrator_tenants (name) values ('def');
+insert into migrator_tenants (name) values ('xyz');
@@ -22,6 +22,9 @@ case $CONTAINER_TYPE in
   mssql )
     mssql_start $CONTAINER_TYPE
     ;;
+  sqlite )
+    sqlite_start
+    ;;
   * )
     >&2 echo "Unknown container type $CONTAINER_TYPE"
     exit 1
@@ -2,6 +2,10 @@
 
 function destroy_container() {
   name=$1
+  if [[ "sqlite" == "$name" ]]; then
+    rm -f /tmp/migrator_test.db
+    return
+  fi
   docker stop "migrator-$name"
   docker rm "migrator-$name"
 }
@@ -0,0 +1,12 @@
+#!/bin/bash
+
+# SQLite is an in-process database, there is no container to start
+# the function only creates test database file and migrator.yaml
+function sqlite_start() {
+  database=/tmp/migrator_test.db
+
+  rm -f $database
+  sqlite3 $database < ../create-test-tenants-sqlite.sql
+
+  cp ../migrator-sqlite.yaml ../migrator.yaml
+}
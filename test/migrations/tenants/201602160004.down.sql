@@ -0,0 +1 @@
+alter table {schema}.users drop column id_role;
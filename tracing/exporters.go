@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const otlpExportTimeout = 10 * time.Second
+
+// OTLP status codes
+const (
+	otlpStatusCodeUnset = 0
+	otlpStatusCodeError = 2
+)
+
+// otlpRequest is OTLP/HTTP JSON encoded ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue has exactly one of its fields set, 64-bit integers are encoded as strings
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// newOTLPRequest converts spans to OTLP request, all spans share the same resource and instrumentation scope
+func newOTLPRequest(serviceName string, spans []*Span) *otlpRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mutex.Lock()
+		span := otlpSpan{
+			TraceID:           s.spanContext.TraceIDString(),
+			SpanID:            s.spanContext.SpanIDString(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+			Status:            otlpStatus{Code: otlpStatusCodeUnset},
+		}
+		if s.parentSpanID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentSpanID[:])
+		}
+		if s.errorMessage != "" {
+			span.Status = otlpStatus{Code: otlpStatusCodeError, Message: s.errorMessage}
+		}
+		s.mutex.Unlock()
+		otlpSpans = append(otlpSpans, span)
+	}
+
+	resource := otlpResource{Attributes: otlpAttributes([]Attribute{{"service.name", serviceName}})}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{Resource: resource, ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: defaultServiceName}, Spans: otlpSpans}}}}}
+}
+
+func otlpAttributes(attributes []Attribute) []otlpAttribute {
+	converted := make([]otlpAttribute, 0, len(attributes))
+	for _, a := range attributes {
+		converted = append(converted, otlpAttribute{Key: a.Key, Value: otlpValue(a.Value)})
+	}
+	return converted
+}
+
+func otlpValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	case float32:
+		f := float64(v)
+		return otlpAnyValue{DoubleValue: &f}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		i := fmt.Sprintf("%d", v)
+		return otlpAnyValue{IntValue: &i}
+	}
+	s := fmt.Sprintf("%v", value)
+	return otlpAnyValue{StringValue: &s}
+}
+
+// otlpExporter sends spans to OpenTelemetry collector using OTLP/HTTP protocol with JSON encoding
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// newOTLPExporter returns OTLP exporter, headers are in the same "Name: value" format as webHookHeaders
+func newOTLPExporter(endpoint string, headers []string) *otlpExporter {
+	parsed := map[string]string{}
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) == 2 {
+			parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return &otlpExporter{endpoint: endpoint, headers: parsed, client: &http.Client{Timeout: otlpExportTimeout}}
+}
+
+func (e *otlpExporter) export(serviceName string, spans []*Span) error {
+	body, err := json.Marshal(newOTLPRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP endpoint %v returned status: %v", e.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// stdoutExporter writes every batch of spans as OTLP JSON in a single line
+type stdoutExporter struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+func newStdoutExporter() *stdoutExporter {
+	return &stdoutExporter{out: os.Stdout}
+}
+
+func (e *stdoutExporter) export(serviceName string, spans []*Span) error {
+	body, err := json.Marshal(newOTLPRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.out.Write(append(body, '\n'))
+	return err
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSpans() []*Span {
+	start := time.Unix(1600000000, 0)
+	parent := &Span{name: "POST /v2/service", kind: SpanKindServer, start: start, end: start.Add(time.Second)}
+	parent.spanContext = SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}, Sampled: true}
+	child := &Span{name: "db.ApplyMigration", kind: SpanKindInternal, start: start, end: start.Add(time.Millisecond), parentSpanID: [8]byte{2}, errorMessage: "syntax error"}
+	child.spanContext = SpanContext{TraceID: [16]byte{1}, SpanID: [8]byte{3}, Sampled: true}
+	child.attributes = []Attribute{{"file", "source/001.sql"}, {"migrationType", uint32(1)}, {"cached", false}, {"ratio", 0.5}, {"duration", time.Second}}
+	return []*Span{parent, child}
+}
+
+func TestNewOTLPRequest(t *testing.T) {
+	body, err := json.Marshal(newOTLPRequest("migrator", newTestSpans()))
+	assert.Nil(t, err)
+
+	expected := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"migrator"}}]},"scopeSpans":[{"scope":{"name":"migrator"},"spans":[` +
+		`{"traceId":"01000000000000000000000000000000","spanId":"0200000000000000","name":"POST /v2/service","kind":2,"startTimeUnixNano":"1600000000000000000","endTimeUnixNano":"1600000001000000000","status":{"code":0}},` +
+		`{"traceId":"01000000000000000000000000000000","spanId":"0300000000000000","parentSpanId":"0200000000000000","name":"db.ApplyMigration","kind":1,"startTimeUnixNano":"1600000000000000000","endTimeUnixNano":"1600000000001000000",` +
+		`"attributes":[{"key":"file","value":{"stringValue":"source/001.sql"}},{"key":"migrationType","value":{"intValue":"1"}},{"key":"cached","value":{"boolValue":false}},{"key":"ratio","value":{"doubleValue":0.5}},{"key":"duration","value":{"stringValue":"1s"}}],` +
+		`"status":{"code":2,"message":"syntax error"}}]}]}]}`
+	assert.Equal(t, expected, string(body))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	exporter := newOTLPExporter(server.URL, []string{"Authorization: Bearer abc", "invalid"})
+	err := exporter.export("migrator", newTestSpans())
+	assert.Nil(t, err)
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "Bearer abc", headers.Get("Authorization"))
+
+	var request otlpRequest
+	assert.Nil(t, json.Unmarshal(body, &request))
+	assert.Len(t, request.ResourceSpans[0].ScopeSpans[0].Spans, 2)
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	exporter := newOTLPExporter(server.URL, nil)
+	err := exporter.export("migrator", newTestSpans())
+	assert.Equal(t, "OTLP endpoint "+server.URL+" returned status: 400 Bad Request", err.Error())
+}
+
+func TestStdoutExporter(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := &stdoutExporter{out: &buf}
+	setTracer(newTracer("migrator", exporter))
+
+	_, span := StartSpan(context.TODO(), "cli apply")
+	span.End()
+	Shutdown()
+
+	var request otlpRequest
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &request))
+	assert.Equal(t, "cli apply", request.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+	assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+}
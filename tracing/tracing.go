@@ -0,0 +1,346 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+// TraceparentHeader is the W3C Trace Context header used for propagating traces
+const TraceparentHeader = "traceparent"
+
+// span kinds, values are the same as in OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+)
+
+// exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const (
+	defaultServiceName  = "migrator"
+	defaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+	// ended spans are buffered and exported in batches, spans are dropped when buffer is full
+	spansBufferSize = 2048
+	maxBatchSize    = 512
+	batchTimeout    = 5 * time.Second
+)
+
+// traceparent version 00 is traceparent-version "-" trace-id "-" parent-id "-" trace-flags
+// future versions can append more fields
+var traceparentRegexp = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+
+// SpanKind is the kind of span, server spans are created for incoming HTTP requests
+type SpanKind int
+
+// Attribute is a span attribute
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanContext identifies span and is propagated to child spans and in traceparent header
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid returns true when both trace ID and span ID are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns hex encoded trace ID
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString returns hex encoded span ID
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent returns span context encoded as W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%v-%v-%v", sc.TraceIDString(), sc.SpanIDString(), flags)
+}
+
+// ParseTraceparent parses W3C traceparent header value, returns false when value is invalid
+func ParseTraceparent(traceparent string) (SpanContext, bool) {
+	match := traceparentRegexp.FindStringSubmatch(traceparent)
+	if match == nil || match[1] == "ff" || (match[1] == "00" && match[5] != "") {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(match[2]))
+	hex.Decode(sc.SpanID[:], []byte(match[3]))
+	flags, _ := hex.DecodeString(match[4])
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// spanContextKey is used together with context for setting/getting current span context
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns context with span context, spans started using it become its children
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns current span context, returned span context is invalid when there is no span in context
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Span represents a single operation, all methods can be called on nil span
+// which is returned when tracing is disabled or trace is not sampled
+type Span struct {
+	mutex        sync.Mutex
+	tracer       *tracer
+	name         string
+	kind         SpanKind
+	spanContext  SpanContext
+	parentSpanID [8]byte
+	start        time.Time
+	end          time.Time
+	attributes   []Attribute
+	errorMessage string
+	ended        bool
+}
+
+// SpanContext returns span context, returns invalid span context for nil span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.spanContext
+}
+
+// SetAttributes adds attributes to span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// SetError marks span as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errorMessage = message
+}
+
+// End ends span and queues it for export, subsequent calls are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+	s.tracer.queue(s)
+}
+
+// StartSpan starts a new internal span which is a child of span stored in context
+func StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return startSpan(ctx, name, SpanKindInternal, SpanContextFromContext(ctx), attributes)
+}
+
+// StartServerSpan starts a new server span for incoming request, span is a child of span passed in traceparent header
+// when traceparent is empty or invalid a new trace is started
+func StartServerSpan(ctx context.Context, name, traceparent string, attributes ...Attribute) (context.Context, *Span) {
+	parent, _ := ParseTraceparent(traceparent)
+	return startSpan(ctx, name, SpanKindServer, parent, attributes)
+}
+
+func startSpan(ctx context.Context, name string, kind SpanKind, parent SpanContext, attributes []Attribute) (context.Context, *Span) {
+	t := currentTracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	ctx = ContextWithSpanContext(ctx, sc)
+
+	// not sampled span context is still propagated so that the whole trace is not sampled
+	if !sc.Sampled {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: kind, spanContext: sc, start: time.Now(), attributes: attributes}
+	if parent.IsValid() {
+		span.parentSpanID = parent.SpanID
+	}
+	return ctx, span
+}
+
+// exporter exports batch of ended spans
+type exporter interface {
+	export(serviceName string, spans []*Span) error
+}
+
+// tracer buffers ended spans and exports them in batches in a background goroutine
+type tracer struct {
+	mutex       sync.RWMutex
+	closed      bool
+	serviceName string
+	exporter    exporter
+	spans       chan *Span
+	done        chan struct{}
+}
+
+var (
+	tracerMutex sync.RWMutex
+	std         *tracer
+)
+
+func currentTracer() *tracer {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return std
+}
+
+// Configure enables tracing using exporter set in config, tracing is disabled when config is nil
+// previously configured tracer is shut down
+func Configure(config *config.Tracing) error {
+	if config == nil {
+		setTracer(nil)
+		return nil
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	switch config.Exporter {
+	case ExporterOTLP:
+		endpoint := config.Endpoint
+		if endpoint == "" {
+			endpoint = defaultOTLPEndpoint
+		}
+		setTracer(newTracer(serviceName, newOTLPExporter(endpoint, config.Headers)))
+	case ExporterStdout:
+		setTracer(newTracer(serviceName, newStdoutExporter()))
+	default:
+		return fmt.Errorf("Unknown tracing exporter: %v", config.Exporter)
+	}
+	return nil
+}
+
+// Shutdown exports all buffered spans and disables tracing
+func Shutdown() {
+	setTracer(nil)
+}
+
+func setTracer(t *tracer) {
+	tracerMutex.Lock()
+	previous := std
+	std = t
+	tracerMutex.Unlock()
+	if previous != nil {
+		previous.shutdown()
+	}
+}
+
+func newTracer(serviceName string, exporter exporter) *tracer {
+	t := &tracer{serviceName: serviceName, exporter: exporter, spans: make(chan *Span, spansBufferSize), done: make(chan struct{})}
+	go t.run()
+	return t
+}
+
+func (t *tracer) queue(s *Span) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	// spans ended after tracer was shut down are dropped
+	if t.closed {
+		return
+	}
+	select {
+	case t.spans <- s:
+	default:
+		common.Log(common.LevelWarn, "Tracing buffer is full, dropping span: %v", s.name)
+	}
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(batchTimeout)
+	defer ticker.Stop()
+
+	batch := []*Span{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.export(t.serviceName, batch); err != nil {
+			common.Log(common.LevelError, "Error exporting spans: %v", err)
+		}
+		batch = []*Span{}
+	}
+
+	for {
+		select {
+		case s, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (t *tracer) shutdown() {
+	t.mutex.Lock()
+	t.closed = true
+	close(t.spans)
+	t.mutex.Unlock()
+	<-t.done
+}
@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) export(serviceName string, spans []*Span) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// record enables tracing with recording exporter, spans are exported when returned func is called
+func record() (*recordingExporter, func()) {
+	exporter := &recordingExporter{}
+	setTracer(newTracer("test", exporter))
+	return exporter, Shutdown
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanIDString())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	sc, ok = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sc.Sampled)
+
+	// future versions can have more fields
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-abc",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		_, ok := ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestStartSpanDisabled(t *testing.T) {
+	Shutdown()
+
+	ctx, span := StartSpan(context.TODO(), "disabled")
+	assert.Nil(t, span)
+	assert.False(t, SpanContextFromContext(ctx).IsValid())
+
+	// all methods can be called on nil span
+	span.SetAttributes(Attribute{"key", "value"})
+	span.SetError("error")
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+}
+
+func TestStartSpanHierarchy(t *testing.T) {
+	exporter, flush := record()
+
+	ctx, server := StartServerSpan(context.TODO(), "POST /v2/service", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Attribute{"http.method", "POST"})
+	_, child := StartSpan(ctx, "db.GetTenants")
+	child.SetError("connection refused")
+	child.End()
+	server.SetAttributes(Attribute{"http.status_code", 500})
+	server.End()
+	// subsequent calls are ignored
+	server.End()
+	flush()
+
+	assert.Len(t, exporter.spans, 2)
+	assert.Equal(t, "db.GetTenants", exporter.spans[0].name)
+	assert.Equal(t, SpanKindInternal, exporter.spans[0].kind)
+	assert.Equal(t, "connection refused", exporter.spans[0].errorMessage)
+	assert.Equal(t, server.SpanContext().SpanID, exporter.spans[0].parentSpanID)
+	assert.Equal(t, server.SpanContext().TraceID, exporter.spans[0].spanContext.TraceID)
+
+	assert.Equal(t, "POST /v2/service", exporter.spans[1].name)
+	assert.Equal(t, SpanKindServer, exporter.spans[1].kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", exporter.spans[1].spanContext.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", hexSpanID(exporter.spans[1].parentSpanID))
+	assert.Equal(t, []Attribute{{"http.method", "POST"}, {"http.status_code", 500}}, exporter.spans[1].attributes)
+}
+
+func TestStartServerSpanNewTrace(t *testing.T) {
+	exporter, flush := record()
+
+	ctx, span := StartServerSpan(context.TODO(), "GET /", "invalid")
+	assert.Equal(t, span.SpanContext(), SpanContextFromContext(ctx))
+	assert.True(t, span.SpanContext().Sampled)
+	span.End()
+	flush()
+
+	assert.Len(t, exporter.spans, 1)
+	assert.Equal(t, [8]byte{}, exporter.spans[0].parentSpanID)
+}
+
+func TestStartSpanNotSampled(t *testing.T) {
+	exporter, flush := record()
+
+	ctx, span := StartServerSpan(context.TODO(), "GET /", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.Nil(t, span)
+	// not sampled span context is propagated
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", SpanContextFromContext(ctx).TraceIDString())
+
+	_, child := StartSpan(ctx, "child")
+	assert.Nil(t, child)
+	flush()
+
+	assert.Len(t, exporter.spans, 0)
+}
+
+func TestSpanEndedAfterShutdown(t *testing.T) {
+	exporter, flush := record()
+
+	_, span := StartSpan(context.TODO(), "late")
+	flush()
+	span.End()
+
+	assert.Len(t, exporter.spans, 0)
+}
+
+func TestConfigure(t *testing.T) {
+	defer Shutdown()
+
+	assert.Nil(t, Configure(&config.Tracing{Exporter: ExporterOTLP}))
+	assert.Equal(t, defaultServiceName, currentTracer().serviceName)
+	assert.Equal(t, defaultOTLPEndpoint, currentTracer().exporter.(*otlpExporter).endpoint)
+
+	assert.Nil(t, Configure(&config.Tracing{Exporter: ExporterStdout, ServiceName: "migrator-eu"}))
+	assert.Equal(t, "migrator-eu", currentTracer().serviceName)
+
+	assert.Nil(t, Configure(nil))
+	assert.Nil(t, currentTracer())
+
+	assert.Equal(t, "Unknown tracing exporter: jaeger", Configure(&config.Tracing{Exporter: "jaeger"}).Error())
+}
+
+func hexSpanID(ID [8]byte) string {
+	return SpanContext{SpanID: ID}.SpanIDString()
+}
@@ -115,9 +115,26 @@ type Version struct {
 	ID           int32         `json:"id"`
 	Name         string        `json:"name"`
 	Created      graphql.Time  `json:"created"`
+	CommitSha    string        `json:"commitSha,omitempty"`
 	DBMigrations []DBMigration `json:"dbMigrations"`
+	// SucceededTenants and FailedTenants are set only when per-tenant or per-migration transaction strategy was used
+	SucceededTenants []string       `json:"succeededTenants,omitempty"`
+	FailedTenants    []FailedTenant `json:"failedTenants,omitempty"`
+	State            VersionState   `json:"state"`
 }
 
+// VersionState tells whether all migrations of a version were applied
+type VersionState string
+
+const (
+	// VersionStateSucceeded is a state of version applied to all schemas
+	VersionStateSucceeded VersionState = "Succeeded"
+	// VersionStatePartial is a state of version which failed for some of the tenants
+	VersionStatePartial VersionState = "Partial"
+	// VersionStateFailed is a state of version which failed for all tenants or whose single migration failed
+	VersionStateFailed VersionState = "Failed"
+)
+
 // Migration contains basic information about migration
 type Migration struct {
 	Name          string        `json:"name"`
@@ -126,6 +143,39 @@ type Migration struct {
 	MigrationType MigrationType `json:"migrationType"`
 	Contents      string        `json:"contents,omitempty"`
 	CheckSum      string        `json:"checkSum"`
+	// DownContents contains optional down (rollback) script
+	// loaded from a paired file, for example 001_add_users.down.sql for 001_add_users.sql
+	DownContents string `json:"downContents,omitempty"`
+}
+
+// PlannedSchema contains SQL, with schema placeholder substituted, which will be executed in a given schema
+type PlannedSchema struct {
+	Schema string `json:"schema"`
+	SQL    string `json:"sql"`
+}
+
+// PlannedMigration embeds pending Migration and adds all schemas it will be applied to
+type PlannedMigration struct {
+	Migration
+	Schemas []PlannedSchema `json:"schemas"`
+}
+
+// Plan contains pending migrations which would be applied by creating a new version
+type Plan struct {
+	Tenants    int32              `json:"tenants"`
+	Migrations []PlannedMigration `json:"migrations"`
+}
+
+// Verification contains results of verification of source migrations against applied DB migrations
+type Verification struct {
+	// Verified is false when checksums do not match or, with fail verification policy, when out-of-order or missing migrations are found
+	Verified bool `json:"verified"`
+	// applied migrations which source was modified
+	ModifiedMigrations []Migration `json:"modifiedMigrations"`
+	// pending migrations which are ordered before already applied migrations
+	OutOfOrderMigrations []Migration `json:"outOfOrderMigrations"`
+	// applied migrations which source does not exist anymore
+	MissingMigrations []Migration `json:"missingMigrations"`
 }
 
 // DBMigration embeds Migration and adds DB-specific fields
@@ -168,12 +218,59 @@ type MigrationResults struct {
 	TenantScripts         int32        `json:"tenantScripts"`
 	TenantScriptsTotal    int32        `json:"tenantScriptsTotal"` // tenant scripts for all tenants
 	ScriptsGrandTotal     int32        `json:"scriptsGrandTotal"`  // total number of all scripts applied
+	// SucceededTenants and FailedTenants are set only when per-tenant or per-migration transaction strategy is used
+	SucceededTenants []string       `json:"succeededTenants,omitempty"`
+	FailedTenants    []FailedTenant `json:"failedTenants,omitempty"`
+}
+
+// FailedTenant contains information about tenant for which applying migrations failed
+// DBErrorCode, Line and StatementPosition are set only when DB driver reports them
+type FailedTenant struct {
+	Name              string `json:"name"`
+	File              string `json:"file"`
+	Error             string `json:"error"`
+	StatementIndex    int32  `json:"statementIndex"`
+	DBErrorCode       string `json:"dbErrorCode,omitempty"`
+	Line              int32  `json:"line,omitempty"`
+	StatementPosition int32  `json:"statementPosition,omitempty"`
 }
 
 // CreateResults contains results of CreateVersion or CreateTenant
+// when operation is executed asynchronously only Job is set
 type CreateResults struct {
 	Summary *Summary
 	Version *Version
+	Job     *Job
+}
+
+// JobState stores state of asynchronous job
+type JobState string
+
+const (
+	// JobStateQueued is a state of job waiting for other jobs to finish
+	JobStateQueued JobState = "Queued"
+	// JobStateRunning is a state of job which is being executed
+	JobStateRunning JobState = "Running"
+	// JobStateSucceeded is a state of job which finished successfully
+	JobStateSucceeded JobState = "Succeeded"
+	// JobStateFailed is a state of job which finished with an error
+	JobStateFailed JobState = "Failed"
+)
+
+// Job contains information about asynchronous createVersion or createTenant operation
+type Job struct {
+	ID         string         `json:"id"`
+	Operation  string         `json:"operation"`
+	State      JobState       `json:"state"`
+	CreatedAt  graphql.Time   `json:"createdAt"`
+	StartedAt  *graphql.Time  `json:"startedAt,omitempty"`
+	FinishedAt *graphql.Time  `json:"finishedAt,omitempty"`
+	Progress   *Summary       `json:"progress,omitempty"` // migrations applied so far
+	Results    *CreateResults `json:"results,omitempty"`
+	Error      *string        `json:"error,omitempty"`
+	Replica    string         `json:"replica"` // host name of migrator instance which executes the job
+	// refreshed periodically until job finishes
+	UpdatedAt graphql.Time `json:"updatedAt"`
 }
 
 // Action stores information about migrator action
@@ -224,6 +321,7 @@ type VersionInput struct {
 	VersionName string
 	Action      Action
 	DryRun      bool
+	Async       bool
 }
 
 type TenantInput struct {
@@ -231,6 +329,62 @@ type TenantInput struct {
 	Action      Action
 	DryRun      bool
 	TenantName  string
+	Async       bool
+}
+
+// HistoryTool is a legacy migration tool whose history table can be imported
+type HistoryTool string
+
+const (
+	// HistoryToolFlyway imports Flyway flyway_schema_history table
+	HistoryToolFlyway HistoryTool = "Flyway"
+	// HistoryToolLiquibase imports Liquibase DATABASECHANGELOG table
+	HistoryToolLiquibase HistoryTool = "Liquibase"
+)
+
+// ImportInput contains parameters of history import, empty table and version name fall back to tool defaults
+type ImportInput struct {
+	Tool        HistoryTool
+	Table       *string
+	VersionName *string
+	DryRun      bool
+}
+
+// HistoryEntry is an entry read from Flyway or Liquibase history table
+type HistoryEntry struct {
+	// Flyway version or Liquibase changeset ID
+	Version string `json:"version"`
+	// Flyway description or Liquibase changeset author
+	Description string `json:"description"`
+	// Flyway script or Liquibase changelog file name
+	Script   string `json:"script"`
+	CheckSum string `json:"checkSum"`
+	// Flyway migration type or Liquibase exec type
+	Type    string `json:"type"`
+	Success bool   `json:"success"`
+}
+
+// UnmatchedHistoryEntry is a history entry which could not be mapped to a source migration or which needs attention
+type UnmatchedHistoryEntry struct {
+	HistoryEntry
+	Reason string `json:"reason"`
+}
+
+// ImportResults contains results of history import
+type ImportResults struct {
+	Summary   *Summary                `json:"summary"`
+	Version   *Version                `json:"version,omitempty"`
+	Imported  []Migration             `json:"imported"`
+	Unmatched []UnmatchedHistoryEntry `json:"unmatched"`
+	// Warnings are imported entries which need attention, for example Liquibase checksum mismatches
+	Warnings []UnmatchedHistoryEntry `json:"warnings"`
+}
+
+// RepairResults contains results of checksum repair
+type RepairResults struct {
+	// Version records who repaired checksums and why
+	Version  *Version    `json:"version"`
+	Repaired []Migration `json:"repaired"`
 }
 
 // VersionInfo contains build information and supported API versions
@@ -240,3 +394,27 @@ type VersionInfo struct {
 	CommitDate  string   `json:"commitDate"`
 	APIVersions []string `json:"apiVersions"`
 }
+
+// HealthStatus stores status of migrator or of a single health check
+type HealthStatus string
+
+const (
+	// HealthStatusUp means that migrator or checked dependency is healthy
+	HealthStatusUp HealthStatus = "UP"
+	// HealthStatusDown means that migrator or checked dependency is not healthy
+	HealthStatusDown HealthStatus = "DOWN"
+)
+
+// HealthCheck contains status and latency of a single dependency check
+// errors are not returned as health endpoints are not authenticated, they are logged instead
+type HealthCheck struct {
+	Name      string       `json:"name"`
+	Status    HealthStatus `json:"status"`
+	LatencyMs float64      `json:"latencyMs"`
+}
+
+// Health contains overall status together with all executed checks, overall status is DOWN if any of checks is DOWN
+type Health struct {
+	Status HealthStatus  `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
@@ -1,6 +1,6 @@
 #!/bin/bash
 
-dbs="postgres mysql mariadb percona mssql"
+dbs="sqlite postgres mysql mariadb percona mssql"
 
 fail=0
 